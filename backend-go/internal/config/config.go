@@ -1,8 +1,13 @@
 package config
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
 	"os"
 	"strconv"
+	"time"
 )
 
 type Config struct {
@@ -29,12 +34,26 @@ type Config struct {
 	RedisPassword string
 	
 	// JWT
-	JWTSecret   string
-	JWTExpiresIn string
+	JWTSecret       string
+	JWTExpiresIn    time.Duration
+	RefreshTokenTTL time.Duration
 	
 	// File Upload
 	UploadDir           string
 	SupabaseStorageBucket string
+	StorageBackend      string
+	MaxUploadSize       int64
+	
+	// Deposit instructions; methods without an account are not offered
+	DepositBkashNumber  string
+	DepositNagadNumber  string
+	DepositRocketNumber string
+	DepositBankDetails  string
+	DepositUPIID        string
+	
+	// SMS payment matching
+	SMSWebhookKey      string
+	PaymentMatchWindow time.Duration
 	
 	// Google OAuth
 	GoogleClientID     string
@@ -42,6 +61,37 @@ type Config struct {
 	
 	// Frontend
 	FrontendURL string
+	
+	// Real-time events: memory or redis
+	EventBroker      string
+	WSPingInterval   time.Duration
+	WSMaxMessageSize int64
+	WSSendBuffer     int
+	WSReplaySize     int
+	WSReplayWindow   time.Duration
+	
+	// Money
+	RoundingMode string
+	
+	// Idempotency
+	IdempotencyTTL time.Duration
+	
+	// Exchange quotes
+	QuoteSecret string
+	QuoteTTL    time.Duration
+	
+	// Rate feed
+	RateProviders        string
+	RateFeedURL          string
+	RateFeedAPIKey       string
+	RateFeedTimeout      time.Duration
+	RateFile             string
+	RateRefreshInterval  time.Duration
+	RateStaleAfter       time.Duration
+	RateBreakerThreshold int
+	RateBreakerCooldown  time.Duration
+	RateSimulatorSeed    int64
+	RateTickRetention    time.Duration
 }
 
 func Load() *Config {
@@ -68,12 +118,26 @@ func Load() *Config {
 		RedisPassword: getEnv("REDIS_PASSWORD", ""),
 		
 		// JWT
-		JWTSecret:   getEnv("JWT_SECRET", "currency_exchange_secret_key_2024"),
-		JWTExpiresIn: getEnv("JWT_EXPIRES_IN", "168h"),
+		JWTSecret:       getEnv("JWT_SECRET", "currency_exchange_secret_key_2024"),
+		JWTExpiresIn:    getEnvAsDuration("JWT_EXPIRES_IN", 15*time.Minute),
+		RefreshTokenTTL: getEnvAsDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
 		
 		// File Upload
 		UploadDir:           getEnv("UPLOAD_DIR", "./uploads"),
 		SupabaseStorageBucket: getEnv("SUPABASE_STORAGE_BUCKET", "exchange-proofs"),
+		StorageBackend:      getEnv("STORAGE_BACKEND", "local"),
+		MaxUploadSize:       int64(getEnvAsInt("MAX_UPLOAD_SIZE", 5<<20)),
+		
+		// Deposit instructions
+		DepositBkashNumber:  getEnv("DEPOSIT_BKASH_NUMBER", ""),
+		DepositNagadNumber:  getEnv("DEPOSIT_NAGAD_NUMBER", ""),
+		DepositRocketNumber: getEnv("DEPOSIT_ROCKET_NUMBER", ""),
+		DepositBankDetails:  getEnv("DEPOSIT_BANK_DETAILS", ""),
+		DepositUPIID:        getEnv("DEPOSIT_UPI_ID", ""),
+		
+		// SMS payment matching
+		SMSWebhookKey:      getEnv("SMS_WEBHOOK_KEY", ""),
+		PaymentMatchWindow: getEnvAsDuration("PAYMENT_MATCH_WINDOW", 30*time.Minute),
 		
 		// Google OAuth
 		GoogleClientID:     getEnv("GOOGLE_CLIENT_ID", ""),
@@ -81,6 +145,43 @@ func Load() *Config {
 		
 		// Frontend
 		FrontendURL: getEnv("FRONTEND_URL", "http://localhost:8080"),
+		
+		// Real-time events
+		EventBroker:      getEnv("EVENT_BROKER", "memory"),
+		WSPingInterval:   getEnvAsPositiveDuration("WS_PING_INTERVAL", 30*time.Second),
+		WSMaxMessageSize: int64(getEnvAsPositiveInt("WS_MAX_MESSAGE_SIZE", 4096)),
+		WSSendBuffer:     getEnvAsPositiveInt("WS_SEND_BUFFER", 256),
+		WSReplaySize:     getEnvAsPositiveInt("WS_REPLAY_SIZE", 100),
+		WSReplayWindow:   getEnvAsPositiveDuration("WS_REPLAY_WINDOW", 5*time.Minute),
+		
+		// Money
+		RoundingMode: getEnv("ROUNDING_MODE", "half_up"),
+		
+		// Idempotency
+		IdempotencyTTL: getEnvAsDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+		
+		// Exchange quotes
+		QuoteSecret: getEnv("QUOTE_SECRET", ""),
+		QuoteTTL:    getEnvAsDuration("QUOTE_TTL", 60*time.Second),
+		
+		// Rate feed
+		RateProviders:        getEnv("RATE_PROVIDERS", "simulator"),
+		RateFeedURL:          getEnv("RATE_FEED_URL", ""),
+		RateFeedAPIKey:       getEnv("RATE_FEED_API_KEY", ""),
+		RateFeedTimeout:      getEnvAsPositiveDuration("RATE_FEED_TIMEOUT", 5*time.Second),
+		RateFile:             getEnv("RATE_FILE", ""),
+		RateRefreshInterval:  getEnvAsPositiveDuration("RATE_REFRESH_INTERVAL", 30*time.Second),
+		RateStaleAfter:       getEnvAsPositiveDuration("RATE_STALE_AFTER", 5*time.Minute),
+		RateBreakerThreshold: getEnvAsPositiveInt("RATE_BREAKER_THRESHOLD", 3),
+		RateBreakerCooldown:  getEnvAsPositiveDuration("RATE_BREAKER_COOLDOWN", time.Minute),
+		RateSimulatorSeed:    int64(getEnvAsInt("RATE_SIMULATOR_SEED", 0)),
+		RateTickRetention:    getEnvAsPositiveDuration("RATE_TICK_RETENTION", 7*24*time.Hour),
+	}
+	
+	// Without a dedicated secret, quotes are signed with a key derived from
+	// the JWT secret, so no key signs both access tokens and quotes
+	if cfg.QuoteSecret == "" {
+		cfg.QuoteSecret = deriveKey(cfg.JWTSecret, "quote")
 	}
 	
 	// Set database URL
@@ -93,6 +194,13 @@ func Load() *Config {
 	return cfg
 }
 
+// deriveKey derives a key for one purpose from a shared secret.
+func deriveKey(secret, purpose string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -109,6 +217,37 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+	}
+	return defaultValue
+}
+
+// getEnvAsPositiveInt is getEnvAsInt for settings where zero or less would
+// break the server, such as buffer sizes; those fall back to the default.
+func getEnvAsPositiveInt(key string, defaultValue int) int {
+	value := getEnvAsInt(key, defaultValue)
+	if value <= 0 {
+		log.Printf("Ignoring %s=%d: must be positive, using %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvAsPositiveDuration is getEnvAsDuration for intervals that must be
+// positive, such as ticker periods.
+func getEnvAsPositiveDuration(key string, defaultValue time.Duration) time.Duration {
+	value := getEnvAsDuration(key, defaultValue)
+	if value <= 0 {
+		log.Printf("Ignoring %s=%s: must be positive, using %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
 func buildDatabaseURL(cfg *Config) string {
 	return "host=" + cfg.DBHost + 
 		   " port=" + strconv.Itoa(cfg.DBPort) + 
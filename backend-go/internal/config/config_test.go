@@ -0,0 +1,80 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadRejectsNonPositiveWebSocketSettings(t *testing.T) {
+	for _, value := range []string{"0", "-1"} {
+		t.Run(value, func(t *testing.T) {
+			t.Setenv("WS_MAX_MESSAGE_SIZE", value)
+			t.Setenv("WS_SEND_BUFFER", value)
+			t.Setenv("WS_REPLAY_SIZE", value)
+			t.Setenv("WS_PING_INTERVAL", value+"s")
+			t.Setenv("WS_REPLAY_WINDOW", value+"m")
+
+			cfg := Load()
+			if cfg.WSPingInterval != 30*time.Second {
+				t.Errorf("WSPingInterval = %s, want the default", cfg.WSPingInterval)
+			}
+			if cfg.WSMaxMessageSize != 4096 {
+				t.Errorf("WSMaxMessageSize = %d, want the default", cfg.WSMaxMessageSize)
+			}
+			if cfg.WSSendBuffer != 256 {
+				t.Errorf("WSSendBuffer = %d, want the default", cfg.WSSendBuffer)
+			}
+			if cfg.WSReplaySize != 100 {
+				t.Errorf("WSReplaySize = %d, want the default", cfg.WSReplaySize)
+			}
+			if cfg.WSReplayWindow != 5*time.Minute {
+				t.Errorf("WSReplayWindow = %s, want the default", cfg.WSReplayWindow)
+			}
+		})
+	}
+}
+
+func TestLoadKeepsPositiveWebSocketSettings(t *testing.T) {
+	t.Setenv("WS_PING_INTERVAL", "10s")
+	t.Setenv("WS_MAX_MESSAGE_SIZE", "1024")
+	t.Setenv("WS_SEND_BUFFER", "16")
+	t.Setenv("WS_REPLAY_SIZE", "5")
+	t.Setenv("WS_REPLAY_WINDOW", "1m")
+
+	cfg := Load()
+	if cfg.WSPingInterval != 10*time.Second || cfg.WSMaxMessageSize != 1024 || cfg.WSSendBuffer != 16 ||
+		cfg.WSReplaySize != 5 || cfg.WSReplayWindow != time.Minute {
+		t.Errorf("settings not taken over: %s %d %d %d %s", cfg.WSPingInterval, cfg.WSMaxMessageSize,
+			cfg.WSSendBuffer, cfg.WSReplaySize, cfg.WSReplayWindow)
+	}
+}
+
+func TestLoadRejectsNonPositiveRateSettings(t *testing.T) {
+	for _, value := range []string{"0s", "-1m"} {
+		t.Run(value, func(t *testing.T) {
+			t.Setenv("RATE_REFRESH_INTERVAL", value)
+			t.Setenv("RATE_STALE_AFTER", value)
+			t.Setenv("RATE_TICK_RETENTION", value)
+			t.Setenv("RATE_FEED_TIMEOUT", value)
+			t.Setenv("RATE_BREAKER_COOLDOWN", value)
+			t.Setenv("RATE_BREAKER_THRESHOLD", "0")
+
+			cfg := Load()
+			if cfg.RateRefreshInterval != 30*time.Second {
+				t.Errorf("RateRefreshInterval = %s, want the default", cfg.RateRefreshInterval)
+			}
+			if cfg.RateStaleAfter != 5*time.Minute {
+				t.Errorf("RateStaleAfter = %s, want the default", cfg.RateStaleAfter)
+			}
+			if cfg.RateTickRetention != 7*24*time.Hour {
+				t.Errorf("RateTickRetention = %s, want the default", cfg.RateTickRetention)
+			}
+			if cfg.RateFeedTimeout != 5*time.Second {
+				t.Errorf("RateFeedTimeout = %s, want the default", cfg.RateFeedTimeout)
+			}
+			if cfg.RateBreakerCooldown != time.Minute || cfg.RateBreakerThreshold != 3 {
+				t.Errorf("breaker = %d, %s; want the defaults", cfg.RateBreakerThreshold, cfg.RateBreakerCooldown)
+			}
+		})
+	}
+}
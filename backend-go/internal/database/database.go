@@ -57,7 +57,7 @@ func createTables(db *sql.DB) error {
 			id SERIAL PRIMARY KEY,
 			from_currency VARCHAR(3) NOT NULL,
 			to_currency VARCHAR(3) NOT NULL,
-			rate DECIMAL(10,4) NOT NULL,
+			rate DECIMAL(18,8) NOT NULL,
 			spread DECIMAL(5,4) DEFAULT 0.02,
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
@@ -70,7 +70,7 @@ func createTables(db *sql.DB) error {
 			to_currency VARCHAR(3) NOT NULL,
 			from_amount DECIMAL(15,2) NOT NULL,
 			to_amount DECIMAL(15,2) NOT NULL,
-			exchange_rate DECIMAL(10,4) NOT NULL,
+			exchange_rate DECIMAL(18,8) NOT NULL,
 			status VARCHAR(20) DEFAULT 'pending',
 			payment_proof TEXT,
 			admin_notes TEXT,
@@ -98,6 +98,304 @@ func createTables(db *sql.DB) error {
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		)`,
 		
+		`CREATE TABLE IF NOT EXISTS ledger_accounts (
+			id SERIAL PRIMARY KEY,
+			code VARCHAR(100) UNIQUE NOT NULL,
+			user_id INTEGER REFERENCES users(id),
+			type VARCHAR(20) NOT NULL,
+			currency VARCHAR(3) NOT NULL,
+			balance DECIMAL(15,2) NOT NULL DEFAULT 0,
+			allow_negative BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		
+		`CREATE TABLE IF NOT EXISTS journal_entries (
+			id SERIAL PRIMARY KEY,
+			kind VARCHAR(30) NOT NULL,
+			reference VARCHAR(100),
+			description TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		
+		`CREATE TABLE IF NOT EXISTS ledger_postings (
+			id SERIAL PRIMARY KEY,
+			entry_id INTEGER NOT NULL REFERENCES journal_entries(id),
+			account_id INTEGER NOT NULL REFERENCES ledger_accounts(id),
+			currency VARCHAR(3) NOT NULL,
+			amount DECIMAL(15,2) NOT NULL,
+			balance_after DECIMAL(15,2) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		
+		`CREATE INDEX IF NOT EXISTS idx_ledger_postings_account ON ledger_postings(account_id, id)`,
+		
+		`CREATE INDEX IF NOT EXISTS idx_ledger_postings_entry ON ledger_postings(entry_id)`,
+		
+		`ALTER TABLE wallet_transactions ADD COLUMN IF NOT EXISTS journal_entry_id INTEGER REFERENCES journal_entries(id)`,
+		
+		`ALTER TABLE wallets ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 0`,
+		
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS quote_id VARCHAR(64)`,
+		
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_transactions_quote_id ON transactions(quote_id)`,
+		
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS funding_source VARCHAR(10) NOT NULL DEFAULT 'external'`,
+		
+		`ALTER TABLE exchange_rates ADD COLUMN IF NOT EXISTS source VARCHAR(20)`,
+		
+		`CREATE TABLE IF NOT EXISTS rate_history (
+			id BIGSERIAL PRIMARY KEY,
+			from_currency VARCHAR(3) NOT NULL,
+			to_currency VARCHAR(3) NOT NULL,
+			rate DECIMAL(18,8) NOT NULL,
+			source VARCHAR(20),
+			recorded_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+		
+		`CREATE INDEX IF NOT EXISTS idx_rate_history_pair ON rate_history(from_currency, to_currency, recorded_at)`,
+		
+		`CREATE TABLE IF NOT EXISTS rate_candles (
+			from_currency VARCHAR(3) NOT NULL,
+			to_currency VARCHAR(3) NOT NULL,
+			period VARCHAR(3) NOT NULL,
+			bucket_start TIMESTAMP NOT NULL,
+			open DECIMAL(18,8) NOT NULL,
+			high DECIMAL(18,8) NOT NULL,
+			low DECIMAL(18,8) NOT NULL,
+			close DECIMAL(18,8) NOT NULL,
+			ticks INTEGER NOT NULL,
+			PRIMARY KEY (from_currency, to_currency, period, bucket_start)
+		)`,
+		
+		`CREATE INDEX IF NOT EXISTS idx_rate_candles_period ON rate_candles(period, bucket_start)`,
+		
+		`CREATE TABLE IF NOT EXISTS rate_simulator_params (
+			id SERIAL PRIMARY KEY,
+			from_currency VARCHAR(3) NOT NULL,
+			to_currency VARCHAR(3) NOT NULL,
+			base_rate DECIMAL(18,8) NOT NULL,
+			min_rate DECIMAL(18,8) NOT NULL,
+			max_rate DECIMAL(18,8) NOT NULL,
+			base_volatility DOUBLE PRECISION NOT NULL,
+			max_volatility DOUBLE PRECISION NOT NULL,
+			mean_reversion DOUBLE PRECISION NOT NULL,
+			max_trend_duration INTEGER NOT NULL,
+			updated_by INTEGER REFERENCES users(id),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (from_currency, to_currency)
+		)`,
+		
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS fee DECIMAL(15,2) NOT NULL DEFAULT 0`,
+		
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS pricing_segment VARCHAR(20)`,
+		
+		`CREATE TABLE IF NOT EXISTS pricing_tiers (
+			id SERIAL PRIMARY KEY,
+			from_currency VARCHAR(3) NOT NULL,
+			to_currency VARCHAR(3) NOT NULL,
+			segment VARCHAR(20),
+			min_amount DECIMAL(15,2) NOT NULL DEFAULT 0,
+			max_amount DECIMAL(15,2),
+			spread DECIMAL(5,4) NOT NULL,
+			fixed_fee DECIMAL(15,2) NOT NULL DEFAULT 0,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		
+		`CREATE INDEX IF NOT EXISTS idx_pricing_tiers_pair ON pricing_tiers(from_currency, to_currency, min_amount)`,
+		
+		`CREATE TABLE IF NOT EXISTS currencies (
+			code VARCHAR(3) PRIMARY KEY,
+			name VARCHAR(50) NOT NULL,
+			symbol VARCHAR(5) NOT NULL,
+			decimals SMALLINT NOT NULL DEFAULT 2,
+			enabled BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		
+		// Older databases collected a duplicate of every default rate per start
+		`DELETE FROM exchange_rates a USING exchange_rates b
+		WHERE a.from_currency = b.from_currency AND a.to_currency = b.to_currency AND a.id > b.id`,
+		
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_exchange_rates_pair ON exchange_rates(from_currency, to_currency)`,
+		
+		`CREATE TABLE IF NOT EXISTS rate_overrides (
+			id SERIAL PRIMARY KEY,
+			from_currency VARCHAR(3) NOT NULL,
+			to_currency VARCHAR(3) NOT NULL,
+			rate DECIMAL(18,8) NOT NULL,
+			spread DECIMAL(5,4),
+			status VARCHAR(10) NOT NULL,
+			starts_at TIMESTAMP NOT NULL,
+			expires_at TIMESTAMP,
+			reason TEXT,
+			created_by INTEGER NOT NULL REFERENCES users(id),
+			cancelled_by INTEGER REFERENCES users(id),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		
+		`CREATE INDEX IF NOT EXISTS idx_rate_overrides_status ON rate_overrides(status, starts_at)`,
+		
+		`ALTER TABLE rate_overrides ADD COLUMN IF NOT EXISTS previous_spread DECIMAL(5,4)`,
+		
+		`ALTER TABLE rate_overrides ADD COLUMN IF NOT EXISTS force BOOLEAN NOT NULL DEFAULT FALSE`,
+		
+		// Rates used to be kept to 4 decimal places, too few for cross rates
+		// and minor currencies
+		`ALTER TABLE exchange_rates ALTER COLUMN rate TYPE DECIMAL(18,8)`,
+		
+		`ALTER TABLE transactions ALTER COLUMN exchange_rate TYPE DECIMAL(18,8)`,
+		
+		`ALTER TABLE rate_history ALTER COLUMN rate TYPE DECIMAL(18,8)`,
+		
+		`ALTER TABLE rate_candles
+			ALTER COLUMN open TYPE DECIMAL(18,8),
+			ALTER COLUMN high TYPE DECIMAL(18,8),
+			ALTER COLUMN low TYPE DECIMAL(18,8),
+			ALTER COLUMN close TYPE DECIMAL(18,8)`,
+		
+		`ALTER TABLE rate_simulator_params
+			ALTER COLUMN base_rate TYPE DECIMAL(18,8),
+			ALTER COLUMN min_rate TYPE DECIMAL(18,8),
+			ALTER COLUMN max_rate TYPE DECIMAL(18,8)`,
+		
+		`ALTER TABLE rate_overrides ALTER COLUMN rate TYPE DECIMAL(18,8)`,
+		
+		`CREATE TABLE IF NOT EXISTS transaction_events (
+			id SERIAL PRIMARY KEY,
+			transaction_id INTEGER NOT NULL REFERENCES transactions(id),
+			from_status VARCHAR(20),
+			to_status VARCHAR(20) NOT NULL,
+			actor_role VARCHAR(10) NOT NULL,
+			actor_id INTEGER,
+			reason TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		
+		`CREATE INDEX IF NOT EXISTS idx_transaction_events_transaction ON transaction_events(transaction_id, id)`,
+		
+		`CREATE TABLE IF NOT EXISTS wallet_holds (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			wallet_id INTEGER NOT NULL REFERENCES wallets(id),
+			currency VARCHAR(3) NOT NULL,
+			amount DECIMAL(15,2) NOT NULL,
+			status VARCHAR(10) NOT NULL DEFAULT 'active',
+			reference VARCHAR(100) NOT NULL,
+			description TEXT,
+			expires_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		
+		`CREATE INDEX IF NOT EXISTS idx_wallet_holds_user ON wallet_holds(user_id, status)`,
+		
+		`CREATE INDEX IF NOT EXISTS idx_wallet_holds_reference ON wallet_holds(reference)`,
+		
+		`CREATE INDEX IF NOT EXISTS idx_wallet_holds_expires ON wallet_holds(expires_at) WHERE status = 'active'`,
+		
+		`CREATE TABLE IF NOT EXISTS withdrawal_requests (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			currency VARCHAR(3) NOT NULL,
+			amount DECIMAL(15,2) NOT NULL,
+			method VARCHAR(10) NOT NULL,
+			account_name VARCHAR(255),
+			account_number VARCHAR(50),
+			bank_name VARCHAR(255),
+			ifsc VARCHAR(11),
+			upi_id VARCHAR(100),
+			status VARCHAR(10) NOT NULL DEFAULT 'pending',
+			hold_id INTEGER REFERENCES wallet_holds(id),
+			payout_reference VARCHAR(100),
+			failure_reason TEXT,
+			processed_by INTEGER REFERENCES users(id),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		
+		`CREATE INDEX IF NOT EXISTS idx_withdrawal_requests_user ON withdrawal_requests(user_id, created_at)`,
+		
+		`CREATE INDEX IF NOT EXISTS idx_withdrawal_requests_status ON withdrawal_requests(status, created_at)`,
+		
+		`CREATE TABLE IF NOT EXISTS deposit_requests (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			reference VARCHAR(20) NOT NULL UNIQUE,
+			currency VARCHAR(3) NOT NULL,
+			amount DECIMAL(15,2) NOT NULL,
+			method VARCHAR(10) NOT NULL,
+			instructions TEXT NOT NULL,
+			status VARCHAR(10) NOT NULL DEFAULT 'pending',
+			proof_key TEXT,
+			proof_content_type VARCHAR(50),
+			reject_reason TEXT,
+			processed_by INTEGER REFERENCES users(id),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		
+		`CREATE INDEX IF NOT EXISTS idx_deposit_requests_user ON deposit_requests(user_id, created_at)`,
+		
+		`CREATE INDEX IF NOT EXISTS idx_deposit_requests_status ON deposit_requests(status, created_at)`,
+		
+		`CREATE TABLE IF NOT EXISTS incoming_payments (
+			id SERIAL PRIMARY KEY,
+			provider VARCHAR(20) NOT NULL,
+			trx_id VARCHAR(50) NOT NULL,
+			currency VARCHAR(3) NOT NULL,
+			amount DECIMAL(15,2) NOT NULL,
+			sender VARCHAR(20),
+			reference VARCHAR(50),
+			sms_sender VARCHAR(50) NOT NULL,
+			sms_body TEXT NOT NULL,
+			received_at TIMESTAMP NOT NULL,
+			status VARCHAR(10) NOT NULL,
+			matched_type VARCHAR(20),
+			matched_id INTEGER,
+			note TEXT,
+			resolved_by INTEGER REFERENCES users(id),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (provider, trx_id)
+		)`,
+		
+		`CREATE INDEX IF NOT EXISTS idx_incoming_payments_status ON incoming_payments(status, received_at)`,
+		
+		`CREATE TABLE IF NOT EXISTS idempotency_keys (
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			key VARCHAR(255) NOT NULL,
+			request_hash VARCHAR(64) NOT NULL,
+			status_code INTEGER,
+			response_body TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (user_id, key)
+		)`,
+		
+		`CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires ON idempotency_keys(expires_at)`,
+		
+		`CREATE TABLE IF NOT EXISTS refresh_tokens (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			family_id VARCHAR(64) NOT NULL,
+			token_hash VARCHAR(64) UNIQUE NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP,
+			revoked_at TIMESTAMP
+		)`,
+		
+		`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user ON refresh_tokens(user_id, family_id)`,
+		
+		`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_expires ON refresh_tokens(expires_at)`,
+		
+		`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens(family_id)`,
+		
 		`CREATE TABLE IF NOT EXISTS support_messages (
 			id SERIAL PRIMARY KEY,
 			user_id INTEGER REFERENCES users(id),
@@ -113,13 +411,32 @@ func createTables(db *sql.DB) error {
 		}
 	}
 
+	// Register the currencies we started with if they don't exist
+	defaultCurrencies := []struct {
+		code, name, symbol string
+	}{
+		{"BDT", "Bangladeshi Taka", "৳"},
+		{"INR", "Indian Rupee", "₹"},
+	}
+
+	for _, currency := range defaultCurrencies {
+		_, err := db.Exec(`
+			INSERT INTO currencies (code, name, symbol, decimals, enabled)
+			VALUES ($1, $2, $3, 2, TRUE)
+			ON CONFLICT DO NOTHING`,
+			currency.code, currency.name, currency.symbol)
+		if err != nil {
+			return fmt.Errorf("failed to insert default currency: %w", err)
+		}
+	}
+
 	// Insert default exchange rates if they don't exist
 	defaultRates := []struct {
 		from, to string
-		rate     float64
+		rate     string
 	}{
-		{"BDT", "INR", 0.70},
-		{"INR", "BDT", 1.43},
+		{"BDT", "INR", "0.70"},
+		{"INR", "BDT", "1.43"},
 	}
 
 	for _, rate := range defaultRates {
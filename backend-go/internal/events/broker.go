@@ -0,0 +1,46 @@
+package events
+
+import "sync"
+
+// Broker carries events between the nodes serving clients. Events published
+// on any node reach the handlers subscribed on every node, including the
+// publishing one.
+type Broker interface {
+	Publisher
+	Subscribe(handler func(Event))
+}
+
+// MemoryBroker is a Broker for a single node: Publish numbers events and
+// hands them straight to the local handlers. Numbering restarts with the
+// process.
+type MemoryBroker struct {
+	mu       sync.Mutex
+	seqs     map[string]int64
+	handlers []func(Event)
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{seqs: make(map[string]int64)}
+}
+
+// Publish numbers event in its stream unless it already is, and delivers
+// it. Delivery happens under the lock, so handlers see every stream in
+// order.
+func (b *MemoryBroker) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if event.Seq == 0 {
+		b.seqs[event.Stream()]++
+		event.Seq = b.seqs[event.Stream()]
+	}
+	for _, handler := range b.handlers {
+		handler(event)
+	}
+}
+
+func (b *MemoryBroker) Subscribe(handler func(Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
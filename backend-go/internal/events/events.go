@@ -0,0 +1,101 @@
+// Package events defines the envelope in which changes are pushed to
+// connected clients, independent of the transport carrying them.
+package events
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// Version is the version of the envelope and payload formats. It changes
+// whenever a payload changes incompatibly.
+const Version = 1
+
+// Event types
+const (
+	// RateUpdated carries a models.RateTick
+	RateUpdated = "rate.updated"
+	// TransactionUpdated carries a models.Transaction
+	TransactionUpdated = "transaction.updated"
+	// WalletUpdated carries a models.Wallet after its balances changed
+	WalletUpdated = "wallet.updated"
+	// DepositUpdated carries a models.DepositRequest
+	DepositUpdated = "deposit.updated"
+	// WithdrawalUpdated carries a models.WithdrawalRequest
+	WithdrawalUpdated = "withdrawal.updated"
+	// SessionRevoked carries a SessionRevokedPayload. It has no topic: it
+	// tells every instance to drop the session's connections.
+	SessionRevoked = "session.revoked"
+)
+
+// Topics clients subscribe to. Events on user topics only reach the user
+// they are addressed to; admin topics only admins.
+const (
+	TopicRatesPrefix      = "rates:"
+	TopicUserPrefix       = "user:"
+	TopicUserTransactions = "user:transactions"
+	TopicUserWallet       = "user:wallet"
+	TopicAdminQueue       = "admin:queue"
+)
+
+// RatesTopic is the topic of a pair's rate changes, e.g. rates:BDT_INR.
+func RatesTopic(pair string) string {
+	return TopicRatesPrefix + pair
+}
+
+// SessionRevokedPayload names a session that was signed out
+type SessionRevokedPayload struct {
+	SessionID string `json:"session_id"`
+}
+
+// Event is the envelope every pushed message is sent in. It goes to the
+// subscribers of Topic; UserID addresses it to one user's connections, and
+// is zero for events everyone subscribed may see. Seq numbers the events of
+// a stream without gaps; the broker assigns it.
+type Event struct {
+	Type      string          `json:"type"`
+	Version   int             `json:"version"`
+	Topic     string          `json:"topic,omitempty"`
+	Seq       int64           `json:"seq,omitempty"`
+	Payload   json.RawMessage `json:"payload"`
+	Timestamp time.Time       `json:"timestamp"`
+	UserID    int             `json:"-"`
+}
+
+// Stream is the sequence an event is numbered in: its topic, or for events
+// addressed to a user, the user's share of it.
+func (e Event) Stream() string {
+	return StreamOf(e.Topic, e.UserID)
+}
+
+// StreamOf is the stream of topic as userID sees it; zero for everyone.
+func StreamOf(topic string, userID int) string {
+	if userID == 0 {
+		return topic
+	}
+	return topic + "#" + strconv.Itoa(userID)
+}
+
+// New wraps payload in an envelope of the given type for the subscribers of
+// topic, addressed to userID unless it is zero.
+func New(eventType, topic string, userID int, payload interface{}) (Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		Type:      eventType,
+		Version:   Version,
+		Topic:     topic,
+		Payload:   data,
+		Timestamp: time.Now().UTC(),
+		UserID:    userID,
+	}, nil
+}
+
+// Publisher delivers events to whoever is listening. Publish must not block
+// on slow listeners, since it is called on request paths.
+type Publisher interface {
+	Publish(event Event)
+}
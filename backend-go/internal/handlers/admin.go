@@ -13,10 +13,15 @@ import (
 type AdminHandler struct {
 	adminService       *services.AdminService
 	transactionService *services.TransactionService
+	rateService        *services.RateService
 }
 
-func NewAdminHandler(adminService *services.AdminService) *AdminHandler {
-	return &AdminHandler{adminService: adminService}
+func NewAdminHandler(adminService *services.AdminService, transactionService *services.TransactionService, rateService *services.RateService) *AdminHandler {
+	return &AdminHandler{
+		adminService:       adminService,
+		transactionService: transactionService,
+		rateService:        rateService,
+	}
 }
 
 func (h *AdminHandler) GetDashboard(c *gin.Context) {
@@ -79,13 +84,41 @@ func (h *AdminHandler) UpdateTransactionStatus(c *gin.Context) {
 		return
 	}
 
-	err = h.transactionService.UpdateTransactionStatus(transactionID, req.Status, req.AdminNotes)
+	adminID, _ := c.Get("user_id")
+	reason := req.Reason
+	if reason == "" {
+		reason = req.AdminNotes
+	}
+
+	transaction, err := h.transactionService.TransitionTransaction(transactionID, req.Status,
+		services.AdminActor(adminID.(int)), reason, req.AdminNotes)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(transitionErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Transaction status updated successfully"})
+	c.JSON(http.StatusOK, transaction)
+}
+
+func (h *AdminHandler) GetTransactionEvents(c *gin.Context) {
+	transactionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction ID"})
+		return
+	}
+
+	if h.transactionService == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction service not available"})
+		return
+	}
+
+	events, err := h.transactionService.GetTransactionEvents(transactionID, 0)
+	if err != nil {
+		c.JSON(transitionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"events": events})
 }
 
 func (h *AdminHandler) GetUsers(c *gin.Context) {
@@ -140,22 +173,87 @@ func (h *AdminHandler) UpdateUserStatus(c *gin.Context) {
 }
 
 func (h *AdminHandler) UpdateRates(c *gin.Context) {
-	var req struct {
-		FromCurrency string  `json:"from_currency" binding:"required"`
-		ToCurrency   string  `json:"to_currency" binding:"required"`
-		Rate         float64 `json:"rate" binding:"required,gt=0"`
+	var req models.UpdateRateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	loops, err := h.rateService.SetRate(req.FromCurrency, req.ToCurrency, req.Rate, req.Spread, req.Force)
+	if err != nil {
+		c.JSON(rateErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error(), "loops": loops})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Exchange rate updated successfully", "arbitrage_loops": loops})
+}
+
+// GetArbitrageReport lists the round trips through current rates that
+// return more than they start with.
+func (h *AdminHandler) GetArbitrageReport(c *gin.Context) {
+	report, err := h.rateService.GetArbitrageReport()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetRateOverrides lists rate overrides, optionally of one ?status=.
+func (h *AdminHandler) GetRateOverrides(c *gin.Context) {
+	limit, offset := pagination(c, 50)
+	overrides, err := h.rateService.GetOverrides(c.Query("status"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
+	c.JSON(http.StatusOK, gin.H{"overrides": overrides})
+}
+
+// CreateRateOverride pins a pair's rate, now or from starts_at, until
+// expires_at or until it is cancelled.
+func (h *AdminHandler) CreateRateOverride(c *gin.Context) {
+	var req models.RateOverrideRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	err := h.adminService.UpdateExchangeRate(req.FromCurrency, req.ToCurrency, req.Rate)
+	adminID, _ := c.Get("user_id")
+	override, loops, err := h.rateService.CreateOverride(adminID.(int), req)
+	if err != nil {
+		c.JSON(rateErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error(), "loops": loops})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"override": override, "arbitrage_loops": loops})
+}
+
+func (h *AdminHandler) CancelRateOverride(c *gin.Context) {
+	overrideID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid override ID"})
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	override, err := h.rateService.CancelOverride(overrideID, adminID.(int))
+	if err != nil {
+		c.JSON(rateErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, override)
+}
+
+func (h *AdminHandler) VerifyLedger(c *gin.Context) {
+	report, err := h.adminService.VerifyLedger()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Exchange rate updated successfully"})
-}
\ No newline at end of file
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"bdpayx-backend/internal/models"
+	"bdpayx-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CurrencyHandler struct {
+	currencyService *services.CurrencyService
+}
+
+func NewCurrencyHandler(currencyService *services.CurrencyService) *CurrencyHandler {
+	return &CurrencyHandler{currencyService: currencyService}
+}
+
+// GetCurrencies lists the enabled currencies.
+func (h *CurrencyHandler) GetCurrencies(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"currencies": h.currencyService.GetCurrencies(false)})
+}
+
+// GetAllCurrencies lists the whole registry, disabled currencies included.
+func (h *CurrencyHandler) GetAllCurrencies(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"currencies": h.currencyService.GetCurrencies(true)})
+}
+
+// SaveCurrency adds the currency ":code" to the registry or changes it.
+func (h *CurrencyHandler) SaveCurrency(c *gin.Context) {
+	var req models.CurrencyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	currency, err := h.currencyService.SaveCurrency(c.Param("code"), req)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrInvalidCurrency):
+			status = http.StatusBadRequest
+		case errors.Is(err, services.ErrCurrencyInUse):
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, currency)
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"bdpayx-backend/internal/models"
+	"bdpayx-backend/internal/services"
+	"bdpayx-backend/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DepositHandler struct {
+	depositService *services.DepositService
+}
+
+func NewDepositHandler(depositService *services.DepositService) *DepositHandler {
+	return &DepositHandler{depositService: depositService}
+}
+
+func (h *DepositHandler) GetMethods(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"methods": h.depositService.GetMethods()})
+}
+
+// CreateDeposit declares a deposit. The response carries the reference and
+// payment instructions; nothing is credited until an admin approves it.
+func (h *DepositHandler) CreateDeposit(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.WalletDepositRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	deposit, err := h.depositService.CreateDeposit(userID.(int), req)
+	if err != nil {
+		c.JSON(depositErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, deposit)
+}
+
+// UploadProof takes the payment screenshot as the multipart field "proof".
+func (h *DepositHandler) UploadProof(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	depositID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deposit ID"})
+		return
+	}
+
+	file, err := c.FormFile("proof")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+
+	deposit, err := h.depositService.UploadProof(userID.(int), depositID, f)
+	if err != nil {
+		c.JSON(depositErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, deposit)
+}
+
+func (h *DepositHandler) GetUserDeposits(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	limit, offset := pagination(c, 20)
+	deposits, err := h.depositService.GetUserDeposits(userID.(int), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deposits": deposits})
+}
+
+func (h *DepositHandler) CancelDeposit(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	depositID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deposit ID"})
+		return
+	}
+
+	deposit, err := h.depositService.CancelDeposit(userID.(int), depositID)
+	if err != nil {
+		c.JSON(depositErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, deposit)
+}
+
+func (h *DepositHandler) GetDeposits(c *gin.Context) {
+	limit, offset := pagination(c, 50)
+	deposits, err := h.depositService.GetDeposits(c.Query("status"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deposits": deposits})
+}
+
+func (h *DepositHandler) GetProof(c *gin.Context) {
+	depositID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deposit ID"})
+		return
+	}
+
+	proof, contentType, err := h.depositService.GetProof(depositID)
+	writeProof(c, proof, contentType, err)
+}
+
+// GetUserProof returns the payment proof of one of the caller's deposits.
+func (h *DepositHandler) GetUserProof(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	depositID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deposit ID"})
+		return
+	}
+
+	proof, contentType, err := h.depositService.GetUserProof(userID.(int), depositID)
+	writeProof(c, proof, contentType, err)
+}
+
+func writeProof(c *gin.Context, proof io.ReadCloser, contentType string, err error) {
+	if err != nil {
+		c.JSON(depositErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+	defer proof.Close()
+
+	c.Header("Content-Type", contentType)
+	c.Header("Cache-Control", "private, no-store")
+	c.Status(http.StatusOK)
+	io.Copy(c.Writer, proof)
+}
+
+func (h *DepositHandler) ApproveDeposit(c *gin.Context) {
+	depositID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deposit ID"})
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	deposit, err := h.depositService.ApproveDeposit(depositID, adminID.(int))
+	if err != nil {
+		c.JSON(depositErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, deposit)
+}
+
+func (h *DepositHandler) RejectDeposit(c *gin.Context) {
+	depositID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deposit ID"})
+		return
+	}
+
+	var req models.RejectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	deposit, err := h.depositService.RejectDeposit(depositID, adminID.(int), req.Reason)
+	if err != nil {
+		c.JSON(depositErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, deposit)
+}
+
+func depositErrorStatus(err error, fallback int) int {
+	switch {
+	case errors.Is(err, services.ErrDepositNotFound), errors.Is(err, storage.ErrNotFound),
+		errors.Is(err, services.ErrWalletNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrDepositNotAllowed), errors.Is(err, services.ErrDepositOpen):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrProofTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, services.ErrProofType):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, services.ErrDepositMethodUnavailable):
+		return http.StatusBadRequest
+	default:
+		return fallback
+	}
+}
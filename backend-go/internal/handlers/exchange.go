@@ -1,20 +1,28 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strings"
+	"time"
 
 	"bdpayx-backend/internal/models"
+	"bdpayx-backend/internal/rates"
 	"bdpayx-backend/internal/services"
 
 	"github.com/gin-gonic/gin"
 )
 
 type ExchangeHandler struct {
-	rateService *services.RateService
+	rateService  *services.RateService
+	quoteService *services.QuoteService
 }
 
-func NewExchangeHandler(rateService *services.RateService) *ExchangeHandler {
-	return &ExchangeHandler{rateService: rateService}
+func NewExchangeHandler(rateService *services.RateService, quoteService *services.QuoteService) *ExchangeHandler {
+	return &ExchangeHandler{
+		rateService:  rateService,
+		quoteService: quoteService,
+	}
 }
 
 func (h *ExchangeHandler) GetRates(c *gin.Context) {
@@ -23,8 +31,13 @@ func (h *ExchangeHandler) GetRates(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	crossRates, err := h.rateService.GetCrossRates()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"rates": rates})
+	c.JSON(http.StatusOK, gin.H{"rates": rates, "cross_rates": crossRates, "providers": h.rateService.FeedStatus()})
 }
 
 func (h *ExchangeHandler) CalculateExchange(c *gin.Context) {
@@ -34,11 +47,134 @@ func (h *ExchangeHandler) CalculateExchange(c *gin.Context) {
 		return
 	}
 
-	result, err := h.rateService.CalculateExchange(req.FromCurrency, req.ToCurrency, req.Amount)
+	// Signed-in users get the pricing of their segment
+	userID, _ := c.Get("user_id")
+	id, _ := userID.(int)
+	result, err := h.quoteService.Issue(req.FromCurrency, req.ToCurrency, req.Amount, req.Side, id)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, result)
-}
\ No newline at end of file
+}
+
+// GetHistory returns OHLC candles for ?pair=BDT_INR&interval=1h, optionally
+// limited to buckets starting in [from, to) given as RFC 3339 times.
+func (h *ExchangeHandler) GetHistory(c *gin.Context) {
+	from, to, ok := parsePair(c.Query("pair"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "pair must look like BDT_INR"})
+		return
+	}
+
+	start, err := parseTime(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from time"})
+		return
+	}
+	end, err := parseTime(c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to time"})
+		return
+	}
+
+	interval := c.DefaultQuery("interval", "1h")
+	limit, offset := pagination(c, 500)
+	candles, err := h.rateService.GetCandles(from, to, interval, start, end, limit, offset)
+	if err != nil {
+		c.JSON(rateErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"pair": from + "_" + to, "interval": interval, "candles": candles})
+}
+
+// GetRateAt answers which rate was live at ?at= (RFC 3339, default now).
+func (h *ExchangeHandler) GetRateAt(c *gin.Context) {
+	from, to, ok := parsePair(c.Query("pair"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "pair must look like BDT_INR"})
+		return
+	}
+
+	at, err := parseTime(c.Query("at"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid at time"})
+		return
+	}
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	tick, err := h.rateService.GetRateAt(from, to, at)
+	if err != nil {
+		c.JSON(rateErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tick)
+}
+
+func (h *ExchangeHandler) GetSimulatorParams(c *gin.Context) {
+	params, err := h.rateService.GetSimulatorParams()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"pairs": params})
+}
+
+// UpdateSimulatorParams tunes the simulated market of a pair given as
+// ":pair", e.g. BDT_INR.
+func (h *ExchangeHandler) UpdateSimulatorParams(c *gin.Context) {
+	from, to, ok := parsePair(c.Param("pair"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Pair must look like BDT_INR"})
+		return
+	}
+
+	var req models.UpdateSimulatorParamsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	params, err := h.rateService.UpdateSimulatorParams(from, to, adminID.(int), req)
+	if err != nil {
+		c.JSON(rateErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, params)
+}
+
+func parsePair(pair string) (string, string, bool) {
+	from, to, ok := strings.Cut(strings.ToUpper(pair), "_")
+	return from, to, ok && from != "" && to != ""
+}
+
+// parseTime reads an optional RFC 3339 query time; empty gives the zero time.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func rateErrorStatus(err error, fallback int) int {
+	switch {
+	case errors.Is(err, services.ErrRateNotFound), errors.Is(err, services.ErrOverrideNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrArbitrage), errors.Is(err, services.ErrRatePinned),
+		errors.Is(err, services.ErrOverrideOverlap), errors.Is(err, services.ErrOverrideResolved):
+		return http.StatusConflict
+	case errors.Is(err, rates.ErrInvalidSimParams), errors.Is(err, services.ErrUnknownInterval),
+		errors.Is(err, services.ErrInvalidSpread), errors.Is(err, services.ErrInvalidOverride):
+		return http.StatusBadRequest
+	default:
+		return fallback
+	}
+}
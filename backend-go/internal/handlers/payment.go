@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"bdpayx-backend/internal/models"
+	"bdpayx-backend/internal/payments"
+	"bdpayx-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PaymentHandler struct {
+	paymentService *services.PaymentService
+}
+
+func NewPaymentHandler(paymentService *services.PaymentService) *PaymentHandler {
+	return &PaymentHandler{paymentService: paymentService}
+}
+
+// ReceiveSMS is called by the SMS forwarder on the merchant phone. SMS that
+// are not payments, and payments already recorded, are acknowledged with 200
+// so the forwarder does not retry them.
+func (h *PaymentHandler) ReceiveSMS(c *gin.Context) {
+	var req models.SMSWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	payment, err := h.paymentService.ProcessSMS(req.Sender, req.Body, req.Timestamp)
+	if err != nil {
+		if errors.Is(err, payments.ErrUnknownSender) || errors.Is(err, payments.ErrNotIncoming) ||
+			errors.Is(err, payments.ErrUnparsable) || errors.Is(err, services.ErrDuplicatePayment) {
+			c.JSON(http.StatusOK, gin.H{"processed": false, "reason": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"processed": true, "payment": payment})
+}
+
+func (h *PaymentHandler) GetPayments(c *gin.Context) {
+	limit, offset := pagination(c, 50)
+	list, err := h.paymentService.GetPayments(c.Query("status"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"payments": list})
+}
+
+func (h *PaymentHandler) ReconcilePayment(c *gin.Context) {
+	paymentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment ID"})
+		return
+	}
+
+	var req models.ReconcilePaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	payment, err := h.paymentService.ReconcilePayment(paymentID, adminID.(int), req)
+	if err != nil {
+		c.JSON(paymentErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, payment)
+}
+
+func (h *PaymentHandler) IgnorePayment(c *gin.Context) {
+	paymentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment ID"})
+		return
+	}
+
+	var req models.RejectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	payment, err := h.paymentService.IgnorePayment(paymentID, adminID.(int), req.Reason)
+	if err != nil {
+		c.JSON(paymentErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, payment)
+}
+
+func paymentErrorStatus(err error, fallback int) int {
+	switch {
+	case errors.Is(err, services.ErrPaymentNotFound), errors.Is(err, services.ErrDepositNotFound),
+		errors.Is(err, services.ErrTransactionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrPaymentResolved), errors.Is(err, services.ErrDepositNotAllowed),
+		errors.Is(err, services.ErrInvalidTransition):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrReconcileTarget), errors.Is(err, services.ErrPaymentDoesNotMatch):
+		return http.StatusBadRequest
+	default:
+		return fallback
+	}
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"bdpayx-backend/internal/models"
+	"bdpayx-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PricingHandler struct {
+	pricingService *services.PricingService
+}
+
+func NewPricingHandler(pricingService *services.PricingService) *PricingHandler {
+	return &PricingHandler{pricingService: pricingService}
+}
+
+// GetTiers lists pricing tiers, optionally of one pair via ?from=&to=.
+func (h *PricingHandler) GetTiers(c *gin.Context) {
+	tiers, err := h.pricingService.GetTiers(c.Query("from"), c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tiers": tiers})
+}
+
+func (h *PricingHandler) CreateTier(c *gin.Context) {
+	var req models.PricingTierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tier, err := h.pricingService.CreateTier(req)
+	if err != nil {
+		c.JSON(pricingErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, tier)
+}
+
+func (h *PricingHandler) UpdateTier(c *gin.Context) {
+	tierID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tier ID"})
+		return
+	}
+
+	var req models.PricingTierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tier, err := h.pricingService.UpdateTier(tierID, req)
+	if err != nil {
+		c.JSON(pricingErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tier)
+}
+
+func (h *PricingHandler) DeleteTier(c *gin.Context) {
+	tierID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tier ID"})
+		return
+	}
+
+	if err := h.pricingService.DeleteTier(tierID); err != nil {
+		c.JSON(pricingErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Pricing tier deleted successfully"})
+}
+
+// SetUserSegment moves a user into a pricing segment; an empty segment puts
+// them back on the pricing for everyone.
+func (h *PricingHandler) SetUserSegment(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.UserSegmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.pricingService.SetUserSegment(userID, req.Segment); err != nil {
+		c.JSON(pricingErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User segment updated successfully"})
+}
+
+func pricingErrorStatus(err error, fallback int) int {
+	switch {
+	case errors.Is(err, services.ErrTierNotFound), errors.Is(err, services.ErrUserNotFound),
+		errors.Is(err, services.ErrRateNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrTierOverlap):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrInvalidTier):
+		return http.StatusBadRequest
+	default:
+		return fallback
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -12,10 +13,14 @@ import (
 
 type TransactionHandler struct {
 	transactionService *services.TransactionService
+	quoteService       *services.QuoteService
 }
 
-func NewTransactionHandler(transactionService *services.TransactionService) *TransactionHandler {
-	return &TransactionHandler{transactionService: transactionService}
+func NewTransactionHandler(transactionService *services.TransactionService, quoteService *services.QuoteService) *TransactionHandler {
+	return &TransactionHandler{
+		transactionService: transactionService,
+		quoteService:       quoteService,
+	}
 }
 
 func (h *TransactionHandler) CreateTransaction(c *gin.Context) {
@@ -31,8 +36,27 @@ func (h *TransactionHandler) CreateTransaction(c *gin.Context) {
 		return
 	}
 
-	transaction, err := h.transactionService.CreateTransaction(userID.(int), req)
+	// Amounts and rate come from the signed quote, never from the client
+	quote, err := h.quoteService.Redeem(req.QuoteID, userID.(int))
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrQuoteExpired) {
+			status = http.StatusGone
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	transaction, err := h.transactionService.CreateTransaction(userID.(int), quote, req.PayFromWallet)
 	if err != nil {
+		if errors.Is(err, services.ErrQuoteUsed) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, services.ErrInsufficientFunds) || errors.Is(err, services.ErrWalletNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -87,14 +111,48 @@ func (h *TransactionHandler) GetTransaction(c *gin.Context) {
 
 	transaction, err := h.transactionService.GetTransaction(transactionID, userID.(int))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		if errors.Is(err, services.ErrTransactionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, transaction)
 }
 
+func (h *TransactionHandler) GetTransactionEvents(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	transactionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction ID"})
+		return
+	}
+
+	events, err := h.transactionService.GetTransactionEvents(transactionID, userID.(int))
+	if err != nil {
+		c.JSON(transitionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
+
+// UpdateTransactionStatus lets a user move their own order; the state machine
+// only allows them to cancel it while it is still pending.
 func (h *TransactionHandler) UpdateTransactionStatus(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
 	transactionID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction ID"})
@@ -107,11 +165,28 @@ func (h *TransactionHandler) UpdateTransactionStatus(c *gin.Context) {
 		return
 	}
 
-	err = h.transactionService.UpdateTransactionStatus(transactionID, req.Status, req.AdminNotes)
+	transaction, err := h.transactionService.TransitionTransaction(transactionID, req.Status,
+		services.UserActor(userID.(int)), req.Reason, "")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(transitionErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Transaction status updated successfully"})
-}
\ No newline at end of file
+	c.JSON(http.StatusOK, transaction)
+}
+
+// transitionErrorStatus maps state machine errors to HTTP status codes.
+func transitionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrTransactionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrUnknownStatus):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrTransitionForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrInvalidTransition), errors.Is(err, services.ErrInsufficientFunds):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
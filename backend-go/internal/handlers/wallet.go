@@ -4,7 +4,6 @@ import (
 	"net/http"
 	"strconv"
 
-	"bdpayx-backend/internal/models"
 	"bdpayx-backend/internal/services"
 
 	"github.com/gin-gonic/gin"
@@ -34,50 +33,6 @@ func (h *WalletHandler) GetBalance(c *gin.Context) {
 	c.JSON(http.StatusOK, wallet)
 }
 
-func (h *WalletHandler) Deposit(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-		return
-	}
-
-	var req models.WalletDepositRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	err := h.walletService.Deposit(userID.(int), req.Currency, req.Amount, "Manual deposit")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "Deposit successful"})
-}
-
-func (h *WalletHandler) Withdraw(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-		return
-	}
-
-	var req models.WalletWithdrawRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	err := h.walletService.Withdraw(userID.(int), req.Currency, req.Amount, "Manual withdrawal")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "Withdrawal successful"})
-}
-
 func (h *WalletHandler) GetHistory(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -108,4 +63,19 @@ func (h *WalletHandler) GetHistory(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{"transactions": transactions})
-}
\ No newline at end of file
+}
+func (h *WalletHandler) GetHolds(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	holds, err := h.walletService.GetHolds(userID.(int), c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"holds": holds})
+}
@@ -16,4 +16,8 @@ func NewWebSocketHandler(hub *websocket.Hub) *WebSocketHandler {
 
 func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 	h.hub.ServeWS(c.Writer, c.Request)
-}
\ No newline at end of file
+}
+
+func (h *WebSocketHandler) HandleStream(c *gin.Context) {
+	h.hub.ServeSSE(c.Writer, c.Request)
+}
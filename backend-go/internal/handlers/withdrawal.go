@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"bdpayx-backend/internal/models"
+	"bdpayx-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WithdrawalHandler struct {
+	withdrawalService *services.WithdrawalService
+}
+
+func NewWithdrawalHandler(withdrawalService *services.WithdrawalService) *WithdrawalHandler {
+	return &WithdrawalHandler{withdrawalService: withdrawalService}
+}
+
+// CreateWithdrawal files a payout request. Nothing is paid yet; the amount is
+// held until an admin processes the request.
+func (h *WithdrawalHandler) CreateWithdrawal(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.WalletWithdrawRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	withdrawal, err := h.withdrawalService.CreateWithdrawal(userID.(int), req)
+	if err != nil {
+		c.JSON(withdrawalErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, withdrawal)
+}
+
+func (h *WithdrawalHandler) GetUserWithdrawals(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	limit, offset := pagination(c, 20)
+	withdrawals, err := h.withdrawalService.GetUserWithdrawals(userID.(int), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"withdrawals": withdrawals})
+}
+
+func (h *WithdrawalHandler) CancelWithdrawal(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	withdrawalID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid withdrawal ID"})
+		return
+	}
+
+	withdrawal, err := h.withdrawalService.CancelWithdrawal(userID.(int), withdrawalID)
+	if err != nil {
+		c.JSON(withdrawalErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, withdrawal)
+}
+
+func (h *WithdrawalHandler) GetWithdrawals(c *gin.Context) {
+	limit, offset := pagination(c, 50)
+	withdrawals, err := h.withdrawalService.GetWithdrawals(c.Query("status"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"withdrawals": withdrawals})
+}
+
+func (h *WithdrawalHandler) ApproveWithdrawal(c *gin.Context) {
+	withdrawalID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid withdrawal ID"})
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	withdrawal, err := h.withdrawalService.ApproveWithdrawal(withdrawalID, adminID.(int))
+	if err != nil {
+		c.JSON(withdrawalErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, withdrawal)
+}
+
+func (h *WithdrawalHandler) MarkWithdrawalPaid(c *gin.Context) {
+	withdrawalID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid withdrawal ID"})
+		return
+	}
+
+	var req models.PayoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	withdrawal, err := h.withdrawalService.MarkWithdrawalPaid(withdrawalID, adminID.(int), req.Reference)
+	if err != nil {
+		c.JSON(withdrawalErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, withdrawal)
+}
+
+func (h *WithdrawalHandler) RejectWithdrawal(c *gin.Context) {
+	withdrawalID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid withdrawal ID"})
+		return
+	}
+
+	var req models.RejectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	withdrawal, err := h.withdrawalService.RejectWithdrawal(withdrawalID, adminID.(int), req.Reason)
+	if err != nil {
+		c.JSON(withdrawalErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, withdrawal)
+}
+
+func withdrawalErrorStatus(err error, fallback int) int {
+	switch {
+	case errors.Is(err, services.ErrWithdrawalNotFound), errors.Is(err, services.ErrWalletNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrWithdrawalNotAllowed), errors.Is(err, services.ErrHoldNotActive):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrInvalidDestination), errors.Is(err, services.ErrInsufficientFunds):
+		return http.StatusBadRequest
+	default:
+		return fallback
+	}
+}
+
+// pagination reads the limit and offset query parameters.
+func pagination(c *gin.Context, defaultLimit int) (int, int) {
+	limit := defaultLimit
+	offset := 0
+
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
+			limit = parsed
+		}
+	}
+
+	if o := c.Query("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+
+	return limit, offset
+}
@@ -0,0 +1,261 @@
+package ledger
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+
+	"bdpayx-backend/internal/money"
+)
+
+// Account types
+const (
+	AccountUserWallet = "user_wallet"
+	AccountUserHeld   = "user_held"
+	AccountPlatform   = "platform"
+)
+
+// Platform accounts that sit on the other side of user movements
+const (
+	PlatformCash    = "cash"
+	PlatformOpening = "opening"
+	// PlatformFX takes the sold currency and pays out the bought one when an
+	// exchange is settled.
+	PlatformFX = "fx"
+)
+
+var ErrUnbalanced = errors.New("journal entry does not balance")
+
+// InsufficientFundsError is returned when a posting would take an account
+// that does not allow overdrafts below zero.
+type InsufficientFundsError struct {
+	AccountCode string
+	Currency    string
+	Balance     money.Decimal
+	Amount      money.Decimal
+}
+
+func (e *InsufficientFundsError) Error() string {
+	return fmt.Sprintf("insufficient balance in %s: have %s %s, need %s %s",
+		e.AccountCode, e.Balance, e.Currency, e.Amount, e.Currency)
+}
+
+type Account struct {
+	ID            int
+	Code          string
+	UserID        sql.NullInt64
+	Type          string
+	Currency      string
+	Balance       money.Decimal
+	AllowNegative bool
+}
+
+// Posting moves Amount into (positive) or out of (negative) an account. The
+// postings of an entry must sum to zero per currency.
+type Posting struct {
+	AccountID int
+	Amount    money.Decimal
+}
+
+type Entry struct {
+	Kind        string
+	Reference   string
+	Description string
+	Postings    []Posting
+}
+
+// Result carries the journal entry ID and the balance of every touched
+// account after the entry was applied.
+type Result struct {
+	EntryID  int
+	Balances map[int]money.Decimal
+}
+
+type Ledger struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) *Ledger {
+	return &Ledger{db: db}
+}
+
+// UserAccount returns the wallet account of a user in the given currency,
+// creating it on first use.
+func (l *Ledger) UserAccount(tx *sql.Tx, userID int, currency string) (*Account, error) {
+	code := fmt.Sprintf("user:%d:%s", userID, currency)
+	return l.account(tx, code, sql.NullInt64{Int64: int64(userID), Valid: true}, AccountUserWallet, currency, false)
+}
+
+// HeldAccount returns the account holding a user's reserved funds in the given
+// currency, creating it on first use. Reserved funds belong to the user but
+// cannot be spent from the wallet.
+func (l *Ledger) HeldAccount(tx *sql.Tx, userID int, currency string) (*Account, error) {
+	code := fmt.Sprintf("user:%d:%s:held", userID, currency)
+	return l.account(tx, code, sql.NullInt64{Int64: int64(userID), Valid: true}, AccountUserHeld, currency, false)
+}
+
+// PlatformAccount returns one of our own accounts in the given currency,
+// creating it on first use. Platform accounts may go negative.
+func (l *Ledger) PlatformAccount(tx *sql.Tx, name, currency string) (*Account, error) {
+	code := fmt.Sprintf("platform:%s:%s", name, currency)
+	return l.account(tx, code, sql.NullInt64{}, AccountPlatform, currency, true)
+}
+
+func (l *Ledger) account(tx *sql.Tx, code string, userID sql.NullInt64, accountType, currency string, allowNegative bool) (*Account, error) {
+	_, err := tx.Exec(`
+		INSERT INTO ledger_accounts (code, user_id, type, currency, allow_negative, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT (code) DO NOTHING`,
+		code, userID, accountType, currency, allowNegative)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ledger account %s: %w", code, err)
+	}
+
+	var account Account
+	err = tx.QueryRow(`
+		SELECT id, code, user_id, type, currency, balance, allow_negative
+		FROM ledger_accounts WHERE code = $1`, code).Scan(
+		&account.ID, &account.Code, &account.UserID, &account.Type,
+		&account.Currency, &account.Balance, &account.AllowNegative)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ledger account %s: %w", code, err)
+	}
+	return &account, nil
+}
+
+// Post validates and applies a journal entry inside tx. Touched accounts are
+// locked in ID order so concurrent entries cannot interleave their
+// balance_after chains.
+func (l *Ledger) Post(tx *sql.Tx, e Entry) (*Result, error) {
+	return l.post(tx, e, false)
+}
+
+func (l *Ledger) post(tx *sql.Tx, e Entry, allowOverdraft bool) (*Result, error) {
+	if len(e.Postings) < 2 {
+		return nil, fmt.Errorf("%w: at least two postings required", ErrUnbalanced)
+	}
+
+	ids := make([]int, 0, len(e.Postings))
+	seen := make(map[int]bool)
+	for _, p := range e.Postings {
+		if p.Amount.IsZero() {
+			return nil, fmt.Errorf("%w: zero amount posting", ErrUnbalanced)
+		}
+		if !seen[p.AccountID] {
+			seen[p.AccountID] = true
+			ids = append(ids, p.AccountID)
+		}
+	}
+	sort.Ints(ids)
+
+	accounts := make(map[int]*Account, len(ids))
+	for _, id := range ids {
+		var account Account
+		err := tx.QueryRow(`
+			SELECT id, code, currency, balance, allow_negative
+			FROM ledger_accounts WHERE id = $1 FOR UPDATE`, id).Scan(
+			&account.ID, &account.Code, &account.Currency, &account.Balance, &account.AllowNegative)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock ledger account %d: %w", id, err)
+		}
+		accounts[id] = &account
+	}
+
+	// Every currency must net to zero
+	sums := make(map[string]money.Decimal)
+	for _, p := range e.Postings {
+		currency := accounts[p.AccountID].Currency
+		sums[currency] = sums[currency].Add(p.Amount)
+	}
+	for currency, sum := range sums {
+		if !sum.IsZero() {
+			return nil, fmt.Errorf("%w: %s postings sum to %s", ErrUnbalanced, currency, sum)
+		}
+	}
+
+	balances := make(map[int]money.Decimal, len(ids))
+	for _, id := range ids {
+		balances[id] = accounts[id].Balance
+	}
+	for _, p := range e.Postings {
+		balances[p.AccountID] = balances[p.AccountID].Add(p.Amount)
+	}
+
+	// Accounts that are debited overall may not end up below zero
+	for _, id := range ids {
+		account := accounts[id]
+		change := balances[id].Sub(account.Balance)
+		if change.IsNegative() && balances[id].IsNegative() && !account.AllowNegative && !allowOverdraft {
+			return nil, &InsufficientFundsError{
+				AccountCode: account.Code,
+				Currency:    account.Currency,
+				Balance:     account.Balance,
+				Amount:      change.Neg(),
+			}
+		}
+	}
+
+	var entryID int
+	err := tx.QueryRow(`
+		INSERT INTO journal_entries (kind, reference, description, created_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+		RETURNING id`,
+		e.Kind, e.Reference, e.Description).Scan(&entryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create journal entry: %w", err)
+	}
+
+	running := make(map[int]money.Decimal, len(ids))
+	for _, id := range ids {
+		running[id] = accounts[id].Balance
+	}
+	for _, p := range e.Postings {
+		running[p.AccountID] = running[p.AccountID].Add(p.Amount)
+		_, err := tx.Exec(`
+			INSERT INTO ledger_postings (entry_id, account_id, currency, amount, balance_after, created_at)
+			VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)`,
+			entryID, p.AccountID, accounts[p.AccountID].Currency,
+			p.Amount, running[p.AccountID])
+		if err != nil {
+			return nil, fmt.Errorf("failed to record posting: %w", err)
+		}
+	}
+
+	for _, id := range ids {
+		_, err := tx.Exec(`
+			UPDATE ledger_accounts
+			SET balance = $1, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $2`,
+			balances[id], id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update ledger account %d: %w", id, err)
+		}
+	}
+
+	return &Result{EntryID: entryID, Balances: balances}, nil
+}
+
+// UserBalances returns the balances of a user's accounts of one type, such as
+// AccountUserWallet or AccountUserHeld, keyed by currency.
+func (l *Ledger) UserBalances(userID int, accountType string) (map[string]money.Decimal, error) {
+	rows, err := l.db.Query(`
+		SELECT currency, balance FROM ledger_accounts
+		WHERE user_id = $1 AND type = $2`,
+		userID, accountType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user balances: %w", err)
+	}
+	defer rows.Close()
+
+	balances := make(map[string]money.Decimal)
+	for rows.Next() {
+		var currency string
+		var balance money.Decimal
+		if err := rows.Scan(&currency, &balance); err != nil {
+			return nil, fmt.Errorf("failed to scan user balance: %w", err)
+		}
+		balances[currency] = balance
+	}
+	return balances, rows.Err()
+}
@@ -0,0 +1,228 @@
+package ledger
+
+import (
+	"fmt"
+	"log"
+
+	"bdpayx-backend/internal/money"
+)
+
+type UnbalancedEntry struct {
+	EntryID  int           `json:"entry_id"`
+	Currency string        `json:"currency"`
+	Sum      money.Decimal `json:"sum"`
+}
+
+type BrokenChain struct {
+	AccountID int           `json:"account_id"`
+	PostingID int           `json:"posting_id"`
+	Expected  money.Decimal `json:"expected_balance_after"`
+	Actual    money.Decimal `json:"actual_balance_after"`
+}
+
+type AccountMismatch struct {
+	AccountID int           `json:"account_id"`
+	Code      string        `json:"code"`
+	Balance   money.Decimal `json:"balance"`
+	Postings  money.Decimal `json:"postings_total"`
+}
+
+// Report is the outcome of a full ledger consistency check.
+type Report struct {
+	Consistent        bool                     `json:"consistent"`
+	Entries           int                      `json:"entries"`
+	Postings          int                      `json:"postings"`
+	TrialBalance      map[string]money.Decimal `json:"trial_balance"`
+	UnbalancedEntries []UnbalancedEntry        `json:"unbalanced_entries"`
+	BrokenChains      []BrokenChain            `json:"broken_chains"`
+	AccountMismatches []AccountMismatch        `json:"account_mismatches"`
+}
+
+// Verify proves that every entry balances, every account's balance_after
+// chain is unbroken and every cached account balance equals its postings.
+func (l *Ledger) Verify() (*Report, error) {
+	report := &Report{
+		TrialBalance:      make(map[string]money.Decimal),
+		UnbalancedEntries: []UnbalancedEntry{},
+		BrokenChains:      []BrokenChain{},
+		AccountMismatches: []AccountMismatch{},
+	}
+
+	err := l.db.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM journal_entries), (SELECT COUNT(*) FROM ledger_postings)`).Scan(
+		&report.Entries, &report.Postings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count ledger rows: %w", err)
+	}
+
+	// Entries whose postings do not net to zero
+	rows, err := l.db.Query(`
+		SELECT entry_id, currency, SUM(amount)
+		FROM ledger_postings
+		GROUP BY entry_id, currency
+		HAVING SUM(amount) <> 0
+		ORDER BY entry_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check entry balances: %w", err)
+	}
+	for rows.Next() {
+		var u UnbalancedEntry
+		if err := rows.Scan(&u.EntryID, &u.Currency, &u.Sum); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan unbalanced entry: %w", err)
+		}
+		report.UnbalancedEntries = append(report.UnbalancedEntries, u)
+	}
+	rows.Close()
+
+	// Postings whose balance_after does not follow from the previous one
+	rows, err = l.db.Query(`
+		SELECT account_id, id, expected, balance_after
+		FROM (
+			SELECT account_id, id, balance_after,
+				COALESCE(LAG(balance_after) OVER (PARTITION BY account_id ORDER BY id), 0) + amount AS expected
+			FROM ledger_postings
+		) chain
+		WHERE balance_after <> expected
+		ORDER BY account_id, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check balance chains: %w", err)
+	}
+	for rows.Next() {
+		var b BrokenChain
+		if err := rows.Scan(&b.AccountID, &b.PostingID, &b.Expected, &b.Actual); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan broken chain: %w", err)
+		}
+		report.BrokenChains = append(report.BrokenChains, b)
+	}
+	rows.Close()
+
+	// Cached balances that drifted from the postings
+	rows, err = l.db.Query(`
+		SELECT a.id, a.code, a.balance, COALESCE(SUM(p.amount), 0)
+		FROM ledger_accounts a
+		LEFT JOIN ledger_postings p ON p.account_id = a.id
+		GROUP BY a.id, a.code, a.balance
+		HAVING a.balance <> COALESCE(SUM(p.amount), 0)
+		ORDER BY a.id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check account balances: %w", err)
+	}
+	for rows.Next() {
+		var m AccountMismatch
+		if err := rows.Scan(&m.AccountID, &m.Code, &m.Balance, &m.Postings); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan account mismatch: %w", err)
+		}
+		report.AccountMismatches = append(report.AccountMismatches, m)
+	}
+	rows.Close()
+
+	// Across all accounts each currency must net to zero
+	rows, err = l.db.Query(`
+		SELECT currency, SUM(balance) FROM ledger_accounts GROUP BY currency ORDER BY currency`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trial balance: %w", err)
+	}
+	trialBalanced := true
+	for rows.Next() {
+		var currency string
+		var sum money.Decimal
+		if err := rows.Scan(&currency, &sum); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan trial balance: %w", err)
+		}
+		report.TrialBalance[currency] = sum
+		if !sum.IsZero() {
+			trialBalanced = false
+		}
+	}
+	rows.Close()
+
+	report.Consistent = trialBalanced &&
+		len(report.UnbalancedEntries) == 0 &&
+		len(report.BrokenChains) == 0 &&
+		len(report.AccountMismatches) == 0
+
+	return report, nil
+}
+
+// ImportWalletBalances moves balances still held in the legacy
+// wallets.bdt_balance/inr_balance columns into the ledger as opening entries.
+// Wallets that already have a ledger account for a currency are skipped, so
+// the import is safe to run on every start.
+func (l *Ledger) ImportWalletBalances() error {
+	rows, err := l.db.Query(`
+		SELECT w.user_id, c.currency, c.balance
+		FROM wallets w
+		CROSS JOIN LATERAL (VALUES ('BDT', w.bdt_balance), ('INR', w.inr_balance)) AS c(currency, balance)
+		WHERE c.balance <> 0
+		AND NOT EXISTS (
+			SELECT 1 FROM ledger_accounts a
+			WHERE a.user_id = w.user_id AND a.type = $1 AND a.currency = c.currency
+		)`, AccountUserWallet)
+	if err != nil {
+		return fmt.Errorf("failed to find legacy wallet balances: %w", err)
+	}
+
+	type opening struct {
+		userID   int
+		currency string
+		amount   money.Decimal
+	}
+	var openings []opening
+	for rows.Next() {
+		var o opening
+		if err := rows.Scan(&o.userID, &o.currency, &o.amount); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan legacy wallet balance: %w", err)
+		}
+		openings = append(openings, o)
+	}
+	rows.Close()
+
+	for _, o := range openings {
+		if err := l.openBalance(o.userID, o.currency, o.amount); err != nil {
+			return err
+		}
+	}
+
+	if len(openings) > 0 {
+		log.Printf("✅ Imported %d legacy wallet balances into the ledger", len(openings))
+	}
+	return nil
+}
+
+func (l *Ledger) openBalance(userID int, currency string, amount money.Decimal) error {
+	tx, err := l.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	user, err := l.UserAccount(tx, userID, currency)
+	if err != nil {
+		return err
+	}
+	opening, err := l.PlatformAccount(tx, PlatformOpening, currency)
+	if err != nil {
+		return err
+	}
+
+	// Overdrawn legacy wallets are carried over as they are
+	_, err = l.post(tx, Entry{
+		Kind:        "opening_balance",
+		Reference:   fmt.Sprintf("wallet:%d", userID),
+		Description: "Opening balance imported from wallets table",
+		Postings: []Posting{
+			{AccountID: user.ID, Amount: amount},
+			{AccountID: opening.ID, Amount: amount.Neg()},
+		},
+	}, true)
+	if err != nil {
+		return fmt.Errorf("failed to import opening balance for user %d: %w", userID, err)
+	}
+
+	return tx.Commit()
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
@@ -9,12 +10,61 @@ import (
 )
 
 type Claims struct {
-	UserID  int  `json:"user_id"`
-	IsAdmin bool `json:"is_admin"`
+	UserID    int    `json:"user_id"`
+	IsAdmin   bool   `json:"is_admin"`
+	SessionID string `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
+var (
+	ErrInvalidToken  = errors.New("Invalid token")
+	ErrInvalidClaims = errors.New("Invalid token claims")
+	ErrTokenRevoked  = errors.New("Token revoked")
+)
+
+// Revocations lists the sessions signed out before their access tokens
+// expired.
+type Revocations interface {
+	IsRevoked(sessionID string) bool
+}
+
+// TokenParser verifies access tokens. Everything that accepts tokens, not
+// only AuthMiddleware, goes through it.
+type TokenParser struct {
+	jwtSecret   string
+	revocations Revocations
+}
+
+func NewTokenParser(jwtSecret string, revocations Revocations) *TokenParser {
+	return &TokenParser{
+		jwtSecret:   jwtSecret,
+		revocations: revocations,
+	}
+}
+
+// Parse checks an access token's signature and expiry and that its session
+// is still open, and returns its claims.
+func (p *TokenParser) Parse(tokenString string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		return []byte(p.jwtSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	claims, ok := token.Claims.(*Claims)
+	// Tokens from before sessions existed cannot be revoked, so they are
+	// not accepted either
+	if !ok || claims.SessionID == "" {
+		return nil, ErrInvalidClaims
+	}
+	if p.revocations.IsRevoked(claims.SessionID) {
+		return nil, ErrTokenRevoked
+	}
+	return claims, nil
+}
+
+func AuthMiddleware(tokens *TokenParser) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -30,29 +80,33 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 			return
 		}
 
-		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(jwtSecret), nil
-		})
-
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			c.Abort()
-			return
-		}
-
-		claims, ok := token.Claims.(*Claims)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		claims, err := tokens.Parse(tokenString)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			c.Abort()
 			return
 		}
 
 		c.Set("user_id", claims.UserID)
 		c.Set("is_admin", claims.IsAdmin)
+		c.Set("session_id", claims.SessionID)
 		c.Next()
 	}
 }
 
+// OptionalAuthMiddleware authenticates requests that carry an Authorization
+// header and lets anonymous ones through without a user_id.
+func OptionalAuthMiddleware(tokens *TokenParser) gin.HandlerFunc {
+	auth := AuthMiddleware(tokens)
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			c.Next()
+			return
+		}
+		auth(c)
+	}
+}
+
 func AdminMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		isAdmin, exists := c.Get("is_admin")
@@ -0,0 +1,205 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"bdpayx-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// memoryIdempotencyStore keeps records in a map, like the Redis and
+// Postgres stores do per user and key.
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*models.IdempotencyRecord
+}
+
+func newMemoryIdempotencyStore() *memoryIdempotencyStore {
+	return &memoryIdempotencyStore{records: make(map[string]*models.IdempotencyRecord)}
+}
+
+func storeKey(userID int, key string) string {
+	return fmt.Sprintf("%d:%s", userID, key)
+}
+
+func (s *memoryIdempotencyStore) Reserve(userID int, key, requestHash string) (*models.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if record, ok := s.records[storeKey(userID, key)]; ok {
+		copied := *record
+		return &copied, nil
+	}
+	s.records[storeKey(userID, key)] = &models.IdempotencyRecord{RequestHash: requestHash}
+	return nil, nil
+}
+
+func (s *memoryIdempotencyStore) Complete(userID int, key, requestHash string, statusCode int, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[storeKey(userID, key)] = &models.IdempotencyRecord{
+		RequestHash: requestHash, Completed: true, StatusCode: statusCode, Body: body,
+	}
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(userID int, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, storeKey(userID, key))
+	return nil
+}
+
+func (s *memoryIdempotencyStore) has(userID int, key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.records[storeKey(userID, key)]
+	return ok
+}
+
+// idempotentRouter serves POST /orders for user 1 through the middleware.
+// The handler answers with status and counts its calls.
+func idempotentRouter(store IdempotencyStore, status *int, calls *int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/orders", func(c *gin.Context) {
+		c.Set("user_id", 1)
+	}, IdempotencyMiddleware(store), func(c *gin.Context) {
+		*calls++
+		c.JSON(*status, gin.H{"order": *calls})
+	})
+	return router
+}
+
+func postOrder(router *gin.Engine, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyReplaysStoredResponse(t *testing.T) {
+	status, calls := http.StatusCreated, 0
+	router := idempotentRouter(newMemoryIdempotencyStore(), &status, &calls)
+
+	first := postOrder(router, "key-1", `{"amount": "100"}`)
+	second := postOrder(router, "key-1", `{"amount": "100"}`)
+
+	if calls != 1 {
+		t.Fatalf("handler ran %d times, want once", calls)
+	}
+	if second.Code != http.StatusCreated || second.Body.String() != first.Body.String() {
+		t.Errorf("replay = %d %s, want %d %s", second.Code, second.Body, first.Code, first.Body)
+	}
+	if second.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Error("replay not marked")
+	}
+	if first.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Error("first response marked as replayed")
+	}
+
+	// Without a key every request runs
+	postOrder(router, "", `{"amount": "100"}`)
+	postOrder(router, "", `{"amount": "100"}`)
+	if calls != 3 {
+		t.Errorf("handler ran %d times, want 3", calls)
+	}
+}
+
+func TestIdempotencyRejectsDifferentRequest(t *testing.T) {
+	status, calls := http.StatusCreated, 0
+	router := idempotentRouter(newMemoryIdempotencyStore(), &status, &calls)
+
+	postOrder(router, "key-1", `{"amount": "100"}`)
+	w := postOrder(router, "key-1", `{"amount": "200"}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status %d, want 422", w.Code)
+	}
+	if calls != 1 {
+		t.Errorf("handler ran %d times, want once", calls)
+	}
+}
+
+func TestIdempotencyRejectsInFlightKey(t *testing.T) {
+	store := newMemoryIdempotencyStore()
+	status, calls := http.StatusCreated, 0
+	router := idempotentRouter(store, &status, &calls)
+
+	// The first request is still running: reserved, not completed
+	body := `{"amount": "100"}`
+	postOrder(router, "key-1", body)
+	store.mu.Lock()
+	store.records[storeKey(1, "key-1")].Completed = false
+	store.mu.Unlock()
+
+	w := postOrder(router, "key-1", body)
+	if w.Code != http.StatusConflict {
+		t.Errorf("status %d, want 409", w.Code)
+	}
+	if calls != 1 {
+		t.Errorf("handler ran %d times, want once", calls)
+	}
+}
+
+func TestIdempotencyReleasesKeyAfterServerError(t *testing.T) {
+	store := newMemoryIdempotencyStore()
+	status, calls := http.StatusInternalServerError, 0
+	router := idempotentRouter(store, &status, &calls)
+
+	if w := postOrder(router, "key-1", `{}`); w.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d, want 500", w.Code)
+	}
+	if store.has(1, "key-1") {
+		t.Fatal("key still reserved after a server error")
+	}
+
+	status = http.StatusCreated
+	if w := postOrder(router, "key-1", `{}`); w.Code != http.StatusCreated || calls != 2 {
+		t.Errorf("retry = %d after %d calls, want it to run again", w.Code, calls)
+	}
+
+	// Client errors are stored like successes
+	status = http.StatusBadRequest
+	postOrder(router, "key-2", `{}`)
+	postOrder(router, "key-2", `{}`)
+	if calls != 3 {
+		t.Errorf("handler ran %d times, want a 4xx replayed", calls)
+	}
+}
+
+func TestIdempotencyReleasesKeyAfterPanic(t *testing.T) {
+	store := newMemoryIdempotencyStore()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.POST("/orders", func(c *gin.Context) {
+		c.Set("user_id", 1)
+	}, IdempotencyMiddleware(store), func(c *gin.Context) {
+		panic("boom")
+	})
+
+	if w := postOrder(router, "key-1", `{}`); w.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d, want 500", w.Code)
+	}
+	if store.has(1, "key-1") {
+		t.Error("key still reserved after a panic")
+	}
+}
+
+func TestIdempotencyKeyTooLong(t *testing.T) {
+	status, calls := http.StatusCreated, 0
+	router := idempotentRouter(newMemoryIdempotencyStore(), &status, &calls)
+
+	w := postOrder(router, strings.Repeat("k", maxIdempotencyKeyLength+1), `{}`)
+	if w.Code != http.StatusBadRequest || calls != 0 {
+		t.Errorf("status %d after %d calls, want 400 without running", w.Code, calls)
+	}
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebhookAuthMiddleware guards machine-to-machine endpoints with a shared
+// secret sent in the X-API-Key header. With no secret configured the
+// endpoint is disabled rather than left open.
+func WebhookAuthMiddleware(secret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if secret == "" {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Webhook is not configured"})
+			c.Abort()
+			return
+		}
+
+		key := c.GetHeader("X-API-Key")
+		if subtle.ConstantTimeCompare([]byte(key), []byte(secret)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+
+	"bdpayx-backend/internal/money"
 )
 
 type User struct {
@@ -17,49 +19,372 @@ type User struct {
 	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// Currency is an entry of the currency registry. Amounts are kept with
+// Decimals minor-unit places. Disabled currencies are refused in requests,
+// but balances still held in them stay visible.
+type Currency struct {
+	Code      string    `json:"code" db:"code"`
+	Name      string    `json:"name" db:"name"`
+	Symbol    string    `json:"symbol" db:"symbol"`
+	Decimals  int32     `json:"decimals" db:"decimals"`
+	Enabled   bool      `json:"enabled" db:"enabled"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// ExchangeRate is the market rate of a pair. Source names the rate provider
+// or "admin" that set it last; Stale is set once it has not been refreshed
+// within RATE_STALE_AFTER. Degraded marks rates from a fallback provider,
+// which turn stale once the primary one has been down that long. Pairs without a stored rate are crossed through
+// the intermediate currency named in Via and have no ID. Mode tells whether
+// the feed moves the rate or an override pins it, and until when;
+// ScheduledAt is the start of the next override.
 type ExchangeRate struct {
-	ID           int       `json:"id" db:"id"`
-	FromCurrency string    `json:"from_currency" db:"from_currency"`
-	ToCurrency   string    `json:"to_currency" db:"to_currency"`
-	Rate         float64   `json:"rate" db:"rate"`
-	Spread       float64   `json:"spread" db:"spread"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+	ID           int           `json:"id" db:"id"`
+	FromCurrency string        `json:"from_currency" db:"from_currency"`
+	ToCurrency   string        `json:"to_currency" db:"to_currency"`
+	Rate         money.Decimal `json:"rate" db:"rate"`
+	Spread       money.Decimal `json:"spread" db:"spread"`
+	Source       string        `json:"source" db:"source"`
+	Via          string        `json:"via,omitempty" db:"-"`
+	Stale        bool          `json:"stale" db:"-"`
+	Degraded     bool          `json:"degraded,omitempty" db:"-"`
+	Mode         string        `json:"mode,omitempty" db:"-"`
+	PinnedUntil  *time.Time    `json:"pinned_until,omitempty" db:"-"`
+	ScheduledAt  *time.Time    `json:"scheduled_at,omitempty" db:"-"`
+	CreatedAt    time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at" db:"updated_at"`
+}
+
+// Rate modes
+const (
+	RateModeAutomatic = "automatic"
+	RateModePinned    = "pinned"
+)
+
+// Override statuses
+const (
+	OverrideScheduled = "scheduled"
+	OverrideActive    = "active"
+	OverrideExpired   = "expired"
+	OverrideCancelled = "cancelled"
+	OverrideSkipped   = "skipped"
+)
+
+// RateOverride pins the rate of a pair from StartsAt until ExpiresAt, or
+// until it is cancelled when there is no expiry. While it is active the
+// feed leaves the pair alone. PreviousSpread is the pair's spread before the
+// override replaced it, restored when the override ends.
+type RateOverride struct {
+	ID             int            `json:"id" db:"id"`
+	FromCurrency   string         `json:"from_currency" db:"from_currency"`
+	ToCurrency     string         `json:"to_currency" db:"to_currency"`
+	Rate           money.Decimal  `json:"rate" db:"rate"`
+	Spread         *money.Decimal `json:"spread,omitempty" db:"spread"`
+	PreviousSpread *money.Decimal `json:"previous_spread,omitempty" db:"previous_spread"`
+	Status         string         `json:"status" db:"status"`
+	Force          bool           `json:"force" db:"force"`
+	StartsAt       time.Time      `json:"starts_at" db:"starts_at"`
+	ExpiresAt      *time.Time     `json:"expires_at,omitempty" db:"expires_at"`
+	Reason         string         `json:"reason,omitempty" db:"reason"`
+	CreatedBy      int            `json:"created_by" db:"created_by"`
+	CancelledBy    *int           `json:"cancelled_by,omitempty" db:"cancelled_by"`
+	CreatedAt      time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+// PricingTier sets spread and fixed fee for sends of a pair between
+// MinAmount (inclusive) and MaxAmount (exclusive, none when nil). Tiers with
+// a Segment only apply to users in that segment and take precedence over
+// tiers without one.
+type PricingTier struct {
+	ID           int            `json:"id" db:"id"`
+	FromCurrency string         `json:"from_currency" db:"from_currency"`
+	ToCurrency   string         `json:"to_currency" db:"to_currency"`
+	Segment      string         `json:"segment,omitempty" db:"segment"`
+	MinAmount    money.Decimal  `json:"min_amount" db:"min_amount"`
+	MaxAmount    *money.Decimal `json:"max_amount,omitempty" db:"max_amount"`
+	Spread       money.Decimal  `json:"spread" db:"spread"`
+	FixedFee     money.Decimal  `json:"fixed_fee" db:"fixed_fee"`
+	CreatedAt    time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+// ArbitrageLoop is a round trip through Currencies, which starts and ends in
+// the same currency, that returns more than it started with after spreads.
+// Return is what one unit comes back as.
+type ArbitrageLoop struct {
+	Currencies []string      `json:"currencies"`
+	Return     money.Decimal `json:"return"`
+}
+
+type ArbitrageReport struct {
+	Consistent bool            `json:"consistent"`
+	Loops      []ArbitrageLoop `json:"loops"`
+	CheckedAt  time.Time       `json:"checked_at"`
+}
+
+// RateTick is one recorded rate change.
+type RateTick struct {
+	FromCurrency string        `json:"from_currency" db:"from_currency"`
+	ToCurrency   string        `json:"to_currency" db:"to_currency"`
+	Rate         money.Decimal `json:"rate" db:"rate"`
+	Source       string        `json:"source" db:"source"`
+	RecordedAt   time.Time     `json:"recorded_at" db:"recorded_at"`
+}
+
+// RateCandle summarises the rate changes of one bucket of an interval
+// (1m, 5m, 1h or 1d) starting at Start.
+type RateCandle struct {
+	FromCurrency string        `json:"from_currency" db:"from_currency"`
+	ToCurrency   string        `json:"to_currency" db:"to_currency"`
+	Interval     string        `json:"interval" db:"period"`
+	Start        time.Time     `json:"start" db:"bucket_start"`
+	Open         money.Decimal `json:"open" db:"open"`
+	High         money.Decimal `json:"high" db:"high"`
+	Low          money.Decimal `json:"low" db:"low"`
+	Close        money.Decimal `json:"close" db:"close"`
+	Ticks        int           `json:"ticks" db:"ticks"`
+}
+
+// SimulatorParams tune the simulated market of a pair. Volatilities are
+// fractions of the base rate per tick. Custom is false while a pair runs on
+// defaults derived from its current rate.
+type SimulatorParams struct {
+	FromCurrency     string          `json:"from_currency" db:"from_currency"`
+	ToCurrency       string          `json:"to_currency" db:"to_currency"`
+	BaseRate         money.Decimal   `json:"base_rate" db:"base_rate"`
+	MinRate          money.Decimal   `json:"min_rate" db:"min_rate"`
+	MaxRate          money.Decimal   `json:"max_rate" db:"max_rate"`
+	BaseVolatility   float64         `json:"base_volatility" db:"base_volatility"`
+	MaxVolatility    float64         `json:"max_volatility" db:"max_volatility"`
+	MeanReversion    float64         `json:"mean_reversion" db:"mean_reversion"`
+	MaxTrendDuration int             `json:"max_trend_duration" db:"max_trend_duration"`
+	Custom           bool            `json:"custom" db:"-"`
+	UpdatedBy        *int            `json:"updated_by,omitempty" db:"updated_by"`
+	UpdatedAt        *time.Time      `json:"updated_at,omitempty" db:"updated_at"`
+	State            *SimulatorState `json:"state,omitempty" db:"-"`
+}
+
+// SimulatorState is the live market of a simulated pair. Trend and momentum
+// run from -1 (bearish) to 1 (bullish).
+type SimulatorState struct {
+	Rate       float64 `json:"rate"`
+	Trend      float64 `json:"trend"`
+	Momentum   float64 `json:"momentum"`
+	Volatility float64 `json:"volatility"`
 }
 
 type Transaction struct {
-	ID           int       `json:"id" db:"id"`
-	UserID       int       `json:"user_id" db:"user_id"`
-	FromCurrency string    `json:"from_currency" db:"from_currency"`
-	ToCurrency   string    `json:"to_currency" db:"to_currency"`
-	FromAmount   float64   `json:"from_amount" db:"from_amount"`
-	ToAmount     float64   `json:"to_amount" db:"to_amount"`
-	ExchangeRate float64   `json:"exchange_rate" db:"exchange_rate"`
-	Status       string    `json:"status" db:"status"`
-	PaymentProof string    `json:"payment_proof,omitempty" db:"payment_proof"`
-	AdminNotes   string    `json:"admin_notes,omitempty" db:"admin_notes"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+	ID            int           `json:"id" db:"id"`
+	UserID        int           `json:"user_id" db:"user_id"`
+	FromCurrency  string        `json:"from_currency" db:"from_currency"`
+	ToCurrency    string        `json:"to_currency" db:"to_currency"`
+	FromAmount    money.Decimal `json:"from_amount" db:"from_amount"`
+	ToAmount      money.Decimal `json:"to_amount" db:"to_amount"`
+	ExchangeRate  money.Decimal `json:"exchange_rate" db:"exchange_rate"`
+	Fee           money.Decimal `json:"fee" db:"fee"`
+	Status        string        `json:"status" db:"status"`
+	FundingSource string        `json:"funding_source" db:"funding_source"`
+	PaymentProof  string        `json:"payment_proof,omitempty" db:"payment_proof"`
+	AdminNotes    string        `json:"admin_notes,omitempty" db:"admin_notes"`
+	CreatedAt     time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time     `json:"updated_at" db:"updated_at"`
+}
+
+// Transaction statuses. See services.transactionTransitions for the allowed
+// moves between them.
+const (
+	TransactionPending          = "pending"
+	TransactionAwaitingPayment  = "awaiting_payment"
+	TransactionPaymentSubmitted = "payment_submitted"
+	TransactionVerifying        = "verifying"
+	TransactionCompleted        = "completed"
+	TransactionRejected         = "rejected"
+	TransactionCancelled        = "cancelled"
+	TransactionExpired          = "expired"
+	TransactionRefunded         = "refunded"
+)
+
+// Funding sources of a transaction. Wallet funded orders reserve the from
+// amount when placed and are settled into the wallet on completion.
+const (
+	FundingExternal = "external"
+	FundingWallet   = "wallet"
+)
+
+// TransactionEvent is one audited status change of a transaction. FromStatus
+// is empty for the event that records the order being placed.
+type TransactionEvent struct {
+	ID            int       `json:"id" db:"id"`
+	TransactionID int       `json:"transaction_id" db:"transaction_id"`
+	FromStatus    string    `json:"from_status,omitempty" db:"from_status"`
+	ToStatus      string    `json:"to_status" db:"to_status"`
+	ActorRole     string    `json:"actor_role" db:"actor_role"`
+	ActorID       *int      `json:"actor_id,omitempty" db:"actor_id"`
+	Reason        string    `json:"reason,omitempty" db:"reason"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
 }
 
+// Wallet holds one balance per currency. Balances are ledger accounts, so a
+// currency added to the registry needs no schema change.
 type Wallet struct {
-	ID         int       `json:"id" db:"id"`
-	UserID     int       `json:"user_id" db:"user_id"`
-	BDTBalance float64   `json:"bdt_balance" db:"bdt_balance"`
-	INRBalance float64   `json:"inr_balance" db:"inr_balance"`
-	CreatedAt  time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+	ID        int       `json:"id" db:"id"`
+	UserID    int       `json:"user_id" db:"user_id"`
+	Version   int       `json:"version" db:"version"`
+	Balances  []Balance `json:"balances"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Balance is a wallet's position in one currency. Balance is the total
+// owned; HeldBalance of it is reserved by active holds and cannot be spent.
+type Balance struct {
+	Currency         string        `json:"currency"`
+	Balance          money.Decimal `json:"balance"`
+	AvailableBalance money.Decimal `json:"available_balance"`
+	HeldBalance      money.Decimal `json:"held_balance"`
+}
+
+// Hold statuses
+const (
+	HoldActive   = "active"
+	HoldCaptured = "captured"
+	HoldReleased = "released"
+	HoldExpired  = "expired"
+)
+
+// WalletHold reserves part of a wallet balance for a pending operation such
+// as a withdrawal or an exchange paid from the wallet.
+type WalletHold struct {
+	ID          int           `json:"id" db:"id"`
+	UserID      int           `json:"user_id" db:"user_id"`
+	Currency    string        `json:"currency" db:"currency"`
+	Amount      money.Decimal `json:"amount" db:"amount"`
+	Status      string        `json:"status" db:"status"`
+	Reference   string        `json:"reference" db:"reference"`
+	Description string        `json:"description,omitempty" db:"description"`
+	ExpiresAt   *time.Time    `json:"expires_at,omitempty" db:"expires_at"`
+	CreatedAt   time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at" db:"updated_at"`
+}
+
+// Payout methods
+const (
+	PayoutBkash  = "bkash"
+	PayoutNagad  = "nagad"
+	PayoutRocket = "rocket"
+	PayoutBank   = "bank"
+	PayoutUPI    = "upi"
+)
+
+// Withdrawal statuses
+const (
+	WithdrawalPending   = "pending"
+	WithdrawalApproved  = "approved"
+	WithdrawalPaid      = "paid"
+	WithdrawalFailed    = "failed"
+	WithdrawalCancelled = "cancelled"
+)
+
+// WithdrawalRequest is a payout the user asked for. The amount stays on hold
+// in the wallet until an admin marks it paid, or is released if the request
+// fails or is cancelled.
+type WithdrawalRequest struct {
+	ID              int           `json:"id" db:"id"`
+	UserID          int           `json:"user_id" db:"user_id"`
+	Currency        string        `json:"currency" db:"currency"`
+	Amount          money.Decimal `json:"amount" db:"amount"`
+	Method          string        `json:"method" db:"method"`
+	AccountName     string        `json:"account_name,omitempty" db:"account_name"`
+	AccountNumber   string        `json:"account_number,omitempty" db:"account_number"`
+	BankName        string        `json:"bank_name,omitempty" db:"bank_name"`
+	IFSC            string        `json:"ifsc,omitempty" db:"ifsc"`
+	UPIID           string        `json:"upi_id,omitempty" db:"upi_id"`
+	Status          string        `json:"status" db:"status"`
+	HoldID          int           `json:"hold_id" db:"hold_id"`
+	PayoutReference string        `json:"payout_reference,omitempty" db:"payout_reference"`
+	FailureReason   string        `json:"failure_reason,omitempty" db:"failure_reason"`
+	ProcessedBy     *int          `json:"processed_by,omitempty" db:"processed_by"`
+	CreatedAt       time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time     `json:"updated_at" db:"updated_at"`
+}
+
+// Deposit statuses
+const (
+	DepositPending   = "pending"
+	DepositSubmitted = "submitted"
+	DepositApproved  = "approved"
+	DepositRejected  = "rejected"
+	DepositCancelled = "cancelled"
+)
+
+// DepositMethod tells the user where to send money for a deposit.
+type DepositMethod struct {
+	Method       string `json:"method"`
+	Currency     string `json:"currency"`
+	Instructions string `json:"instructions"`
+}
+
+// DepositRequest is a user's declared deposit. The wallet is only credited
+// once an admin has checked the uploaded payment proof and approved it.
+type DepositRequest struct {
+	ID           int           `json:"id" db:"id"`
+	UserID       int           `json:"user_id" db:"user_id"`
+	Reference    string        `json:"reference" db:"reference"`
+	Currency     string        `json:"currency" db:"currency"`
+	Amount       money.Decimal `json:"amount" db:"amount"`
+	Method       string        `json:"method" db:"method"`
+	Instructions string        `json:"instructions" db:"instructions"`
+	Status       string        `json:"status" db:"status"`
+	ProofKey     string        `json:"-" db:"proof_key"`
+	ProofType    string        `json:"-" db:"proof_content_type"`
+	HasProof     bool          `json:"has_proof"`
+	RejectReason string        `json:"reject_reason,omitempty" db:"reject_reason"`
+	ProcessedBy  *int          `json:"processed_by,omitempty" db:"processed_by"`
+	CreatedAt    time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at" db:"updated_at"`
+}
+
+// Incoming payment statuses
+const (
+	PaymentMatched    = "matched"
+	PaymentUnmatched  = "unmatched"
+	PaymentReconciled = "reconciled"
+	PaymentIgnored    = "ignored"
+)
+
+// IncomingPayment is a mobile-money payment reported by a forwarded SMS.
+// Matched and reconciled payments point at the deposit or transaction they
+// paid for.
+type IncomingPayment struct {
+	ID          int           `json:"id" db:"id"`
+	Provider    string        `json:"provider" db:"provider"`
+	TrxID       string        `json:"trx_id" db:"trx_id"`
+	Currency    string        `json:"currency" db:"currency"`
+	Amount      money.Decimal `json:"amount" db:"amount"`
+	Sender      string        `json:"sender,omitempty" db:"sender"`
+	Reference   string        `json:"reference,omitempty" db:"reference"`
+	SMSBody     string        `json:"sms_body" db:"sms_body"`
+	ReceivedAt  time.Time     `json:"received_at" db:"received_at"`
+	Status      string        `json:"status" db:"status"`
+	MatchedType string        `json:"matched_type,omitempty" db:"matched_type"`
+	MatchedID   *int          `json:"matched_id,omitempty" db:"matched_id"`
+	Note        string        `json:"note,omitempty" db:"note"`
+	ResolvedBy  *int          `json:"resolved_by,omitempty" db:"resolved_by"`
+	CreatedAt   time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at" db:"updated_at"`
 }
 
 type WalletTransaction struct {
-	ID              int       `json:"id" db:"id"`
-	WalletID        int       `json:"wallet_id" db:"wallet_id"`
-	TransactionType string    `json:"transaction_type" db:"transaction_type"`
-	Currency        string    `json:"currency" db:"currency"`
-	Amount          float64   `json:"amount" db:"amount"`
-	BalanceAfter    float64   `json:"balance_after" db:"balance_after"`
-	Description     string    `json:"description" db:"description"`
-	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+	ID              int           `json:"id" db:"id"`
+	WalletID        int           `json:"wallet_id" db:"wallet_id"`
+	TransactionType string        `json:"transaction_type" db:"transaction_type"`
+	Currency        string        `json:"currency" db:"currency"`
+	Amount          money.Decimal `json:"amount" db:"amount"`
+	BalanceAfter    money.Decimal `json:"balance_after" db:"balance_after"`
+	Description     string        `json:"description" db:"description"`
+	CreatedAt       time.Time     `json:"created_at" db:"created_at"`
 }
 
 type SupportMessage struct {
@@ -70,6 +395,15 @@ type SupportMessage struct {
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
+// IdempotencyRecord is the stored outcome of the first request made with an
+// Idempotency-Key. Completed is false while that request is still running.
+type IdempotencyRecord struct {
+	RequestHash string `json:"request_hash"`
+	Completed   bool   `json:"completed"`
+	StatusCode  int    `json:"status_code"`
+	Body        []byte `json:"body"`
+}
+
 // Request/Response DTOs
 type RegisterRequest struct {
 	Email    string `json:"email" binding:"required,email"`
@@ -87,43 +421,168 @@ type GoogleAuthRequest struct {
 	Token string `json:"token" binding:"required"`
 }
 
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// AuthResponse carries a short-lived access token, and the refresh token
+// that replaces it once it expires.
 type AuthResponse struct {
-	Token string `json:"token"`
-	User  User   `json:"user"`
+	Token        string    `json:"token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	RefreshToken string    `json:"refresh_token"`
+	User         User      `json:"user"`
 }
 
+// Sides of an exchange calculation: Amount is either what is sent or what
+// should arrive.
+const (
+	SideSend    = "send"
+	SideReceive = "receive"
+)
+
 type ExchangeCalculateRequest struct {
-	FromCurrency string  `json:"from_currency" binding:"required"`
-	ToCurrency   string  `json:"to_currency" binding:"required"`
-	Amount       float64 `json:"amount" binding:"required,gt=0"`
+	FromCurrency string        `json:"from_currency" binding:"required,currency"`
+	ToCurrency   string        `json:"to_currency" binding:"required,currency,nefield=FromCurrency"`
+	Amount       money.Decimal `json:"amount" binding:"required,gt=0"`
+	Side         string        `json:"side" binding:"omitempty,oneof=send receive"`
 }
 
 type ExchangeCalculateResponse struct {
-	FromAmount   float64 `json:"from_amount"`
-	ToAmount     float64 `json:"to_amount"`
-	ExchangeRate float64 `json:"exchange_rate"`
-	Spread       float64 `json:"spread"`
+	Side         string        `json:"side"`
+	FromAmount   money.Decimal `json:"from_amount"`
+	ToAmount     money.Decimal `json:"to_amount"`
+	MarketRate   money.Decimal `json:"market_rate"`
+	ExchangeRate money.Decimal `json:"exchange_rate"`
+	Spread       money.Decimal `json:"spread"`
+	Fees         FeeBreakdown  `json:"fees"`
+	QuoteID      string        `json:"quote_id,omitempty"`
+	ExpiresAt    *time.Time    `json:"expires_at,omitempty"`
 }
 
+// FeeBreakdown shows what an exchange costs. The fixed fee is taken from the
+// sent amount before conversion; the spread cost is the difference between
+// the market rate and the rate applied, in the received currency. TierID is
+// empty when the pair's default spread applied.
+type FeeBreakdown struct {
+	TierID     *int          `json:"tier_id,omitempty"`
+	Segment    string        `json:"segment,omitempty"`
+	FixedFee   money.Decimal `json:"fixed_fee"`
+	NetAmount  money.Decimal `json:"net_amount"`
+	Spread     money.Decimal `json:"spread"`
+	SpreadCost money.Decimal `json:"spread_cost"`
+}
+
+// CreateTransactionRequest only carries a quote from /api/exchange/calculate;
+// currencies, amounts and rate are taken from the quote server-side.
 type CreateTransactionRequest struct {
-	FromCurrency string  `json:"from_currency" binding:"required"`
-	ToCurrency   string  `json:"to_currency" binding:"required"`
-	FromAmount   float64 `json:"from_amount" binding:"required,gt=0"`
-	ToAmount     float64 `json:"to_amount" binding:"required,gt=0"`
-	ExchangeRate float64 `json:"exchange_rate" binding:"required,gt=0"`
+	QuoteID       string `json:"quote_id" binding:"required"`
+	PayFromWallet bool   `json:"pay_from_wallet"`
 }
 
 type UpdateTransactionStatusRequest struct {
 	Status     string `json:"status" binding:"required"`
+	Reason     string `json:"reason"`
 	AdminNotes string `json:"admin_notes"`
 }
 
 type WalletDepositRequest struct {
-	Currency string  `json:"currency" binding:"required"`
-	Amount   float64 `json:"amount" binding:"required,gt=0"`
+	Currency string        `json:"currency" binding:"required,currency"`
+	Amount   money.Decimal `json:"amount" binding:"required,gt=0"`
+	Method   string        `json:"method" binding:"required,oneof=bkash nagad rocket bank upi"`
 }
 
+// WalletWithdrawRequest asks for a payout to a mobile wallet (BDT) or an
+// Indian bank account or UPI ID (INR). Which destination fields are required
+// depends on Method.
 type WalletWithdrawRequest struct {
-	Currency string  `json:"currency" binding:"required"`
-	Amount   float64 `json:"amount" binding:"required,gt=0"`
-}
\ No newline at end of file
+	Currency      string        `json:"currency" binding:"required,currency"`
+	Amount        money.Decimal `json:"amount" binding:"required,gt=0"`
+	Method        string        `json:"method" binding:"required,oneof=bkash nagad rocket bank upi"`
+	AccountName   string        `json:"account_name"`
+	AccountNumber string        `json:"account_number"`
+	BankName      string        `json:"bank_name"`
+	IFSC          string        `json:"ifsc"`
+	UPIID         string        `json:"upi_id"`
+}
+
+type PayoutRequest struct {
+	Reference string `json:"reference" binding:"required"`
+}
+
+// SMSWebhookRequest is what the Android SMS forwarder posts for every
+// message it receives.
+type SMSWebhookRequest struct {
+	Sender    string     `json:"sender" binding:"required"`
+	Body      string     `json:"body" binding:"required"`
+	Timestamp *time.Time `json:"timestamp"`
+}
+
+// ReconcilePaymentRequest assigns an unmatched payment to exactly one deposit
+// request or transaction.
+type ReconcilePaymentRequest struct {
+	DepositID     int    `json:"deposit_id"`
+	TransactionID int    `json:"transaction_id"`
+	Note          string `json:"note"`
+}
+
+type UpdateSimulatorParamsRequest struct {
+	BaseRate         money.Decimal `json:"base_rate" binding:"required,gt=0"`
+	MinRate          money.Decimal `json:"min_rate" binding:"required,gt=0"`
+	MaxRate          money.Decimal `json:"max_rate" binding:"required,gt=0"`
+	BaseVolatility   float64       `json:"base_volatility" binding:"required,gt=0"`
+	MaxVolatility    float64       `json:"max_volatility" binding:"required,gt=0"`
+	MeanReversion    float64       `json:"mean_reversion" binding:"min=0,max=1"`
+	MaxTrendDuration int           `json:"max_trend_duration" binding:"required,min=1"`
+}
+
+type PricingTierRequest struct {
+	FromCurrency string         `json:"from_currency" binding:"required,currency"`
+	ToCurrency   string         `json:"to_currency" binding:"required,currency,nefield=FromCurrency"`
+	Segment      string         `json:"segment" binding:"max=20"`
+	MinAmount    money.Decimal  `json:"min_amount"`
+	MaxAmount    *money.Decimal `json:"max_amount"`
+	Spread       money.Decimal  `json:"spread"`
+	FixedFee     money.Decimal  `json:"fixed_fee"`
+}
+
+// UpdateRateRequest sets the market rate of a pair, adding the pair when it
+// is new. Spread is kept when omitted. Updates that open an arbitrage loop
+// are refused unless Force is set.
+type UpdateRateRequest struct {
+	FromCurrency string         `json:"from_currency" binding:"required,currency"`
+	ToCurrency   string         `json:"to_currency" binding:"required,currency,nefield=FromCurrency"`
+	Rate         money.Decimal  `json:"rate" binding:"required,gt=0"`
+	Spread       *money.Decimal `json:"spread"`
+	Force        bool           `json:"force"`
+}
+
+// RateOverrideRequest pins a pair's rate, from now when StartsAt is empty
+// and for good when ExpiresAt is.
+type RateOverrideRequest struct {
+	FromCurrency string         `json:"from_currency" binding:"required,currency"`
+	ToCurrency   string         `json:"to_currency" binding:"required,currency,nefield=FromCurrency"`
+	Rate         money.Decimal  `json:"rate" binding:"required,gt=0"`
+	Spread       *money.Decimal `json:"spread"`
+	StartsAt     *time.Time     `json:"starts_at"`
+	ExpiresAt    *time.Time     `json:"expires_at"`
+	Reason       string         `json:"reason"`
+	Force        bool           `json:"force"`
+}
+
+// CurrencyRequest adds or changes a currency. Decimals are capped by the
+// DECIMAL(15,2) amount and balance columns.
+type CurrencyRequest struct {
+	Name     string `json:"name" binding:"required,max=50"`
+	Symbol   string `json:"symbol" binding:"required,max=5"`
+	Decimals int32  `json:"decimals" binding:"min=0,max=2"`
+	Enabled  bool   `json:"enabled"`
+}
+
+type UserSegmentRequest struct {
+	Segment string `json:"segment" binding:"max=20"`
+}
+
+type RejectRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
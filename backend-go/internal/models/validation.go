@@ -0,0 +1,33 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+
+	"bdpayx-backend/internal/money"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// RegisterValidators teaches gin's validator about our custom types so that
+// tags such as `binding:"required,gt=0"` work on money.Decimal fields, and
+// adds the `currency` tag, which accepts the codes enabled reports on.
+func RegisterValidators(enabled func(code string) bool) error {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return fmt.Errorf("unexpected validator engine %T", binding.Validator.Engine())
+	}
+
+	// Only the sign matters for these comparisons, so the float is safe here
+	v.RegisterCustomTypeFunc(func(field reflect.Value) interface{} {
+		if d, ok := field.Interface().(money.Decimal); ok {
+			return d.Float64()
+		}
+		return nil
+	}, money.Decimal{})
+
+	return v.RegisterValidation("currency", func(fl validator.FieldLevel) bool {
+		return enabled(fl.Field().String())
+	})
+}
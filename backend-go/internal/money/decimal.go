@@ -0,0 +1,338 @@
+package money
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var ErrDivisionByZero = errors.New("division by zero")
+
+var bigZero = big.NewInt(0)
+
+// Parse refuses inputs beyond these limits, which are far wider than any
+// amount or rate, so that untrusted input cannot make it build huge numbers.
+const (
+	maxDigits   = 40
+	maxExponent = 30
+)
+
+// Decimal is an exact fixed-point number: coef × 10^-scale. The zero value is
+// 0. Decimals are immutable; every operation returns a new value.
+type Decimal struct {
+	coef  *big.Int
+	scale int32
+}
+
+// New returns value × 10^-scale, e.g. New(1234, 2) is 12.34.
+func New(value int64, scale int32) Decimal {
+	return Decimal{coef: big.NewInt(value), scale: scale}
+}
+
+func NewFromInt(value int64) Decimal {
+	return New(value, 0)
+}
+
+// NewFromFloat converts a float to a Decimal with the given number of
+// decimal places. Only use it where the input already is a float, such as
+// simulated rates; amounts should always be parsed from strings.
+func NewFromFloat(value float64, scale int32) Decimal {
+	d, err := Parse(strconv.FormatFloat(value, 'f', int(scale), 64))
+	if err != nil {
+		return Decimal{}
+	}
+	return d
+}
+
+// Parse reads a plain decimal string such as "-1234.50" or "1.5e3". At most
+// maxDigits digits and exponents up to ±maxExponent are accepted.
+func Parse(s string) (Decimal, error) {
+	orig := s
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", orig)
+	}
+
+	var exp int64
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, err := strconv.ParseInt(s[i+1:], 10, 32)
+		if err != nil || e > maxExponent || e < -maxExponent {
+			return Decimal{}, fmt.Errorf("invalid decimal %q", orig)
+		}
+		exp = e
+		s = s[:i]
+	}
+	if s == "" {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", orig)
+	}
+
+	negative := false
+	if s[0] == '+' || s[0] == '-' {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+
+	whole, frac, _ := strings.Cut(s, ".")
+	digits := whole + frac
+	if digits == "" || len(digits) > maxDigits {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", orig)
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return Decimal{}, fmt.Errorf("invalid decimal %q", orig)
+		}
+	}
+
+	coef, _ := new(big.Int).SetString(digits, 10)
+	if negative {
+		coef.Neg(coef)
+	}
+
+	scale := int64(len(frac)) - exp
+	if scale < 0 {
+		coef.Mul(coef, pow10(int32(-scale)))
+		scale = 0
+	}
+	return Decimal{coef: coef, scale: int32(scale)}, nil
+}
+
+// MustParse is Parse for constants; it panics on invalid input.
+func MustParse(s string) Decimal {
+	d, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+func (d Decimal) c() *big.Int {
+	if d.coef == nil {
+		return bigZero
+	}
+	return d.coef
+}
+
+// Scale returns the number of decimal places d carries.
+func (d Decimal) Scale() int32 {
+	return d.scale
+}
+
+// coefAt returns the coefficient of d at a scale not smaller than d.scale.
+func (d Decimal) coefAt(scale int32) *big.Int {
+	if scale == d.scale {
+		return d.c()
+	}
+	return new(big.Int).Mul(d.c(), pow10(scale-d.scale))
+}
+
+func align(a, b Decimal) (*big.Int, *big.Int, int32) {
+	scale := a.scale
+	if b.scale > scale {
+		scale = b.scale
+	}
+	return a.coefAt(scale), b.coefAt(scale), scale
+}
+
+func (d Decimal) Add(e Decimal) Decimal {
+	x, y, scale := align(d, e)
+	return Decimal{coef: new(big.Int).Add(x, y), scale: scale}
+}
+
+func (d Decimal) Sub(e Decimal) Decimal {
+	x, y, scale := align(d, e)
+	return Decimal{coef: new(big.Int).Sub(x, y), scale: scale}
+}
+
+// Mul returns the exact product; its scale is the sum of both scales.
+func (d Decimal) Mul(e Decimal) Decimal {
+	return Decimal{coef: new(big.Int).Mul(d.c(), e.c()), scale: d.scale + e.scale}
+}
+
+// Quo divides d by e and rounds the result to scale decimal places.
+func (d Decimal) Quo(e Decimal, scale int32, mode RoundingMode) (Decimal, error) {
+	if e.IsZero() {
+		return Decimal{}, ErrDivisionByZero
+	}
+
+	// d/e × 10^scale = d.coef × 10^(e.scale+scale) / (e.coef × 10^d.scale)
+	num := new(big.Int).Mul(d.c(), pow10(e.scale+scale))
+	den := new(big.Int).Mul(e.c(), pow10(d.scale))
+	return Decimal{coef: roundQuo(num, den, mode), scale: scale}, nil
+}
+
+func (d Decimal) Neg() Decimal {
+	return Decimal{coef: new(big.Int).Neg(d.c()), scale: d.scale}
+}
+
+func (d Decimal) Abs() Decimal {
+	return Decimal{coef: new(big.Int).Abs(d.c()), scale: d.scale}
+}
+
+// Round returns d rounded to scale decimal places. Rounding to a larger
+// scale pads with zeros and is always exact.
+func (d Decimal) Round(scale int32, mode RoundingMode) Decimal {
+	if scale >= d.scale {
+		return Decimal{coef: d.coefAt(scale), scale: scale}
+	}
+	return Decimal{coef: roundQuo(d.c(), pow10(d.scale-scale), mode), scale: scale}
+}
+
+// Reduce drops trailing zeros but keeps at least minScale decimal places.
+func (d Decimal) Reduce(minScale int32) Decimal {
+	coef := new(big.Int).Set(d.c())
+	scale := d.scale
+	ten := big.NewInt(10)
+	rem := new(big.Int)
+	for scale > minScale {
+		q, r := new(big.Int).QuoRem(coef, ten, rem)
+		if r.Sign() != 0 {
+			break
+		}
+		coef = q
+		scale--
+	}
+	if scale < minScale {
+		return Decimal{coef: coef, scale: scale}.Round(minScale, HalfUp)
+	}
+	return Decimal{coef: coef, scale: scale}
+}
+
+// Exact reports whether d can be represented with scale decimal places
+// without rounding.
+func (d Decimal) Exact(scale int32) bool {
+	return d.Round(scale, Down).Cmp(d) == 0
+}
+
+// Units returns the coefficient of d at the given scale, e.g. the paisa
+// count of a taka amount at scale 2. d must be exact at that scale.
+func (d Decimal) Units(scale int32) (int64, error) {
+	if !d.Exact(scale) {
+		return 0, fmt.Errorf("%s has more than %d decimal places", d, scale)
+	}
+	coef := d.Round(scale, Down).c()
+	if !coef.IsInt64() {
+		return 0, fmt.Errorf("%s is out of range", d)
+	}
+	return coef.Int64(), nil
+}
+
+func (d Decimal) Cmp(e Decimal) int {
+	x, y, _ := align(d, e)
+	return x.Cmp(y)
+}
+
+func (d Decimal) Equal(e Decimal) bool {
+	return d.Cmp(e) == 0
+}
+
+func (d Decimal) Sign() int {
+	return d.c().Sign()
+}
+
+func (d Decimal) IsZero() bool {
+	return d.Sign() == 0
+}
+
+func (d Decimal) IsPositive() bool {
+	return d.Sign() > 0
+}
+
+func (d Decimal) IsNegative() bool {
+	return d.Sign() < 0
+}
+
+// Float64 is for logging and statistics only, never for arithmetic on money.
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+func (d Decimal) String() string {
+	digits := new(big.Int).Abs(d.c()).String()
+	sign := ""
+	if d.Sign() < 0 {
+		sign = "-"
+	}
+	if d.scale <= 0 {
+		return sign + digits + strings.Repeat("0", int(-d.scale))
+	}
+
+	scale := int(d.scale)
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+}
+
+// MarshalJSON encodes d as a JSON string so clients never parse it into a
+// binary float.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + d.String() + `"`), nil
+}
+
+// UnmarshalJSON accepts both "12.34" and 12.34. Numbers are read from their
+// literal text, so no precision is lost either way.
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if string(data) == "null" {
+		*d = Decimal{}
+		return nil
+	}
+	if len(data) >= 2 && data[0] == '"' && data[len(data)-1] == '"' {
+		data = data[1 : len(data)-1]
+	}
+	parsed, err := Parse(string(data))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// Scan reads DECIMAL columns, which lib/pq returns as text.
+func (d *Decimal) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*d = Decimal{}
+		return nil
+	case []byte:
+		parsed, err := Parse(string(v))
+		if err != nil {
+			return err
+		}
+		*d = parsed
+		return nil
+	case string:
+		parsed, err := Parse(v)
+		if err != nil {
+			return err
+		}
+		*d = parsed
+		return nil
+	case int64:
+		*d = NewFromInt(v)
+		return nil
+	case float64:
+		parsed, err := Parse(strconv.FormatFloat(v, 'f', -1, 64))
+		if err != nil {
+			return err
+		}
+		*d = parsed
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into money.Decimal", src)
+	}
+}
+
+// Value writes d as text, which Postgres converts to NUMERIC exactly.
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
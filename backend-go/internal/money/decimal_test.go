@@ -0,0 +1,155 @@
+package money
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in    string
+		want  string
+		scale int32
+	}{
+		{"0", "0", 0},
+		{"1234.50", "1234.50", 2},
+		{"-1234.50", "-1234.50", 2},
+		{"+7", "7", 0},
+		{" 0.70 ", "0.70", 2},
+		{".5", "0.5", 1},
+		{"5.", "5", 0},
+		{"1.5e3", "1500", 0},
+		{"1.5E-3", "0.0015", 4},
+		{"-2e2", "-200", 0},
+		{"1e30", "1" + strings.Repeat("0", 30), 0},
+		{"1e-30", "0." + strings.Repeat("0", 29) + "1", 30},
+		{strings.Repeat("9", 40), strings.Repeat("9", 40), 0},
+	}
+	for _, tt := range tests {
+		d, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if d.String() != tt.want || d.Scale() != tt.scale {
+			t.Errorf("Parse(%q) = %s (scale %d), want %s (scale %d)", tt.in, d, d.Scale(), tt.want, tt.scale)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, in := range []string{
+		"", " ", "-", "+", ".", "e5", "1e", "abc", "1.2.3", "1,000", "0x10", "NaN", "Inf", "1e+",
+		"1e31", "1e-31", "1e-20000000", "1e2147483647",
+		strings.Repeat("9", 41),
+		"0." + strings.Repeat("0", 40) + "1",
+	} {
+		if d, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q) = %s, want error", in, d)
+		}
+	}
+}
+
+func TestParseHugeExponentIsFast(t *testing.T) {
+	start := time.Now()
+	for _, in := range []string{"1e-20000000", "1e2147483647", "1e-2147483648"} {
+		var d Decimal
+		if err := json.Unmarshal([]byte(in), &d); err == nil {
+			t.Errorf("Unmarshal(%s) succeeded", in)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("rejecting huge exponents took %s", elapsed)
+	}
+}
+
+var allModes = []RoundingMode{HalfUp, HalfEven, HalfDown, Down, Up, Floor, Ceiling}
+
+func TestRound(t *testing.T) {
+	// Expected results per mode, in the order of allModes
+	tests := []struct {
+		in   string
+		want [7]string
+	}{
+		{"2.5", [7]string{"3", "2", "2", "2", "3", "2", "3"}},
+		{"3.5", [7]string{"4", "4", "3", "3", "4", "3", "4"}},
+		{"2.4", [7]string{"2", "2", "2", "2", "3", "2", "3"}},
+		{"2.6", [7]string{"3", "3", "3", "2", "3", "2", "3"}},
+		{"2.0", [7]string{"2", "2", "2", "2", "2", "2", "2"}},
+		{"-2.5", [7]string{"-3", "-2", "-2", "-2", "-3", "-3", "-2"}},
+		{"-3.5", [7]string{"-4", "-4", "-3", "-3", "-4", "-4", "-3"}},
+		{"-2.4", [7]string{"-2", "-2", "-2", "-2", "-3", "-3", "-2"}},
+		{"-2.6", [7]string{"-3", "-3", "-3", "-2", "-3", "-3", "-2"}},
+		{"-0.5", [7]string{"-1", "0", "0", "0", "-1", "-1", "0"}},
+	}
+	for _, tt := range tests {
+		d := MustParse(tt.in)
+		for i, mode := range allModes {
+			if got := d.Round(0, mode).String(); got != tt.want[i] {
+				t.Errorf("%s.Round(0, %s) = %s, want %s", tt.in, mode, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestRoundScale(t *testing.T) {
+	tests := []struct {
+		in    string
+		scale int32
+		mode  RoundingMode
+		want  string
+	}{
+		{"1.005", 2, HalfUp, "1.01"},
+		{"1.005", 2, HalfEven, "1.00"},
+		{"1.015", 2, HalfEven, "1.02"},
+		{"-1.005", 2, HalfUp, "-1.01"},
+		{"-1.005", 2, HalfEven, "-1.00"},
+		{"1.5", 3, Down, "1.500"},
+		{"0.70123456", 4, HalfUp, "0.7012"},
+		{"123.456", -1, HalfUp, "120"},
+	}
+	for _, tt := range tests {
+		if got := MustParse(tt.in).Round(tt.scale, tt.mode).String(); got != tt.want {
+			t.Errorf("%s.Round(%d, %s) = %s, want %s", tt.in, tt.scale, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestRoundQuo(t *testing.T) {
+	// num/den, with the expected integer per mode in the order of allModes
+	tests := []struct {
+		num, den int64
+		want     [7]int64
+	}{
+		{7, 2, [7]int64{4, 4, 3, 3, 4, 3, 4}},
+		{5, 2, [7]int64{3, 2, 2, 2, 3, 2, 3}},
+		{-7, 2, [7]int64{-4, -4, -3, -3, -4, -4, -3}},
+		{7, -2, [7]int64{-4, -4, -3, -3, -4, -4, -3}},
+		{-7, -2, [7]int64{4, 4, 3, 3, 4, 3, 4}},
+		{10, 3, [7]int64{3, 3, 3, 3, 4, 3, 4}},
+		{-10, 3, [7]int64{-3, -3, -3, -3, -4, -4, -3}},
+		{11, 3, [7]int64{4, 4, 4, 3, 4, 3, 4}},
+		{-11, 3, [7]int64{-4, -4, -4, -3, -4, -4, -3}},
+		{6, 3, [7]int64{2, 2, 2, 2, 2, 2, 2}},
+		{0, 5, [7]int64{0, 0, 0, 0, 0, 0, 0}},
+	}
+	for _, tt := range tests {
+		for i, mode := range allModes {
+			got := roundQuo(big.NewInt(tt.num), big.NewInt(tt.den), mode)
+			if got.Int64() != tt.want[i] {
+				t.Errorf("roundQuo(%d, %d, %s) = %s, want %d", tt.num, tt.den, mode, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestRoundQuoLeavesInputs(t *testing.T) {
+	num, den := big.NewInt(-7), big.NewInt(-2)
+	roundQuo(num, den, HalfUp)
+	if num.Int64() != -7 || den.Int64() != -2 {
+		t.Errorf("roundQuo modified its inputs: %s / %s", num, den)
+	}
+}
@@ -0,0 +1,111 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var ErrCurrencyMismatch = errors.New("currency mismatch")
+
+var (
+	decimalsMu sync.RWMutex
+	decimals   = map[string]int32{
+		"BDT": 2,
+		"INR": 2,
+	}
+)
+
+// DefaultDecimals applies to currencies without a registered precision.
+const DefaultDecimals = 2
+
+// Decimals returns the number of minor-unit decimal places of a currency.
+func Decimals(currency string) int32 {
+	decimalsMu.RLock()
+	defer decimalsMu.RUnlock()
+	if d, ok := decimals[currency]; ok {
+		return d
+	}
+	return DefaultDecimals
+}
+
+// SetDecimals registers the minor-unit precision of a currency, e.g. from the
+// currency registry at start-up.
+func SetDecimals(currency string, places int32) {
+	decimalsMu.Lock()
+	defer decimalsMu.Unlock()
+	decimals[currency] = places
+}
+
+// Money is an amount with its currency attached.
+type Money struct {
+	Amount   Decimal `json:"amount"`
+	Currency string  `json:"currency"`
+}
+
+func Of(amount Decimal, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+	return Of(m.Amount.Add(o.Amount), m.Currency), nil
+}
+
+func (m Money) Sub(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+	return Of(m.Amount.Sub(o.Amount), m.Currency), nil
+}
+
+func (m Money) Cmp(o Money) (int, error) {
+	if m.Currency != o.Currency {
+		return 0, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+	return m.Amount.Cmp(o.Amount), nil
+}
+
+func (m Money) Neg() Money {
+	return Of(m.Amount.Neg(), m.Currency)
+}
+
+func (m Money) Sign() int {
+	return m.Amount.Sign()
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount.IsZero()
+}
+
+func (m Money) IsPositive() bool {
+	return m.Amount.IsPositive()
+}
+
+// Round rounds the amount to the minor unit of its currency.
+func (m Money) Round(mode RoundingMode) Money {
+	return Of(m.Amount.Round(Decimals(m.Currency), mode), m.Currency)
+}
+
+// Exact reports whether the amount fits the minor unit of its currency.
+func (m Money) Exact() bool {
+	return m.Amount.Exact(Decimals(m.Currency))
+}
+
+// Validate rejects amounts that are not positive or are finer than the
+// currency's minor unit.
+func (m Money) Validate() error {
+	if !m.IsPositive() {
+		return fmt.Errorf("amount must be greater than zero")
+	}
+	if !m.Exact() {
+		return fmt.Errorf("amount %s has more than %d decimal places for %s", m.Amount, Decimals(m.Currency), m.Currency)
+	}
+	return nil
+}
+
+func (m Money) String() string {
+	return m.Amount.Round(Decimals(m.Currency), HalfUp).String() + " " + m.Currency
+}
@@ -0,0 +1,102 @@
+package money
+
+import (
+	"fmt"
+	"math/big"
+)
+
+type RoundingMode int
+
+const (
+	// HalfUp rounds ties away from zero, like math.Round.
+	HalfUp RoundingMode = iota
+	// HalfEven rounds ties to the even neighbour (banker's rounding).
+	HalfEven
+	// HalfDown rounds ties toward zero.
+	HalfDown
+	// Down truncates toward zero.
+	Down
+	// Up rounds away from zero.
+	Up
+	// Floor rounds toward negative infinity.
+	Floor
+	// Ceiling rounds toward positive infinity.
+	Ceiling
+)
+
+var roundingModeNames = map[RoundingMode]string{
+	HalfUp:   "half_up",
+	HalfEven: "half_even",
+	HalfDown: "half_down",
+	Down:     "down",
+	Up:       "up",
+	Floor:    "floor",
+	Ceiling:  "ceiling",
+}
+
+func (m RoundingMode) String() string {
+	if name, ok := roundingModeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("RoundingMode(%d)", int(m))
+}
+
+// ParseRoundingMode reads the configuration name of a rounding mode.
+func ParseRoundingMode(name string) (RoundingMode, error) {
+	for mode, n := range roundingModeNames {
+		if n == name {
+			return mode, nil
+		}
+	}
+	return HalfUp, fmt.Errorf("unknown rounding mode: %s", name)
+}
+
+// roundQuo returns num/den rounded to an integer with the given mode.
+func roundQuo(num, den *big.Int, mode RoundingMode) *big.Int {
+	if den.Sign() < 0 {
+		num = new(big.Int).Neg(num)
+		den = new(big.Int).Neg(den)
+	}
+
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+
+	negative := num.Sign() < 0
+	var away bool
+	switch mode {
+	case Down:
+		away = false
+	case Up:
+		away = true
+	case Floor:
+		away = negative
+	case Ceiling:
+		away = !negative
+	default:
+		twice := new(big.Int).Abs(r)
+		twice.Lsh(twice, 1)
+		switch c := twice.Cmp(den); {
+		case c > 0:
+			away = true
+		case c < 0:
+			away = false
+		case mode == HalfEven:
+			away = q.Bit(0) == 1
+		case mode == HalfDown:
+			away = false
+		default:
+			away = true
+		}
+	}
+
+	if away {
+		if negative {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q
+}
@@ -0,0 +1,160 @@
+package payments
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+
+	"bdpayx-backend/internal/money"
+)
+
+var (
+	ErrUnknownSender = errors.New("sms is not from a supported payment provider")
+	ErrNotIncoming   = errors.New("sms does not report an incoming payment")
+	ErrUnparsable    = errors.New("could not parse payment details from sms")
+)
+
+// Payment is a mobile-money payment we received, as reported by the
+// provider's SMS. Reference is whatever the payer typed as reference, if the
+// provider includes it.
+type Payment struct {
+	Provider  string
+	Currency  string
+	Amount    money.Decimal
+	Sender    string
+	TrxID     string
+	Reference string
+}
+
+// Parser understands the SMS of one provider.
+type Parser interface {
+	Provider() string
+	// Matches reports whether an SMS sender ID belongs to the provider. Only
+	// the provider's own IDs match; a phone number that merely contains one
+	// can be anyone's.
+	Matches(sender string) bool
+	Parse(body string) (*Payment, error)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []Parser
+)
+
+// Register adds a parser. Parsers are consulted in registration order.
+func Register(p Parser) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, p)
+}
+
+// Parse picks the parser for the SMS sender and parses the body with it.
+func Parse(sender, body string) (*Payment, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	for _, p := range registry {
+		if p.Matches(sender) {
+			return p.Parse(body)
+		}
+	}
+	return nil, ErrUnknownSender
+}
+
+func init() {
+	Register(Bkash)
+	Register(Nagad)
+	Register(Rocket)
+}
+
+var (
+	amountPattern = regexp.MustCompile(`(?i)Tk\.?\s*([\d,]+(?:\.\d+)?)`)
+	senderPattern = regexp.MustCompile(`(?i)from\s*(?:A/C:?\s*)?(\d{11})`)
+	refPattern    = regexp.MustCompile(`(?i)\bRef(?:erence)?[.:\s]+([A-Za-z0-9-]+)`)
+)
+
+// regexParser parses the common "You have received Tk 500.00 from
+// 01712345678 ... TrxID ABC123" layout, with provider specific transaction
+// ID labels and sender IDs.
+type regexParser struct {
+	provider string
+	// senderIDs are the provider's sender IDs, in lower case
+	senderIDs []string
+	incoming  *regexp.Regexp
+	trxID     *regexp.Regexp
+}
+
+func (p *regexParser) Provider() string {
+	return p.provider
+}
+
+func (p *regexParser) Matches(sender string) bool {
+	sender = strings.ToLower(strings.TrimSpace(sender))
+	for _, id := range p.senderIDs {
+		if sender == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *regexParser) Parse(body string) (*Payment, error) {
+	if !p.incoming.MatchString(body) {
+		return nil, ErrNotIncoming
+	}
+
+	amountMatch := amountPattern.FindStringSubmatch(body)
+	trxMatch := p.trxID.FindStringSubmatch(body)
+	if amountMatch == nil || trxMatch == nil {
+		return nil, ErrUnparsable
+	}
+
+	amount, err := money.Parse(strings.ReplaceAll(amountMatch[1], ",", ""))
+	if err != nil || !amount.IsPositive() {
+		return nil, ErrUnparsable
+	}
+
+	payment := &Payment{
+		Provider: p.provider,
+		Currency: "BDT",
+		Amount:   amount,
+		TrxID:    strings.ToUpper(trxMatch[1]),
+	}
+	if m := senderPattern.FindStringSubmatch(body); m != nil {
+		payment.Sender = m[1]
+	}
+	if m := refPattern.FindStringSubmatch(body); m != nil {
+		payment.Reference = m[1]
+	}
+	return payment, nil
+}
+
+var incomingPattern = regexp.MustCompile(`(?i)\b(received|cash\s*in|money\s*received)\b`)
+
+// Bkash parses messages such as
+// "You have received Tk 500.00 from 01712345678. Ref DEPK7M2Q9XA. Fee Tk 0.00. Balance Tk 1,500.00. TrxID ABC123XYZ at 15/12/2024 10:30"
+// and "Cash In Tk 500 from 01712345678. TrxID ABC123XYZ".
+var Bkash Parser = &regexParser{
+	provider:  "bkash",
+	senderIDs: []string{"bkash", "16247"},
+	incoming:  incomingPattern,
+	trxID:     regexp.MustCompile(`(?i)TrxID[:\s]*([A-Z0-9]+)`),
+}
+
+// Nagad parses messages such as
+// "Cash In Tk 500.00 from 01712345678. TxnID: 7AB12CD3. Balance: Tk 1000".
+var Nagad Parser = &regexParser{
+	provider:  "nagad",
+	senderIDs: []string{"nagad", "16167"},
+	incoming:  incomingPattern,
+	trxID:     regexp.MustCompile(`(?i)TxnID[:\s]*([A-Z0-9]+)`),
+}
+
+// Rocket parses messages such as
+// "Tk500.00 received from A/C:01712345678 Fee:Tk0, Your A/C Balance: Tk1,000.00 TxnId:1234567890 Date:15-DEC-24".
+var Rocket Parser = &regexParser{
+	provider:  "rocket",
+	senderIDs: []string{"rocket", "16216"},
+	incoming:  incomingPattern,
+	trxID:     regexp.MustCompile(`(?i)(?:TxnId|TrxID|Trx)[:\s]*([A-Z0-9]+)`),
+}
@@ -0,0 +1,218 @@
+package payments
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		sender    string
+		body      string
+		provider  string
+		amount    string
+		from      string
+		trxID     string
+		reference string
+	}{
+		{
+			name:      "bkash received",
+			sender:    "bKash",
+			body:      "You have received Tk 500.00 from 01712345678. Ref DEPK7M2Q9XA. Fee Tk 0.00. Balance Tk 1,500.00. TrxID ABC123XYZ at 15/12/2024 10:30",
+			provider:  "bkash",
+			amount:    "500.00",
+			from:      "01712345678",
+			trxID:     "ABC123XYZ",
+			reference: "DEPK7M2Q9XA",
+		},
+		{
+			name:     "bkash cash in",
+			sender:   "16247",
+			body:     "Cash In Tk 500 from 01712345678. TrxID ABC123XYZ",
+			provider: "bkash",
+			amount:   "500",
+			from:     "01712345678",
+			trxID:    "ABC123XYZ",
+		},
+		{
+			name:     "bkash comma amount",
+			sender:   "bKash",
+			body:     "You have received Tk 12,500.50 from 01712345678. Fee Tk 0.00. Balance Tk 20,000.00. TrxID 9XY8ZT7Q at 15/12/2024 10:30",
+			provider: "bkash",
+			amount:   "12500.50",
+			from:     "01712345678",
+			trxID:    "9XY8ZT7Q",
+		},
+		{
+			name:     "nagad cash in",
+			sender:   "NAGAD",
+			body:     "Cash In Tk 500.00 from 01712345678. TxnID: 7AB12CD3. Balance: Tk 1000",
+			provider: "nagad",
+			amount:   "500.00",
+			from:     "01712345678",
+			trxID:    "7AB12CD3",
+		},
+		{
+			name:     "nagad comma amount",
+			sender:   "16167",
+			body:     "Cash In Tk 1,250.00 from 01812345678. TxnID: 7ab12cd4. Balance: Tk 2,250.00",
+			provider: "nagad",
+			amount:   "1250.00",
+			from:     "01812345678",
+			trxID:    "7AB12CD4",
+		},
+		{
+			name:     "rocket received",
+			sender:   "16216",
+			body:     "Tk500.00 received from A/C:01712345678 Fee:Tk0, Your A/C Balance: Tk1,000.00 TxnId:1234567890 Date:15-DEC-24",
+			provider: "rocket",
+			amount:   "500.00",
+			from:     "01712345678",
+			trxID:    "1234567890",
+		},
+		{
+			name:     "rocket comma amount",
+			sender:   " Rocket ",
+			body:     "Tk2,000.00 received from A/C:01912345678 Fee:Tk0, Your A/C Balance: Tk3,000.00 TxnId:1234567891 Date:15-DEC-24",
+			provider: "rocket",
+			amount:   "2000.00",
+			from:     "01912345678",
+			trxID:    "1234567891",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Parse(tt.sender, tt.body)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if p.Provider != tt.provider || p.Currency != "BDT" {
+				t.Errorf("provider %s %s, want %s BDT", p.Provider, p.Currency, tt.provider)
+			}
+			if p.Amount.String() != tt.amount {
+				t.Errorf("amount %s, want %s", p.Amount, tt.amount)
+			}
+			if p.Sender != tt.from {
+				t.Errorf("sender %q, want %q", p.Sender, tt.from)
+			}
+			if p.TrxID != tt.trxID {
+				t.Errorf("trx ID %q, want %q", p.TrxID, tt.trxID)
+			}
+			if p.Reference != tt.reference {
+				t.Errorf("reference %q, want %q", p.Reference, tt.reference)
+			}
+		})
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		sender string
+		body   string
+		want   error
+	}{
+		{
+			name:   "bkash send money",
+			sender: "bKash",
+			body:   "Send Money Tk 500.00 to 01712345678 successful. Ref DEPK7M2Q9XA. Fee Tk 0.00. Balance Tk 1,000.00. TrxID ABC123XYZ at 15/12/2024 10:30",
+			want:   ErrNotIncoming,
+		},
+		{
+			name:   "bkash payment",
+			sender: "bKash",
+			body:   "Payment Tk 250.00 to Shop 01712345678 is successful. Balance Tk 750.00. TrxID ABC123XYZ at 15/12/2024 10:30",
+			want:   ErrNotIncoming,
+		},
+		{
+			name:   "nagad cash out",
+			sender: "NAGAD",
+			body:   "Cash Out Tk 500.00 to 01712345678. TxnID: 7AB12CD3. Balance: Tk 500",
+			want:   ErrNotIncoming,
+		},
+		{
+			name:   "bkash otp",
+			sender: "bKash",
+			body:   "Your bKash verification code is 123456. Do not share it with anyone.",
+			want:   ErrNotIncoming,
+		},
+		{
+			name:   "bkash missing trx id",
+			sender: "bKash",
+			body:   "You have received Tk 500.00 from 01712345678. Fee Tk 0.00. Balance Tk 1,500.00.",
+			want:   ErrUnparsable,
+		},
+		{
+			name:   "nagad missing trx id",
+			sender: "NAGAD",
+			body:   "Cash In Tk 500.00 from 01712345678. Balance: Tk 1000",
+			want:   ErrUnparsable,
+		},
+		{
+			name:   "rocket missing amount",
+			sender: "16216",
+			body:   "Money received from A/C:01712345678 TxnId:1234567890 Date:15-DEC-24",
+			want:   ErrUnparsable,
+		},
+		{
+			name:   "zero amount",
+			sender: "bKash",
+			body:   "You have received Tk 0.00 from 01712345678. TrxID ABC123XYZ at 15/12/2024 10:30",
+			want:   ErrUnparsable,
+		},
+		{
+			name:   "personal number",
+			sender: "+8801712345678",
+			body:   "You have received Tk 500.00 from 01712345678. TrxID ABC123XYZ at 15/12/2024 10:30",
+			want:   ErrUnknownSender,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Parse(tt.sender, tt.body)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Parse = %+v, %v; want %v", p, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSenderMatching(t *testing.T) {
+	tests := []struct {
+		sender string
+		want   Parser
+	}{
+		{"bKash", Bkash},
+		{"BKASH", Bkash},
+		{"16247", Bkash},
+		{"NAGAD", Nagad},
+		{"Nagad", Nagad},
+		{"16167", Nagad},
+		{"Rocket", Rocket},
+		{"16216", Rocket},
+		{" 16216 ", Rocket},
+		// Numbers and names that only contain a provider's ID are not the
+		// provider, or anyone could send a fake payment SMS
+		{"01716247999", nil},
+		{"+8801616167000", nil},
+		{"162160", nil},
+		{"bKash-Agent", nil},
+		{"MyNagadShop", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		var got Parser
+		for _, p := range []Parser{Bkash, Nagad, Rocket} {
+			if p.Matches(tt.sender) {
+				if got != nil {
+					t.Errorf("%q matches both %s and %s", tt.sender, got.Provider(), p.Provider())
+				}
+				got = p
+			}
+		}
+		if got != tt.want {
+			t.Errorf("%q matched %v, want %v", tt.sender, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package rates
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func newTestBreaker(threshold int, cooldown time.Duration) (*Breaker, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	b := NewBreaker(threshold, cooldown)
+	b.now = clock.now
+	return b, clock
+}
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	b, _ := newTestBreaker(3, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		if !b.Allow() {
+			t.Fatalf("closed breaker refused call %d", i)
+		}
+		b.Failure()
+		if state := b.State(); state != BreakerClosed {
+			t.Fatalf("after %d failures state is %s, want %s", i+1, state, BreakerClosed)
+		}
+	}
+
+	b.Failure()
+	if state := b.State(); state != BreakerOpen {
+		t.Fatalf("after threshold state is %s, want %s", state, BreakerOpen)
+	}
+	if b.Allow() {
+		t.Error("open breaker allowed a call")
+	}
+}
+
+func TestBreakerSuccessResetsFailures(t *testing.T) {
+	b, _ := newTestBreaker(2, time.Minute)
+
+	b.Failure()
+	b.Success()
+	b.Failure()
+	if state := b.State(); state != BreakerClosed {
+		t.Errorf("failures were not reset by success: state %s", state)
+	}
+}
+
+func TestBreakerHalfOpenCycle(t *testing.T) {
+	b, clock := newTestBreaker(1, time.Minute)
+	b.Failure()
+
+	clock.advance(59 * time.Second)
+	if b.Allow() {
+		t.Fatal("breaker allowed a call before its cooldown passed")
+	}
+
+	clock.advance(time.Second)
+	if state := b.State(); state != BreakerHalfOpen {
+		t.Fatalf("after cooldown state is %s, want %s", state, BreakerHalfOpen)
+	}
+	if !b.Allow() {
+		t.Fatal("half-open breaker refused the trial call")
+	}
+	if b.Allow() {
+		t.Fatal("half-open breaker allowed a second call during the trial")
+	}
+
+	// A failed trial reopens it for a whole cooldown
+	b.Failure()
+	if state := b.State(); state != BreakerOpen {
+		t.Fatalf("after failed trial state is %s, want %s", state, BreakerOpen)
+	}
+	clock.advance(30 * time.Second)
+	if b.Allow() {
+		t.Fatal("breaker allowed a call before the new cooldown passed")
+	}
+
+	// A successful trial closes it
+	clock.advance(30 * time.Second)
+	if !b.Allow() {
+		t.Fatal("breaker refused the second trial")
+	}
+	b.Success()
+	if state := b.State(); state != BreakerClosed {
+		t.Fatalf("after successful trial state is %s, want %s", state, BreakerClosed)
+	}
+	if !b.Allow() || !b.Allow() {
+		t.Error("closed breaker refused calls")
+	}
+}
@@ -0,0 +1,122 @@
+package rates
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrAllProvidersFailed = errors.New("all rate providers failed")
+
+// Chain asks its providers in priority order and returns the first answer.
+// Each provider sits behind its own circuit breaker, so a feed that keeps
+// failing is skipped until its cooldown has passed. The first provider is
+// the primary; the others are fallbacks that keep rates moving while it is
+// down.
+type Chain struct {
+	providers []Provider
+	breakers  []*Breaker
+	now       func() time.Time
+
+	mu          sync.Mutex
+	lastSuccess []time.Time
+}
+
+func NewChain(threshold int, cooldown time.Duration, providers ...Provider) *Chain {
+	c := &Chain{
+		providers:   providers,
+		now:         time.Now,
+		lastSuccess: make([]time.Time, len(providers)),
+	}
+	for range providers {
+		c.breakers = append(c.breakers, NewBreaker(threshold, cooldown))
+	}
+	return c
+}
+
+// IsFallback reports whether name is one of the chain's providers other
+// than the primary.
+func (c *Chain) IsFallback(name string) bool {
+	for i, p := range c.providers {
+		if i > 0 && p.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// LastPrimarySuccess is when the primary provider last answered, or the
+// zero time if it has not since the chain was built.
+func (c *Chain) LastPrimarySuccess() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.lastSuccess) == 0 {
+		return time.Time{}
+	}
+	return c.lastSuccess[0]
+}
+
+// Simulator returns the chain's simulator, or nil if it has none.
+func (c *Chain) Simulator() *Simulator {
+	for _, p := range c.providers {
+		if sim, ok := p.(*Simulator); ok {
+			return sim
+		}
+	}
+	return nil
+}
+
+// ProviderStatus describes one provider of a chain for monitoring.
+type ProviderStatus struct {
+	Name        string     `json:"name"`
+	Breaker     string     `json:"breaker"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+}
+
+func (c *Chain) Status() []ProviderStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := make([]ProviderStatus, len(c.providers))
+	for i, p := range c.providers {
+		status[i] = ProviderStatus{Name: p.Name(), Breaker: c.breakers[i].State()}
+		if at := c.lastSuccess[i]; !at.IsZero() {
+			status[i].LastSuccess = &at
+		}
+	}
+	return status
+}
+
+// Fetch returns the rates of the first provider that answers, and its name.
+func (c *Chain) Fetch(ctx context.Context, current Rates) (Rates, string, error) {
+	var failures []string
+	for i, p := range c.providers {
+		breaker := c.breakers[i]
+		if !breaker.Allow() {
+			failures = append(failures, p.Name()+": circuit open")
+			continue
+		}
+
+		rates, err := p.Fetch(ctx, current)
+		if err != nil {
+			breaker.Failure()
+			if breaker.State() == BreakerOpen {
+				log.Printf("⚠️ Rate provider %s failing, circuit opened: %v", p.Name(), err)
+			}
+			failures = append(failures, fmt.Sprintf("%s: %v", p.Name(), err))
+			continue
+		}
+
+		breaker.Success()
+		c.mu.Lock()
+		c.lastSuccess[i] = c.now()
+		c.mu.Unlock()
+		return rates, p.Name(), nil
+	}
+
+	return nil, "", fmt.Errorf("%w: %s", ErrAllProvidersFailed, strings.Join(failures, "; "))
+}
@@ -0,0 +1,151 @@
+package rates
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"bdpayx-backend/internal/money"
+)
+
+// stubProvider answers with rates, or fails with err, and counts its calls.
+type stubProvider struct {
+	name  string
+	rates Rates
+	err   error
+	calls int
+}
+
+func (p *stubProvider) Name() string {
+	return p.name
+}
+
+func (p *stubProvider) Fetch(ctx context.Context, current Rates) (Rates, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return p.rates, nil
+}
+
+func newTestChain(threshold int, providers ...Provider) (*Chain, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	c := NewChain(threshold, time.Minute, providers...)
+	c.now = clock.now
+	for _, b := range c.breakers {
+		b.now = clock.now
+	}
+	return c, clock
+}
+
+func TestChainPrefersFirstProvider(t *testing.T) {
+	primary := &stubProvider{name: "http", rates: Rates{"BDT_INR": money.MustParse("0.70")}}
+	fallback := &stubProvider{name: "simulator", rates: Rates{"BDT_INR": money.MustParse("0.71")}}
+	c, _ := newTestChain(3, primary, fallback)
+
+	rates, source, err := c.Fetch(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source != "http" || rates["BDT_INR"].String() != "0.70" {
+		t.Errorf("got %v from %s, want the primary's rates", rates, source)
+	}
+	if fallback.calls != 0 {
+		t.Errorf("fallback called %d times while the primary answered", fallback.calls)
+	}
+}
+
+func TestChainFallsBackInOrder(t *testing.T) {
+	primary := &stubProvider{name: "http", err: errors.New("connection refused")}
+	second := &stubProvider{name: "file", err: errors.New("no such file")}
+	third := &stubProvider{name: "simulator", rates: Rates{"BDT_INR": money.MustParse("0.71")}}
+	c, _ := newTestChain(3, primary, second, third)
+
+	_, source, err := c.Fetch(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source != "simulator" {
+		t.Errorf("source %s, want simulator", source)
+	}
+	if primary.calls != 1 || second.calls != 1 || third.calls != 1 {
+		t.Errorf("calls %d, %d, %d; want each provider asked once", primary.calls, second.calls, third.calls)
+	}
+}
+
+func TestChainSkipsOpenBreaker(t *testing.T) {
+	primary := &stubProvider{name: "http", err: errors.New("timeout")}
+	fallback := &stubProvider{name: "simulator", rates: Rates{"BDT_INR": money.MustParse("0.71")}}
+	c, clock := newTestChain(2, primary, fallback)
+
+	for i := 0; i < 5; i++ {
+		if _, _, err := c.Fetch(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if primary.calls != 2 {
+		t.Errorf("failing primary called %d times, want 2 before its breaker opened", primary.calls)
+	}
+	if status := c.Status()[0]; status.Breaker != BreakerOpen {
+		t.Errorf("primary breaker %s, want %s", status.Breaker, BreakerOpen)
+	}
+
+	// After the cooldown the primary gets a trial, and takes over again
+	primary.err = nil
+	primary.rates = Rates{"BDT_INR": money.MustParse("0.70")}
+	clock.advance(time.Minute)
+	_, source, err := c.Fetch(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source != "http" {
+		t.Errorf("source %s after cooldown, want http", source)
+	}
+	if status := c.Status()[0]; status.Breaker != BreakerClosed {
+		t.Errorf("primary breaker %s, want %s", status.Breaker, BreakerClosed)
+	}
+}
+
+func TestChainAllFail(t *testing.T) {
+	c, _ := newTestChain(3,
+		&stubProvider{name: "http", err: errors.New("timeout")},
+		&stubProvider{name: "file", err: errors.New("no such file")})
+
+	_, _, err := c.Fetch(context.Background(), nil)
+	if !errors.Is(err, ErrAllProvidersFailed) {
+		t.Errorf("err %v, want ErrAllProvidersFailed", err)
+	}
+}
+
+func TestChainTracksPrimarySuccess(t *testing.T) {
+	primary := &stubProvider{name: "http", rates: Rates{"BDT_INR": money.MustParse("0.70")}}
+	fallback := &stubProvider{name: "simulator", rates: Rates{"BDT_INR": money.MustParse("0.71")}}
+	c, clock := newTestChain(3, primary, fallback)
+
+	if !c.LastPrimarySuccess().IsZero() {
+		t.Fatal("primary success recorded before any fetch")
+	}
+	if !c.IsFallback("simulator") || c.IsFallback("http") || c.IsFallback("admin") {
+		t.Error("IsFallback does not name exactly the non-primary providers")
+	}
+
+	c.Fetch(context.Background(), nil)
+	answered := clock.t
+	if !c.LastPrimarySuccess().Equal(answered) {
+		t.Errorf("last primary success %s, want %s", c.LastPrimarySuccess(), answered)
+	}
+
+	// Answers from the fallback do not count
+	primary.err = errors.New("timeout")
+	clock.advance(10 * time.Minute)
+	if _, source, _ := c.Fetch(context.Background(), nil); source != "simulator" {
+		t.Fatalf("source %s, want simulator", source)
+	}
+	if !c.LastPrimarySuccess().Equal(answered) {
+		t.Errorf("last primary success moved to %s on a fallback answer", c.LastPrimarySuccess())
+	}
+	if status := c.Status(); status[1].LastSuccess == nil || !status[1].LastSuccess.Equal(clock.t) {
+		t.Errorf("fallback status %+v, want its last success", status[1])
+	}
+}
@@ -0,0 +1,29 @@
+package rates
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// File reads rates from a JSON rate document on disk. The file is read on
+// every fetch, so edits take effect on the next refresh.
+type File struct {
+	path string
+}
+
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+func (p *File) Name() string {
+	return "file"
+}
+
+func (p *File) Fetch(ctx context.Context, current Rates) (Rates, error) {
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rate file: %w", err)
+	}
+	return decodeRates(data)
+}
@@ -0,0 +1,56 @@
+package rates
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// HTTP polls a JSON rate feed. The response must be a rate document as
+// described at feedDocument.
+type HTTP struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+func NewHTTP(url, apiKey string, timeout time.Duration) *HTTP {
+	return &HTTP{
+		url:    url,
+		apiKey: apiKey,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (p *HTTP) Name() string {
+	return "http"
+}
+
+func (p *HTTP) Fetch(ctx context.Context, current Rates) (Rates, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("rate feed request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rate feed answered %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rate feed: %w", err)
+	}
+	return decodeRates(body)
+}
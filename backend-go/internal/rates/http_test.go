@@ -0,0 +1,94 @@
+package rates
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPFetch(t *testing.T) {
+	var gotAuth, gotAccept string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		gotAccept = r.Header.Get("Accept")
+		w.Write([]byte(`{"rates": {"BDT_INR": "0.7012", "inr_bdt": 1.4261}}`))
+	}))
+	defer srv.Close()
+
+	rates, err := NewHTTP(srv.URL, "secret", time.Second).Fetch(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rates["BDT_INR"].String() != "0.7012" || rates["INR_BDT"].String() != "1.4261" {
+		t.Errorf("rates %v", rates)
+	}
+	if gotAuth != "Bearer secret" {
+		t.Errorf("Authorization %q, want the API key", gotAuth)
+	}
+	if gotAccept != "application/json" {
+		t.Errorf("Accept %q", gotAccept)
+	}
+}
+
+func TestHTTPFetchErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"server error", http.StatusInternalServerError, `{}`, "500"},
+		{"not json", http.StatusOK, `<html>maintenance</html>`, "invalid rate document"},
+		{"no rates", http.StatusOK, `{"rates": {}}`, ErrNoRates.Error()},
+		{"negative rate", http.StatusOK, `{"rates": {"BDT_INR": "-0.70"}}`, "invalid rate for BDT_INR"},
+		{"zero rate", http.StatusOK, `{"rates": {"BDT_INR": 0}}`, "invalid rate for BDT_INR"},
+		{"huge exponent", http.StatusOK, `{"rates": {"BDT_INR": 1e-20000000}}`, "invalid rate document"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			_, err := NewHTTP(srv.URL, "", time.Second).Fetch(context.Background(), nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err %v, want one mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPFetchTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	start := time.Now()
+	_, err := NewHTTP(srv.URL, "", 50*time.Millisecond).Fetch(context.Background(), nil)
+	if err == nil {
+		t.Fatal("slow feed did not time out")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("timeout took %s", elapsed)
+	}
+
+	// The refresh's context bounds the request too
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = NewHTTP(srv.URL, "", time.Minute).Fetch(ctx, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err %v, want the context deadline", err)
+	}
+}
@@ -0,0 +1,86 @@
+package rates
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"bdpayx-backend/internal/config"
+	"bdpayx-backend/internal/money"
+)
+
+var ErrNoRates = errors.New("rate feed returned no usable rates")
+
+// Rates are market rates keyed by pair, e.g. "BDT_INR".
+type Rates map[string]money.Decimal
+
+// Pair returns the key of a currency pair in Rates.
+func Pair(from, to string) string {
+	return from + "_" + to
+}
+
+// Provider is a source of market rates. current holds the last known rate of
+// every pair we quote; feeds may ignore it, the simulator walks from it. A
+// provider only needs to return the pairs it knows.
+type Provider interface {
+	Name() string
+	Fetch(ctx context.Context, current Rates) (Rates, error)
+}
+
+// feedDocument is the JSON accepted from HTTP feeds and rate files:
+// {"rates": {"BDT_INR": "0.7012", "INR_BDT": 1.4261}}.
+type feedDocument struct {
+	Rates map[string]money.Decimal `json:"rates"`
+}
+
+func decodeRates(data []byte) (Rates, error) {
+	var doc feedDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid rate document: %w", err)
+	}
+
+	rates := make(Rates, len(doc.Rates))
+	for pair, rate := range doc.Rates {
+		if !rate.IsPositive() {
+			return nil, fmt.Errorf("invalid rate for %s: %s", pair, rate)
+		}
+		rates[strings.ToUpper(pair)] = rate
+	}
+	if len(rates) == 0 {
+		return nil, ErrNoRates
+	}
+	return rates, nil
+}
+
+// New builds the fallback chain named by RATE_PROVIDERS, highest priority
+// first.
+func New(cfg *config.Config) (*Chain, error) {
+	var providers []Provider
+	for _, name := range strings.Split(cfg.RateProviders, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+			continue
+		case "http":
+			if cfg.RateFeedURL == "" {
+				return nil, fmt.Errorf("http rate provider requires RATE_FEED_URL")
+			}
+			providers = append(providers, NewHTTP(cfg.RateFeedURL, cfg.RateFeedAPIKey, cfg.RateFeedTimeout))
+		case "file":
+			if cfg.RateFile == "" {
+				return nil, fmt.Errorf("file rate provider requires RATE_FILE")
+			}
+			providers = append(providers, NewFile(cfg.RateFile))
+		case "simulator":
+			providers = append(providers, NewSimulator(cfg.RateSimulatorSeed))
+		default:
+			return nil, fmt.Errorf("unknown rate provider: %s", name)
+		}
+	}
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("RATE_PROVIDERS names no rate provider")
+	}
+
+	return NewChain(cfg.RateBreakerThreshold, cfg.RateBreakerCooldown, providers...), nil
+}
@@ -0,0 +1,333 @@
+package rates
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"bdpayx-backend/internal/money"
+)
+
+var ErrInvalidSimParams = errors.New("invalid simulator parameters")
+
+const (
+	// simScale is the number of decimal places simulated rates move in,
+	// that of the rate columns
+	simScale = 8
+	// walkBackStep is the share of the distance to the base rate a market
+	// outside its band covers per tick
+	walkBackStep = 0.2
+)
+
+// SimParams tune the simulated market of one pair. Rates are absolute;
+// volatilities are fractions of the base rate moved per tick.
+type SimParams struct {
+	BaseRate         float64
+	MinRate          float64
+	MaxRate          float64
+	BaseVolatility   float64
+	MaxVolatility    float64
+	MeanReversion    float64
+	MaxTrendDuration int
+}
+
+// DefaultSimParams centres a market on rate with a ±0.3% band, the range the
+// legacy engine used around 0.70.
+func DefaultSimParams(rate float64) SimParams {
+	return SimParams{
+		BaseRate:         rate,
+		MinRate:          rate * 0.997,
+		MaxRate:          rate * 1.003,
+		BaseVolatility:   0.0003,
+		MaxVolatility:    0.0011,
+		MeanReversion:    0.05,
+		MaxTrendDuration: 20,
+	}
+}
+
+func (p SimParams) Validate() error {
+	switch {
+	case p.MinRate <= 0 || p.MinRate > p.BaseRate || p.BaseRate > p.MaxRate || p.MinRate == p.MaxRate:
+		return fmt.Errorf("%w: need 0 < min_rate <= base_rate <= max_rate", ErrInvalidSimParams)
+	case p.BaseVolatility <= 0 || p.MaxVolatility < p.BaseVolatility:
+		return fmt.Errorf("%w: need 0 < base_volatility <= max_volatility", ErrInvalidSimParams)
+	case p.MeanReversion < 0 || p.MeanReversion > 1:
+		return fmt.Errorf("%w: mean_reversion must be between 0 and 1", ErrInvalidSimParams)
+	case p.MaxTrendDuration < 1:
+		return fmt.Errorf("%w: max_trend_duration must be at least 1", ErrInvalidSimParams)
+	}
+	return nil
+}
+
+// SimState is the market a pair is currently in. Trend and momentum run from
+// -1 (bearish) to 1 (bullish).
+type SimState struct {
+	Rate       float64
+	Trend      float64
+	Momentum   float64
+	Volatility float64
+}
+
+type market struct {
+	params           SimParams
+	current          float64
+	previous         float64
+	trend            float64
+	momentum         float64
+	volatility       float64
+	trendDuration    int
+	maxTrendDuration int
+}
+
+// Simulator generates market-like rates: trends that persist and reverse,
+// volatility that clusters, momentum, mean reversion towards a base rate and
+// soft resistance at the edges of a band. It never fails, which makes it the
+// usual last entry of a chain. Given the same seed, parameters and inputs it
+// produces the same rates.
+type Simulator struct {
+	mu      sync.Mutex
+	rng     *rand.Rand
+	params  map[string]SimParams
+	markets map[string]*market
+}
+
+// NewSimulator seeds the simulator's random source; 0 picks a random seed.
+func NewSimulator(seed int64) *Simulator {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Simulator{
+		rng:     rand.New(rand.NewSource(seed)),
+		params:  make(map[string]SimParams),
+		markets: make(map[string]*market),
+	}
+}
+
+func (p *Simulator) Name() string {
+	return "simulator"
+}
+
+// SetParams replaces the parameters of a pair. Pairs without parameters use
+// DefaultSimParams around the rate they are first simulated from.
+func (p *Simulator) SetParams(pair string, params SimParams) error {
+	if err := params.Validate(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.params[pair] = params
+	if m, ok := p.markets[pair]; ok {
+		m.params = params
+	}
+	return nil
+}
+
+// Params returns the parameters in effect for a pair, if it has any yet.
+func (p *Simulator) Params(pair string) (SimParams, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if m, ok := p.markets[pair]; ok {
+		return m.params, true
+	}
+	params, ok := p.params[pair]
+	return params, ok
+}
+
+// State returns the market state of a pair once it has been simulated.
+func (p *Simulator) State(pair string) (SimState, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	m, ok := p.markets[pair]
+	if !ok {
+		return SimState{}, false
+	}
+	return SimState{Rate: m.current, Trend: m.trend, Momentum: m.momentum, Volatility: m.volatility}, true
+}
+
+// Recentre moves the band of a pair to rate, keeping its width relative to
+// the base rate, so the market carries on from a rate set by hand or taken
+// from another provider instead of being pulled back to where it was.
+func (p *Simulator) Recentre(pair string, rate float64) {
+	if rate <= 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.market(pair, rate).recentre(rate)
+}
+
+// Fetch moves every pair in current one tick. Each tick starts from the
+// stored rate; one outside the band, e.g. after new parameters, walks back
+// towards the base rate.
+func (p *Simulator) Fetch(ctx context.Context, current Rates) (Rates, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Fixed order keeps a seeded run reproducible
+	pairs := make([]string, 0, len(current))
+	for pair := range current {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+
+	rates := make(Rates, len(current))
+	for _, pair := range pairs {
+		rate := current[pair].Float64()
+		m := p.market(pair, rate)
+		m.current = rate
+		rates[pair] = money.NewFromFloat(p.next(m), simScale)
+	}
+	return rates, nil
+}
+
+func (p *Simulator) market(pair string, rate float64) *market {
+	if m, ok := p.markets[pair]; ok {
+		return m
+	}
+
+	params, ok := p.params[pair]
+	if !ok {
+		params = DefaultSimParams(rate)
+	}
+	m := &market{
+		params:           params,
+		current:          rate,
+		previous:         rate,
+		volatility:       params.BaseVolatility,
+		maxTrendDuration: params.MaxTrendDuration,
+	}
+	p.markets[pair] = m
+	return m
+}
+
+// recentre scales the band around rate. The jump to it is not a market move,
+// so it does not feed momentum or volatility.
+func (m *market) recentre(rate float64) {
+	if rate == m.params.BaseRate {
+		return
+	}
+	scale := rate / m.params.BaseRate
+	m.params.BaseRate = rate
+	m.params.MinRate *= scale
+	m.params.MaxRate *= scale
+	m.current = rate
+	m.previous = rate
+}
+
+// next advances a market by one tick and returns the new rate.
+func (p *Simulator) next(m *market) float64 {
+	if m.current < m.params.MinRate || m.current > m.params.MaxRate {
+		return m.walkBack()
+	}
+
+	p.updateTrend(m)
+	p.updateVolatility(m)
+	p.updateMomentum(m)
+
+	random := (p.rng.Float64() - 0.5) * 2
+	movement := (random*0.3 + m.trend*0.6 + m.momentum*0.4) * m.volatility * m.params.BaseRate
+
+	// Pull towards the base rate
+	reversion := -(m.current - m.params.BaseRate) * m.params.MeanReversion
+
+	m.previous = m.current
+	rate := softBounds(m.current+movement+reversion, m.params.MinRate, m.params.MaxRate)
+	m.current = roundRate(rate)
+	return m.current
+}
+
+// walkBack moves a market outside its band a step towards the base rate,
+// without trend or noise, until it is back inside.
+func (m *market) walkBack() float64 {
+	rate := roundRate(m.current + (m.params.BaseRate-m.current)*walkBackStep)
+	// Steps smaller than the rates move in would never arrive
+	if rate == m.current {
+		rate = roundRate(clamp(m.current, m.params.MinRate, m.params.MaxRate))
+	}
+	m.previous = rate
+	m.current = rate
+	return rate
+}
+
+func roundRate(rate float64) float64 {
+	unit := math.Pow10(simScale)
+	return math.Round(rate*unit) / unit
+}
+
+// updateTrend lets trends persist, strengthen and weaken, and reverses them
+// after they have run long enough or hit the edge of the band.
+func (p *Simulator) updateTrend(m *market) {
+	m.trendDuration++
+
+	reverse := m.trendDuration > m.maxTrendDuration ||
+		(m.current >= m.params.MaxRate*0.999 && m.trend > 0) ||
+		(m.current <= m.params.MinRate*1.001 && m.trend < 0) ||
+		p.rng.Float64() < 0.05
+
+	if reverse {
+		if p.rng.Float64() < 0.6 {
+			m.trend = -m.trend * (0.5 + p.rng.Float64()*0.5)
+		} else {
+			// Consolidation
+			m.trend *= 0.3
+		}
+		m.trendDuration = 0
+		m.maxTrendDuration = m.params.MaxTrendDuration/2 + p.rng.Intn(m.params.MaxTrendDuration+1)
+	} else {
+		m.trend = clamp(m.trend+(p.rng.Float64()-0.5)*0.1, -1, 1)
+	}
+
+	// Occasionally a new strong trend starts
+	if p.rng.Float64() < 0.03 {
+		m.trend = (p.rng.Float64() - 0.5) * 2
+		m.trendDuration = 0
+	}
+}
+
+// updateVolatility clusters volatility: large moves raise it, calm ones let
+// it decay back to the base level, and rare spikes stand in for news.
+func (p *Simulator) updateVolatility(m *market) {
+	change := math.Abs(m.current-m.previous) / m.params.BaseRate
+	if change > m.volatility*0.8 {
+		m.volatility = math.Min(m.params.MaxVolatility, m.volatility*1.1)
+	} else {
+		m.volatility = math.Max(m.params.BaseVolatility, m.volatility*0.95)
+	}
+
+	if p.rng.Float64() < 0.02 {
+		m.volatility = math.Min(m.params.MaxVolatility, m.params.BaseVolatility*(2+p.rng.Float64()*2))
+	}
+}
+
+// updateMomentum carries the last move forward with decay.
+func (p *Simulator) updateMomentum(m *market) {
+	change := (m.current - m.previous) / m.params.BaseRate
+	m.momentum = clamp(m.momentum*0.7+change*20, -1, 1)
+}
+
+// softBounds resists moves into the outer 10% of the band, more strongly the
+// further they go, before clamping to it.
+func softBounds(rate, min, max float64) float64 {
+	buffer := (max - min) * 0.1
+
+	if upper := max - buffer; rate > upper {
+		excess := rate - upper
+		rate = upper + excess*math.Max(0.1, 1-excess/buffer*0.8)
+	}
+	if lower := min + buffer; rate < lower {
+		deficit := lower - rate
+		rate = lower - deficit*math.Max(0.1, 1-deficit/buffer*0.8)
+	}
+	return clamp(rate, min, max)
+}
+
+func clamp(v, min, max float64) float64 {
+	return math.Max(min, math.Min(max, v))
+}
@@ -0,0 +1,191 @@
+package rates
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"bdpayx-backend/internal/money"
+)
+
+// simulate runs n ticks, feeding each answer back in as the stored rate the
+// way the rate feed does.
+func simulate(t *testing.T, sim *Simulator, start Rates, n int) []Rates {
+	t.Helper()
+	current := start
+	var ticks []Rates
+	for i := 0; i < n; i++ {
+		next, err := sim.Fetch(context.Background(), current)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ticks = append(ticks, next)
+		current = next
+	}
+	return ticks
+}
+
+func TestSimulatorIsDeterministic(t *testing.T) {
+	start := Rates{"BDT_INR": money.MustParse("0.70"), "INR_BDT": money.MustParse("1.4261")}
+
+	first := simulate(t, NewSimulator(42), start, 200)
+	second := simulate(t, NewSimulator(42), start, 200)
+	for i := range first {
+		for pair, rate := range first[i] {
+			if !rate.Equal(second[i][pair]) {
+				t.Fatalf("tick %d %s: %s and %s from the same seed", i, pair, rate, second[i][pair])
+			}
+		}
+	}
+
+	other := simulate(t, NewSimulator(43), start, 200)
+	same := true
+	for i := range first {
+		if !first[i]["BDT_INR"].Equal(other[i]["BDT_INR"]) {
+			same = false
+			break
+		}
+	}
+	if same {
+		t.Error("different seeds produced the same rates")
+	}
+}
+
+func TestSimulatorStaysInBand(t *testing.T) {
+	sim := NewSimulator(7)
+	params := DefaultSimParams(0.70)
+	moved := false
+	for i, tick := range simulate(t, sim, Rates{"BDT_INR": money.MustParse("0.70")}, 2000) {
+		rate := tick["BDT_INR"].Float64()
+		// Rates are rounded to 8 places after clamping
+		if rate < params.MinRate-0.000000005 || rate > params.MaxRate+0.000000005 {
+			t.Fatalf("tick %d: %v outside [%v, %v]", i, rate, params.MinRate, params.MaxRate)
+		}
+		if rate != 0.70 {
+			moved = true
+		}
+		if tick["BDT_INR"].Scale() > simScale {
+			t.Fatalf("tick %d: %s has more than %d places", i, tick["BDT_INR"], simScale)
+		}
+	}
+	if !moved {
+		t.Error("rate never moved")
+	}
+}
+
+func TestSimulatorWalksBackIntoBand(t *testing.T) {
+	sim := NewSimulator(1)
+	simulate(t, sim, Rates{"BDT_INR": money.MustParse("0.70")}, 10)
+	before, _ := sim.Params("BDT_INR")
+
+	// A stored rate well outside the ±0.3% band does not move the band
+	ticks := simulate(t, sim, Rates{"BDT_INR": money.MustParse("0.75")}, 100)
+	assertWalksBack(t, ticks, "BDT_INR", 0.75, before)
+
+	if after, _ := sim.Params("BDT_INR"); after != before {
+		t.Errorf("params %+v, want them kept as %+v", after, before)
+	}
+}
+
+// assertWalksBack checks that rates start moving from start towards the band
+// of params without overshooting, and stay inside it once they get there.
+func assertWalksBack(t *testing.T, ticks []Rates, pair string, start float64, params SimParams) {
+	t.Helper()
+	last, inside := start, false
+	for i, tick := range ticks {
+		rate := tick[pair].Float64()
+		if inside || (rate >= params.MinRate && rate <= params.MaxRate) {
+			if rate < params.MinRate || rate > params.MaxRate {
+				t.Fatalf("tick %d: %v left the band [%v, %v]", i, rate, params.MinRate, params.MaxRate)
+			}
+			inside = true
+			continue
+		}
+		if math.Abs(rate-params.BaseRate) >= math.Abs(last-params.BaseRate) {
+			t.Fatalf("tick %d: %v did not move from %v towards %v", i, rate, last, params.BaseRate)
+		}
+		last = rate
+	}
+	if !inside {
+		t.Fatalf("rate %v never got back into the band [%v, %v]", last, params.MinRate, params.MaxRate)
+	}
+}
+
+func TestSimulatorRecentre(t *testing.T) {
+	sim := NewSimulator(3)
+	simulate(t, sim, Rates{"BDT_INR": money.MustParse("0.70")}, 10)
+
+	// Inside the band, but far from its centre: without re-centring mean
+	// reversion would pull it back towards 0.70
+	sim.Recentre("BDT_INR", 0.702)
+	params, _ := sim.Params("BDT_INR")
+	if params.BaseRate != 0.702 || params.MinRate >= 0.702 || params.MaxRate <= 0.702 {
+		t.Fatalf("params after recentre: %+v", params)
+	}
+	if err := params.Validate(); err != nil {
+		t.Errorf("recentred params invalid: %v", err)
+	}
+	if state, _ := sim.State("BDT_INR"); state.Rate != 0.702 {
+		t.Errorf("market rate %v after recentre, want 0.702", state.Rate)
+	}
+
+	var sum float64
+	ticks := simulate(t, sim, Rates{"BDT_INR": money.MustParse("0.702")}, 1000)
+	for _, tick := range ticks {
+		sum += tick["BDT_INR"].Float64()
+	}
+	if mean := sum / float64(len(ticks)); math.Abs(mean-0.702) > 0.001 {
+		t.Errorf("mean rate %v, want it around 0.702", mean)
+	}
+}
+
+func TestSimulatorRecentreNewPair(t *testing.T) {
+	sim := NewSimulator(5)
+	sim.Recentre("USD_BDT", 110)
+	params, ok := sim.Params("USD_BDT")
+	if !ok || params.BaseRate != 110 {
+		t.Errorf("params %+v, %v; want a market around 110", params, ok)
+	}
+
+	sim.Recentre("USD_BDT", 0)
+	if params, _ := sim.Params("USD_BDT"); params.BaseRate != 110 {
+		t.Errorf("recentre on 0 changed the base rate to %v", params.BaseRate)
+	}
+}
+
+func TestSimulatorSetParams(t *testing.T) {
+	sim := NewSimulator(9)
+	params := DefaultSimParams(110)
+	params.MinRate, params.MaxRate = 100, 120
+	if err := sim.SetParams("USD_BDT", params); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := sim.Params("USD_BDT"); got != params {
+		t.Errorf("params %+v, want %+v", got, params)
+	}
+
+	bad := params
+	bad.MinRate = 115
+	if err := sim.SetParams("USD_BDT", bad); !errors.Is(err, ErrInvalidSimParams) {
+		t.Errorf("err %v, want ErrInvalidSimParams", err)
+	}
+}
+
+func TestSimulatorSetParamsExcludingCurrentRate(t *testing.T) {
+	sim := NewSimulator(11)
+	simulate(t, sim, Rates{"USD_BDT": money.MustParse("110")}, 10)
+
+	params := DefaultSimParams(120)
+	params.MinRate, params.MaxRate = 119, 121
+	if err := sim.SetParams("USD_BDT", params); err != nil {
+		t.Fatal(err)
+	}
+
+	ticks := simulate(t, sim, Rates{"USD_BDT": money.MustParse("110")}, 100)
+	assertWalksBack(t, ticks, "USD_BDT", 110, params)
+
+	if got, _ := sim.Params("USD_BDT"); got != params {
+		t.Errorf("params %+v, want them kept as %+v", got, params)
+	}
+}
@@ -4,23 +4,26 @@ import (
 	"database/sql"
 	"fmt"
 
+	"bdpayx-backend/internal/ledger"
 	"bdpayx-backend/internal/models"
+	"bdpayx-backend/internal/money"
 )
 
 type AdminService struct {
-	db *sql.DB
+	db     *sql.DB
+	ledger *ledger.Ledger
 }
 
-func NewAdminService(db *sql.DB) *AdminService {
-	return &AdminService{db: db}
+func NewAdminService(db *sql.DB, ledger *ledger.Ledger) *AdminService {
+	return &AdminService{db: db, ledger: ledger}
 }
 
 type DashboardStats struct {
-	TotalUsers        int     `json:"total_users"`
-	TotalTransactions int     `json:"total_transactions"`
-	PendingTransactions int   `json:"pending_transactions"`
-	TotalVolume       float64 `json:"total_volume"`
-	TodayVolume       float64 `json:"today_volume"`
+	TotalUsers          int           `json:"total_users"`
+	TotalTransactions   int           `json:"total_transactions"`
+	PendingTransactions int           `json:"pending_transactions"`
+	TotalVolume         money.Decimal `json:"total_volume"`
+	TodayVolume         money.Decimal `json:"today_volume"`
 }
 
 func (s *AdminService) GetDashboardStats() (*DashboardStats, error) {
@@ -102,16 +105,7 @@ func (s *AdminService) UpdateUserStatus(userID int, isVerified bool) error {
 	return nil
 }
 
-func (s *AdminService) UpdateExchangeRate(fromCurrency, toCurrency string, rate float64) error {
-	_, err := s.db.Exec(`
-		UPDATE exchange_rates 
-		SET rate = $1, updated_at = CURRENT_TIMESTAMP
-		WHERE from_currency = $2 AND to_currency = $3`,
-		rate, fromCurrency, toCurrency)
-	
-	if err != nil {
-		return fmt.Errorf("failed to update exchange rate: %w", err)
-	}
-	
-	return nil
-}
\ No newline at end of file
+// VerifyLedger runs the ledger consistency check used for monthly sign-off.
+func (s *AdminService) VerifyLedger() (*ledger.Report, error) {
+	return s.ledger.Verify()
+}
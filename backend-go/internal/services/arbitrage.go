@@ -0,0 +1,186 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"bdpayx-backend/internal/models"
+	"bdpayx-backend/internal/money"
+	"bdpayx-backend/internal/rates"
+)
+
+var ErrArbitrage = errors.New("rate would open an arbitrage loop")
+
+const (
+	// maxLoopLegs bounds the round trips searched; longer ones grow
+	// combinatorially and are unlikely to survive several spreads
+	maxLoopLegs = 4
+	// returnScale is the precision loop returns are reported with
+	returnScale = 8
+)
+
+// effectiveRates turns rates into what one unit of a currency converts to
+// along every pair: the market rate less the lowest spread the pair is sold
+// at, by default or in any tier. Fixed fees are left out, so loops they
+// would cover for small amounts still show.
+func (s *RateService) effectiveRates(current map[string]models.ExchangeRate) (map[string]map[string]money.Decimal, error) {
+	lowest, err := s.pricing.lowestSpreads()
+	if err != nil {
+		return nil, err
+	}
+
+	one := money.NewFromInt(1)
+	graph := make(map[string]map[string]money.Decimal)
+	for pair, rate := range current {
+		spread := rate.Spread
+		if tier, ok := lowest[pair]; ok && tier.Cmp(spread) < 0 {
+			spread = tier
+		}
+		if graph[rate.FromCurrency] == nil {
+			graph[rate.FromCurrency] = make(map[string]money.Decimal)
+		}
+		graph[rate.FromCurrency][rate.ToCurrency] = rate.Rate.Mul(one.Sub(spread))
+	}
+	return graph, nil
+}
+
+// findArbitrage lists the round trips of up to maxLoopLegs conversions whose
+// rates multiply to more than one, most profitable first. Each loop is
+// reported once, starting from its alphabetically first currency.
+func findArbitrage(graph map[string]map[string]money.Decimal) []models.ArbitrageLoop {
+	one := money.NewFromInt(1)
+	loops := []models.ArbitrageLoop{}
+
+	var walk func(path []string, product money.Decimal)
+	walk = func(path []string, product money.Decimal) {
+		start, last := path[0], path[len(path)-1]
+		for _, to := range sortedKeys(graph[last]) {
+			next := product.Mul(graph[last][to])
+			if to == start {
+				if next.Cmp(one) > 0 {
+					loop := append(append([]string{}, path...), start)
+					loops = append(loops, models.ArbitrageLoop{Currencies: loop, Return: next.Round(returnScale, money.Down)})
+				}
+				continue
+			}
+			if to < start || len(path) == maxLoopLegs || contains(path, to) {
+				continue
+			}
+			walk(append(path[:len(path):len(path)], to), next)
+		}
+	}
+	for _, currency := range sortedKeys(graph) {
+		walk([]string{currency}, one)
+	}
+
+	sort.SliceStable(loops, func(i, j int) bool { return loops[i].Return.Cmp(loops[j].Return) > 0 })
+	return loops
+}
+
+// loopsThrough keeps the loops that convert from one currency to the other
+// directly.
+func loopsThrough(loops []models.ArbitrageLoop, fromCurrency, toCurrency string) []models.ArbitrageLoop {
+	result := []models.ArbitrageLoop{}
+	for _, loop := range loops {
+		for i := 0; i+1 < len(loop.Currencies); i++ {
+			if loop.Currencies[i] == fromCurrency && loop.Currencies[i+1] == toCurrency {
+				result = append(result, loop)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// GetArbitrageReport lists the round trips the current rates and spreads
+// let anyone profit from.
+func (s *RateService) GetArbitrageReport() (*models.ArbitrageReport, error) {
+	current, err := s.GetRates()
+	if err != nil {
+		return nil, err
+	}
+	graph, err := s.effectiveRates(current)
+	if err != nil {
+		return nil, err
+	}
+
+	loops := findArbitrage(graph)
+	return &models.ArbitrageReport{Consistent: len(loops) == 0, Loops: loops, CheckedAt: time.Now()}, nil
+}
+
+// SetRate is how admins change a rate. It saves like SaveRate, but refuses
+// an update that would open an arbitrage loop through the pair unless
+// forced, and any update of a pair an override pins. The loops the update
+// leaves open are returned either way.
+func (s *RateService) SetRate(fromCurrency, toCurrency string, newRate money.Decimal, spread *money.Decimal, force bool) ([]models.ArbitrageLoop, error) {
+	current, err := s.GetRates()
+	if err != nil {
+		return nil, err
+	}
+	// SaveRate checks again under the row lock
+	if current[rates.Pair(fromCurrency, toCurrency)].Mode == models.RateModePinned {
+		return nil, fmt.Errorf("%w: %s to %s", ErrRatePinned, fromCurrency, toCurrency)
+	}
+
+	loops, err := s.checkArbitrage(current, fromCurrency, toCurrency, newRate, spread, force)
+	if err != nil {
+		return loops, err
+	}
+
+	if err := s.SaveRate(fromCurrency, toCurrency, newRate, spread, "admin"); err != nil {
+		return nil, err
+	}
+	return loops, nil
+}
+
+// checkArbitrage finds the loops through the pair once it moves to newRate,
+// and fails with ErrArbitrage when there are any unless forced.
+func (s *RateService) checkArbitrage(current map[string]models.ExchangeRate, fromCurrency, toCurrency string, newRate money.Decimal, spread *money.Decimal, force bool) ([]models.ArbitrageLoop, error) {
+	proposed := make(map[string]models.ExchangeRate, len(current)+1)
+	for pair, rate := range current {
+		proposed[pair] = rate
+	}
+
+	pair := rates.Pair(fromCurrency, toCurrency)
+	rate, ok := proposed[pair]
+	if !ok {
+		rate = models.ExchangeRate{FromCurrency: fromCurrency, ToCurrency: toCurrency, Spread: defaultSpread}
+	}
+	rate.Rate = newRate
+	if spread != nil {
+		rate.Spread = *spread
+	}
+	proposed[pair] = rate
+
+	graph, err := s.effectiveRates(proposed)
+	if err != nil {
+		return nil, err
+	}
+	loops := loopsThrough(findArbitrage(graph), fromCurrency, toCurrency)
+	if len(loops) > 0 && !force {
+		return loops, fmt.Errorf("%w: %s returns %s", ErrArbitrage,
+			strings.Join(loops[0].Currencies, " -> "), loops[0].Return)
+	}
+	return loops, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"bdpayx-backend/internal/models"
+	"bdpayx-backend/internal/money"
+)
+
+// testGraph builds an effective rate graph from pairs such as "A_B": "2.0".
+func testGraph(rates map[string]string) map[string]map[string]money.Decimal {
+	graph := make(map[string]map[string]money.Decimal)
+	for pair, rate := range rates {
+		from, to, _ := strings.Cut(pair, "_")
+		if graph[from] == nil {
+			graph[from] = make(map[string]money.Decimal)
+		}
+		graph[from][to] = money.MustParse(rate)
+	}
+	return graph
+}
+
+func loopNames(loops []models.ArbitrageLoop) []string {
+	names := []string{}
+	for _, loop := range loops {
+		names = append(names, strings.Join(loop.Currencies, ">")+" "+loop.Return.String())
+	}
+	return names
+}
+
+func assertLoops(t *testing.T, loops []models.ArbitrageLoop, want ...string) {
+	t.Helper()
+	got := loopNames(loops)
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("loops %v, want %v", got, want)
+	}
+}
+
+func TestFindArbitrage(t *testing.T) {
+	tests := []struct {
+		name  string
+		rates map[string]string
+		want  []string
+	}{
+		{"consistent pair", map[string]string{"A_B": "2", "B_A": "0.49"}, nil},
+		{"break-even pair", map[string]string{"A_B": "2", "B_A": "0.5"}, nil},
+		{"two legs", map[string]string{"A_B": "2", "B_A": "0.51"}, []string{"A>B>A 1.02000000"}},
+		{"three legs through a third currency",
+			map[string]string{"A_B": "2", "B_A": "0.49", "B_C": "3", "C_B": "0.33", "C_A": "0.17", "A_C": "5.8"},
+			[]string{"A>B>C>A 1.02000000"}},
+		{"most profitable first",
+			map[string]string{"A_B": "2", "B_A": "0.51", "B_C": "3", "C_B": "0.35"},
+			[]string{"B>C>B 1.05000000", "A>B>A 1.02000000"}},
+		{"longer than four legs", map[string]string{"A_B": "1", "B_C": "1", "C_D": "1", "D_E": "1", "E_A": "2"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertLoops(t, findArbitrage(testGraph(tt.rates)), tt.want...)
+		})
+	}
+}
+
+func TestLoopsThrough(t *testing.T) {
+	loops := findArbitrage(testGraph(map[string]string{"A_B": "2", "B_A": "0.51", "B_C": "3", "C_B": "0.35"}))
+
+	assertLoops(t, loopsThrough(loops, "A", "B"), "A>B>A 1.02000000")
+	assertLoops(t, loopsThrough(loops, "C", "B"), "B>C>B 1.05000000")
+	assertLoops(t, loopsThrough(loops, "A", "C"))
+}
+
+func TestSpreadsCloseLoops(t *testing.T) {
+	s := mockRateService(money.HalfUp)
+	rate := func(from, to, rate, spread string) models.ExchangeRate {
+		return models.ExchangeRate{FromCurrency: from, ToCurrency: to, Rate: money.MustParse(rate), Spread: money.MustParse(spread)}
+	}
+
+	// 0.70 and back at 1.45 returns 1.015 at market, 0.9748 less 2% each way
+	for _, tt := range []struct {
+		spread string
+		want   []string
+	}{
+		{"0", []string{"BDT>INR>BDT 1.01500000"}},
+		{"0.01", nil},
+		{"0.02", nil},
+	} {
+		graph, err := s.effectiveRates(map[string]models.ExchangeRate{
+			"BDT_INR": rate("BDT", "INR", "0.70", tt.spread),
+			"INR_BDT": rate("INR", "BDT", "1.45", tt.spread),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertLoops(t, findArbitrage(graph), tt.want...)
+	}
+}
+
+func TestSetRateRefusesArbitrage(t *testing.T) {
+	s := mockRateService(money.HalfUp)
+
+	// BDT to INR pays 0.686; back at 1.50 less 2% returns 1.00842
+	loops, err := s.SetRate("INR", "BDT", money.MustParse("1.50"), nil, false)
+	if !errors.Is(err, ErrArbitrage) {
+		t.Fatalf("err %v, want ErrArbitrage", err)
+	}
+	assertLoops(t, loops, "BDT>INR>BDT 1.00842000")
+
+	// Forcing saves it, still reporting the loop
+	loops, err = s.SetRate("INR", "BDT", money.MustParse("1.50"), nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertLoops(t, loops, "BDT>INR>BDT 1.00842000")
+
+	// A wider spread closes the loop
+	spread := money.MustParse("0.04")
+	loops, err = s.SetRate("INR", "BDT", money.MustParse("1.50"), &spread, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertLoops(t, loops)
+}
+
+func TestTierSpreadOpensLoop(t *testing.T) {
+	db := testDB(t)
+	clearTiers := func() {
+		if _, err := db.Exec(`DELETE FROM pricing_tiers WHERE from_currency IN ('XOA', 'XOB')`); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clearTiers()
+	t.Cleanup(clearTiers)
+	s := testRateService(t, db)
+
+	// 2.0000 less 1% and back at 0.5075 less 1% returns 0.9948
+	if _, err := s.SetRate("XOB", "XOA", money.MustParse("0.5075"), nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// A tier selling XOA without a spread makes it 1.00485
+	_, err := s.pricing.CreateTier(models.PricingTierRequest{FromCurrency: "XOA", ToCurrency: "XOB", Spread: money.MustParse("0")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := s.GetArbitrageReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertLoops(t, loopsThrough(report.Loops, "XOA", "XOB"), "XOA>XOB>XOA 1.00485000")
+
+	if _, err := s.SetRate("XOB", "XOA", money.MustParse("0.5075"), nil, false); !errors.Is(err, ErrArbitrage) {
+		t.Errorf("err %v, want ErrArbitrage", err)
+	}
+}
@@ -1,25 +1,61 @@
 package services
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"log"
 	"time"
 
+	"bdpayx-backend/internal/events"
+	"bdpayx-backend/internal/middleware"
 	"bdpayx-backend/internal/models"
 
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used; the session has been signed out")
+)
+
+const userColumns = `id, email, full_name, phone, is_verified, is_admin, created_at, updated_at`
+
+func scanUser(row rowScanner) (*models.User, error) {
+	var user models.User
+	err := row.Scan(&user.ID, &user.Email, &user.FullName, &user.Phone,
+		&user.IsVerified, &user.IsAdmin, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// AuthService signs users in. Each sign-in opens a session: a family of
+// refresh tokens, each usable once and replaced by the next, with
+// short-lived access tokens carrying the session's id.
 type AuthService struct {
-	db        *sql.DB
-	jwtSecret string
+	db          *sql.DB
+	jwtSecret   string
+	accessTTL   time.Duration
+	refreshTTL  time.Duration
+	revocations *RevocationList
+	publisher   events.Publisher
 }
 
-func NewAuthService(db *sql.DB, jwtSecret string) *AuthService {
+func NewAuthService(db *sql.DB, jwtSecret string, accessTTL, refreshTTL time.Duration, revocations *RevocationList, publisher events.Publisher) *AuthService {
 	return &AuthService{
-		db:        db,
-		jwtSecret: jwtSecret,
+		db:          db,
+		jwtSecret:   jwtSecret,
+		accessTTL:   accessTTL,
+		refreshTTL:  refreshTTL,
+		revocations: revocations,
+		publisher:   publisher,
 	}
 }
 
@@ -62,16 +98,7 @@ func (s *AuthService) Register(req models.RegisterRequest) (*models.AuthResponse
 		return nil, fmt.Errorf("failed to create wallet: %w", err)
 	}
 
-	// Generate JWT token
-	token, err := s.generateToken(user.ID, user.IsAdmin)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate token: %w", err)
-	}
-
-	return &models.AuthResponse{
-		Token: token,
-		User:  user,
-	}, nil
+	return s.startSession(user)
 }
 
 func (s *AuthService) Login(req models.LoginRequest) (*models.AuthResponse, error) {
@@ -96,42 +123,217 @@ func (s *AuthService) Login(req models.LoginRequest) (*models.AuthResponse, erro
 		return nil, fmt.Errorf("invalid email or password")
 	}
 
-	// Generate JWT token
-	token, err := s.generateToken(user.ID, user.IsAdmin)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate token: %w", err)
-	}
-
-	return &models.AuthResponse{
-		Token: token,
-		User:  user,
-	}, nil
+	return s.startSession(user)
 }
 
 func (s *AuthService) GetUserByID(userID int) (*models.User, error) {
-	var user models.User
-	err := s.db.QueryRow(`
-		SELECT id, email, full_name, phone, is_verified, is_admin, created_at, updated_at
-		FROM users WHERE id = $1`, userID).Scan(
-		&user.ID, &user.Email, &user.FullName, &user.Phone,
-		&user.IsVerified, &user.IsAdmin, &user.CreatedAt, &user.UpdatedAt)
+	user, err := scanUser(s.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = $1`, userID))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("user not found")
 		}
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
-	return &user, nil
+	return user, nil
+}
+
+// Refresh exchanges a refresh token for a new access and refresh token. A
+// token presented a second time means it was copied, so the whole session is
+// signed out and ErrRefreshTokenReused returned.
+func (s *AuthService) Refresh(refreshToken string) (*models.AuthResponse, error) {
+	var response *models.AuthResponse
+	var reusedIn string
+	err := runInTx(s.db, func(tx *sql.Tx) error {
+		response, reusedIn = nil, ""
+
+		var id, userID int
+		var familyID string
+		var used, revoked, expired bool
+		err := tx.QueryRow(`
+			SELECT id, user_id, family_id, used_at IS NOT NULL, revoked_at IS NOT NULL, expires_at < CURRENT_TIMESTAMP
+			FROM refresh_tokens WHERE token_hash = $1
+			FOR UPDATE`,
+			hashToken(refreshToken)).Scan(&id, &userID, &familyID, &used, &revoked, &expired)
+		if err == sql.ErrNoRows {
+			return ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get refresh token: %w", err)
+		}
+		if revoked || expired {
+			return ErrInvalidRefreshToken
+		}
+		if used {
+			reusedIn = familyID
+			return s.revokeSessions(tx, userID, familyID)
+		}
+
+		if _, err := tx.Exec(`UPDATE refresh_tokens SET used_at = CURRENT_TIMESTAMP WHERE id = $1`, id); err != nil {
+			return fmt.Errorf("failed to use refresh token: %w", err)
+		}
+		// Read the user again, so a changed admin flag takes effect
+		user, err := scanUser(tx.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = $1`, userID))
+		if err != nil {
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+		response, err = s.issueTokens(tx, *user, familyID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reusedIn != "" {
+		log.Printf("⚠️  Refresh token reused in session %s, session revoked", reusedIn)
+		return nil, ErrRefreshTokenReused
+	}
+	return response, nil
+}
+
+// Logout signs out one of a user's sessions.
+func (s *AuthService) Logout(userID int, sessionID string) error {
+	return runInTx(s.db, func(tx *sql.Tx) error {
+		return s.revokeSessions(tx, userID, sessionID)
+	})
+}
+
+// LogoutAll signs out every session of a user, on all devices.
+func (s *AuthService) LogoutAll(userID int) error {
+	return runInTx(s.db, func(tx *sql.Tx) error {
+		return s.revokeSessions(tx, userID, "")
+	})
+}
+
+// revokeSessions revokes the refresh tokens of one session, or of all the
+// user's sessions when sessionID is empty, and once committed rejects their
+// access tokens and drops their real-time connections.
+func (s *AuthService) revokeSessions(tx *sql.Tx, userID int, sessionID string) error {
+	rows, err := tx.Query(`
+		UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND ($2::text = '' OR family_id = $2) AND revoked_at IS NULL
+		RETURNING family_id`,
+		userID, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := make(map[string]bool)
+	if sessionID != "" {
+		sessions[sessionID] = true
+	}
+	for rows.Next() {
+		var familyID string
+		if err := rows.Scan(&familyID); err != nil {
+			return fmt.Errorf("failed to scan refresh token: %w", err)
+		}
+		sessions[familyID] = true
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	for familyID := range sessions {
+		familyID := familyID
+		afterCommit(tx, "session:"+familyID, func() {
+			s.revocations.Revoke(familyID, s.accessTTL)
+			publish(s.publisher, events.SessionRevoked, "", userID, events.SessionRevokedPayload{SessionID: familyID})
+		})
+	}
+	return nil
+}
+
+// StartSessionCleanup periodically deletes expired refresh tokens.
+func (s *AuthService) StartSessionCleanup() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		result, err := s.db.Exec(`DELETE FROM refresh_tokens WHERE expires_at < CURRENT_TIMESTAMP`)
+		if err != nil {
+			log.Printf("Error cleaning up refresh tokens: %v", err)
+			continue
+		}
+		if deleted, _ := result.RowsAffected(); deleted > 0 {
+			log.Printf("🧹 Removed %d expired refresh tokens", deleted)
+		}
+	}
+}
+
+// startSession opens a new session for a user who just signed in.
+func (s *AuthService) startSession(user models.User) (*models.AuthResponse, error) {
+	familyID, err := randomToken(16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate session id: %w", err)
+	}
+
+	var response *models.AuthResponse
+	err = runInTx(s.db, func(tx *sql.Tx) error {
+		var err error
+		response, err = s.issueTokens(tx, user, familyID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// issueTokens stores the next refresh token of a session and signs an access
+// token for it.
+func (s *AuthService) issueTokens(tx *sql.Tx, user models.User, sessionID string) (*models.AuthResponse, error) {
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, created_at, expires_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP + $4 * INTERVAL '1 second')`,
+		user.ID, sessionID, hashToken(refreshToken), int64(s.refreshTTL.Seconds()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	expiresAt := time.Now().Add(s.accessTTL)
+	token, err := s.generateToken(user.ID, user.IsAdmin, sessionID, expiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	return &models.AuthResponse{
+		Token:        token,
+		ExpiresAt:    expiresAt.UTC(),
+		RefreshToken: refreshToken,
+		User:         user,
+	}, nil
 }
 
-func (s *AuthService) generateToken(userID int, isAdmin bool) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id":  userID,
-		"is_admin": isAdmin,
-		"exp":      time.Now().Add(time.Hour * 24 * 7).Unix(), // 7 days
-		"iat":      time.Now().Unix(),
+func (s *AuthService) generateToken(userID int, isAdmin bool, sessionID string, expiresAt time.Time) (string, error) {
+	claims := middleware.Claims{
+		UserID:    userID,
+		IsAdmin:   isAdmin,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(s.jwtSecret))
-}
\ No newline at end of file
+}
+
+// randomToken returns n random bytes, URL-safe encoded.
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken is how refresh tokens are stored, so a leaked table cannot be
+// used to sign in.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
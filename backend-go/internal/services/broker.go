@@ -0,0 +1,96 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"bdpayx-backend/internal/events"
+)
+
+const (
+	// eventChannel is the Redis channel events travel on between nodes
+	eventChannel = "bdpayx:events"
+	// eventSeqPrefix prefixes the counter of each event stream
+	eventSeqPrefix = "bdpayx:events:seq:"
+)
+
+// NewEventBroker returns the broker selected by EVENT_BROKER: memory for a
+// single node, redis to fan events out across nodes. seqTTL is how long the
+// redis broker keeps the counter of an idle stream; it must cover the replay
+// window, or a resuming client could be handed numbers from a new count.
+func NewEventBroker(backend string, redis *RedisService, seqTTL time.Duration) (events.Broker, error) {
+	switch backend {
+	case "", "memory":
+		return events.NewMemoryBroker(), nil
+	case "redis":
+		if redis == nil {
+			return nil, fmt.Errorf("redis event broker requires a reachable REDIS_HOST")
+		}
+		return NewRedisBroker(redis, seqTTL)
+	default:
+		return nil, fmt.Errorf("unknown event broker: %s", backend)
+	}
+}
+
+// wireEvent is an event as it travels through Redis, still addressed to its
+// user.
+type wireEvent struct {
+	events.Event
+	UserID int `json:"user_id"`
+}
+
+// RedisBroker publishes events on a Redis channel every node subscribes to.
+// Events only reach local handlers through Redis, so each node, the
+// publishing one included, sees every event once. Streams are numbered by
+// counters in Redis, which survive restarts of any node and expire after
+// seqTTL without events.
+type RedisBroker struct {
+	redis  *RedisService
+	local  *events.MemoryBroker
+	seqTTL time.Duration
+}
+
+func NewRedisBroker(redis *RedisService, seqTTL time.Duration) (*RedisBroker, error) {
+	b := &RedisBroker{redis: redis, local: events.NewMemoryBroker(), seqTTL: seqTTL}
+	if err := redis.Subscribe(eventChannel, b.receive); err != nil {
+		return nil, fmt.Errorf("failed to subscribe to %s: %w", eventChannel, err)
+	}
+	return b, nil
+}
+
+func (b *RedisBroker) Publish(event events.Event) {
+	data, err := json.Marshal(wireEvent{Event: event, UserID: event.UserID})
+	if err != nil {
+		log.Printf("Error encoding %s event: %v", event.Type, err)
+		return
+	}
+	if _, err := b.redis.PublishSequenced(eventChannel, eventSeqPrefix+event.Stream(), string(data), b.seqTTL); err != nil {
+		log.Printf("Error publishing %s event: %v", event.Type, err)
+	}
+}
+
+func (b *RedisBroker) Subscribe(handler func(events.Event)) {
+	b.local.Subscribe(handler)
+}
+
+func (b *RedisBroker) receive(payload string) {
+	seqText, data, ok := strings.Cut(payload, "|")
+	seq, err := strconv.ParseInt(seqText, 10, 64)
+	if !ok || err != nil {
+		log.Printf("Error decoding event from %s: no sequence number", eventChannel)
+		return
+	}
+
+	var wire wireEvent
+	if err := json.Unmarshal([]byte(data), &wire); err != nil {
+		log.Printf("Error decoding event from %s: %v", eventChannel, err)
+		return
+	}
+	wire.Event.UserID = wire.UserID
+	wire.Event.Seq = seq
+	b.local.Publish(wire.Event)
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"bdpayx-backend/internal/events"
+)
+
+// testRedis connects to the Redis at REDIS_ADDR (host:port) and skips the
+// test when it is not set.
+func testRedis(t *testing.T) *RedisService {
+	t.Helper()
+
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR not set")
+	}
+	host, portText, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatalf("invalid REDIS_ADDR %q: %v", addr, err)
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil {
+		t.Fatalf("invalid REDIS_ADDR %q: %v", addr, err)
+	}
+	redis := NewRedisService(host, port, "")
+	if redis == nil {
+		t.Fatalf("cannot connect to %s", addr)
+	}
+	t.Cleanup(func() { redis.client.Close() })
+	return redis
+}
+
+// collector records the events a broker hands to its subscribers.
+type collector struct {
+	mu     sync.Mutex
+	events []events.Event
+}
+
+func (c *collector) add(event events.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, event)
+}
+
+func (c *collector) seqs(topic string) []int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var seqs []int64
+	for _, e := range c.events {
+		if e.Topic == topic {
+			seqs = append(seqs, e.Seq)
+		}
+	}
+	return seqs
+}
+
+func TestRedisBrokerSequencesAcrossNodes(t *testing.T) {
+	ttl := time.Minute
+	nodes := make([]*RedisBroker, 2)
+	received := make([]*collector, 2)
+	for i := range nodes {
+		broker, err := NewRedisBroker(testRedis(t), ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes[i], received[i] = broker, &collector{}
+		broker.Subscribe(received[i].add)
+	}
+
+	// A topic of its own, so reruns start counting from 1
+	topic := events.RatesTopic("T" + strconv.FormatInt(time.Now().UnixNano(), 36))
+	const published = 20
+	for i := 0; i < published; i++ {
+		event, err := events.New(events.RateUpdated, topic, 0, map[string]int{"n": i})
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes[i%2].Publish(event)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for _, c := range received {
+		for len(c.seqs(topic)) < published && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// Both nodes see one count, whichever node published
+	for i, c := range received {
+		seqs := c.seqs(topic)
+		if len(seqs) != published {
+			t.Fatalf("node %d received %d events, want %d", i, len(seqs), published)
+		}
+		for j, seq := range seqs {
+			if seq != int64(j+1) {
+				t.Fatalf("node %d received seqs %v, want 1 to %d in order", i, seqs, published)
+			}
+		}
+	}
+
+	key := eventSeqPrefix + events.StreamOf(topic, 0)
+	left, err := nodes[0].redis.client.PTTL(nodes[0].redis.ctx, key).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left <= 0 || left > ttl {
+		t.Errorf("seq counter expires in %s, want within %s", left, ttl)
+	}
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"bdpayx-backend/internal/models"
+	"bdpayx-backend/internal/money"
+)
+
+var (
+	ErrInvalidCurrency = errors.New("currency code must be three letters")
+	ErrCurrencyInUse   = errors.New("decimals cannot change while balances exist in the currency")
+)
+
+var currencyCodePattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+const currencyColumns = `code, name, symbol, decimals, enabled, created_at, updated_at`
+
+func scanCurrency(row rowScanner) (*models.Currency, error) {
+	var c models.Currency
+	err := row.Scan(&c.Code, &c.Name, &c.Symbol, &c.Decimals, &c.Enabled, &c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// defaultCurrencies stand in for the registry when there is no database
+// (test mode).
+var defaultCurrencies = []models.Currency{
+	{Code: "BDT", Name: "Bangladeshi Taka", Symbol: "৳", Decimals: 2, Enabled: true},
+	{Code: "INR", Name: "Indian Rupee", Symbol: "₹", Decimals: 2, Enabled: true},
+}
+
+// CurrencyService keeps the currency registry in memory, where request
+// validation and amount rounding read it, and in the currencies table.
+type CurrencyService struct {
+	db         *sql.DB
+	mu         sync.RWMutex
+	currencies map[string]models.Currency
+}
+
+func NewCurrencyService(db *sql.DB) *CurrencyService {
+	return &CurrencyService{db: db, currencies: make(map[string]models.Currency)}
+}
+
+// Load reads the registry and registers every currency's precision with the
+// money package.
+func (s *CurrencyService) Load() error {
+	list := defaultCurrencies
+	if s.db != nil {
+		rows, err := s.db.Query(`SELECT ` + currencyColumns + ` FROM currencies`)
+		if err != nil {
+			return fmt.Errorf("failed to get currencies: %w", err)
+		}
+		defer rows.Close()
+
+		list = nil
+		for rows.Next() {
+			c, err := scanCurrency(rows)
+			if err != nil {
+				return fmt.Errorf("failed to scan currency: %w", err)
+			}
+			list = append(list, *c)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to get currencies: %w", err)
+		}
+	}
+
+	for _, c := range list {
+		s.set(c)
+	}
+	return nil
+}
+
+func (s *CurrencyService) set(c models.Currency) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.currencies[c.Code] = c
+	money.SetDecimals(c.Code, c.Decimals)
+}
+
+// Enabled reports whether code is a registered currency that may be used in
+// requests.
+func (s *CurrencyService) Enabled(code string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.currencies[code]
+	return ok && c.Enabled
+}
+
+// GetCurrencies lists the registry in code order, without disabled
+// currencies unless all is set.
+func (s *CurrencyService) GetCurrencies(all bool) []models.Currency {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := []models.Currency{}
+	for _, c := range s.currencies {
+		if all || c.Enabled {
+			list = append(list, c)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Code < list[j].Code })
+	return list
+}
+
+// SaveCurrency adds a currency to the registry or changes one. The number of
+// decimals is fixed once any ledger account holds the currency, since stored
+// amounts were rounded to it.
+func (s *CurrencyService) SaveCurrency(code string, req models.CurrencyRequest) (*models.Currency, error) {
+	code = strings.ToUpper(code)
+	if !currencyCodePattern.MatchString(code) {
+		return nil, ErrInvalidCurrency
+	}
+
+	if s.db == nil {
+		c := models.Currency{Code: code, Name: req.Name, Symbol: req.Symbol, Decimals: req.Decimals, Enabled: req.Enabled}
+		s.set(c)
+		return &c, nil
+	}
+
+	var currency *models.Currency
+	err := runInTx(s.db, func(tx *sql.Tx) error {
+		var decimals int32
+		err := tx.QueryRow(`SELECT decimals FROM currencies WHERE code = $1 FOR UPDATE`, code).Scan(&decimals)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("failed to lock currency: %w", err)
+		}
+		if err == nil && decimals != req.Decimals {
+			var inUse bool
+			err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM ledger_accounts WHERE currency = $1)`, code).Scan(&inUse)
+			if err != nil {
+				return fmt.Errorf("failed to check currency accounts: %w", err)
+			}
+			if inUse {
+				return fmt.Errorf("%w: %s", ErrCurrencyInUse, code)
+			}
+		}
+
+		currency, err = scanCurrency(tx.QueryRow(`
+			INSERT INTO currencies (code, name, symbol, decimals, enabled, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+			ON CONFLICT (code) DO UPDATE
+			SET name = EXCLUDED.name, symbol = EXCLUDED.symbol, decimals = EXCLUDED.decimals,
+				enabled = EXCLUDED.enabled, updated_at = CURRENT_TIMESTAMP
+			RETURNING `+currencyColumns,
+			code, req.Name, req.Symbol, req.Decimals, req.Enabled))
+		if err != nil {
+			return fmt.Errorf("failed to save currency: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.set(*currency)
+	return currency, nil
+}
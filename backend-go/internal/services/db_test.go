@@ -0,0 +1,51 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"bdpayx-backend/internal/database"
+)
+
+// testDB connects to the Postgres named by TEST_DATABASE_URL, creating the
+// schema, and skips the test when it is not set. Tests share the database,
+// so they create their own users instead of cleaning up.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	db, err := database.Initialize(url)
+	if err != nil {
+		t.Fatalf("failed to initialize database: %v", err)
+	}
+	if db == nil {
+		t.Fatalf("cannot connect to %s", url)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// createTestUser registers a user with an empty wallet.
+func createTestUser(t *testing.T, db *sql.DB) int {
+	t.Helper()
+
+	var userID int
+	err := db.QueryRow(`
+		INSERT INTO users (email, password_hash, full_name)
+		VALUES ($1, '', 'Test User')
+		RETURNING id`,
+		fmt.Sprintf("test-%d@example.com", time.Now().UnixNano())).Scan(&userID)
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO wallets (user_id) VALUES ($1)`, userID); err != nil {
+		t.Fatalf("failed to create wallet: %v", err)
+	}
+	return userID
+}
@@ -0,0 +1,440 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+
+	"bdpayx-backend/internal/events"
+	"bdpayx-backend/internal/models"
+	"bdpayx-backend/internal/money"
+	"bdpayx-backend/internal/storage"
+)
+
+var (
+	ErrDepositNotFound          = errors.New("deposit request not found")
+	ErrDepositNotAllowed        = errors.New("deposit request cannot be changed in its current status")
+	ErrDepositOpen              = errors.New("you already have an open deposit request; wait for it to be reviewed or cancel it first")
+	ErrDepositMethodUnavailable = errors.New("deposit method is not available")
+	ErrProofTooLarge            = errors.New("payment proof is too large")
+	ErrProofType                = errors.New("payment proof must be a JPEG, PNG or WebP image or a PDF")
+)
+
+// depositCurrencies maps deposit methods to the currency they pay in.
+var depositCurrencies = map[string]string{
+	models.PayoutBkash:  "BDT",
+	models.PayoutNagad:  "BDT",
+	models.PayoutRocket: "BDT",
+	models.PayoutBank:   "INR",
+	models.PayoutUPI:    "INR",
+}
+
+var proofExtensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+}
+
+const depositColumns = `id, user_id, reference, currency, amount, method, instructions, status,
+	COALESCE(proof_key, ''), COALESCE(proof_content_type, ''), COALESCE(reject_reason, ''), processed_by, created_at, updated_at`
+
+func scanDeposit(row rowScanner) (*models.DepositRequest, error) {
+	var d models.DepositRequest
+	var processedBy sql.NullInt64
+	err := row.Scan(&d.ID, &d.UserID, &d.Reference, &d.Currency, &d.Amount, &d.Method,
+		&d.Instructions, &d.Status, &d.ProofKey, &d.ProofType, &d.RejectReason,
+		&processedBy, &d.CreatedAt, &d.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	d.HasProof = d.ProofKey != ""
+	if processedBy.Valid {
+		id := int(processedBy.Int64)
+		d.ProcessedBy = &id
+	}
+	return &d, nil
+}
+
+type DepositService struct {
+	db        *sql.DB
+	wallet    *WalletService
+	storage   storage.Storage
+	methods   map[string]models.DepositMethod
+	maxUpload int64
+	publisher events.Publisher
+}
+
+// NewDepositService offers the deposit methods that have instructions, i.e.
+// an account of ours to pay into. Proofs larger than maxUpload bytes are
+// refused.
+func NewDepositService(db *sql.DB, wallet *WalletService, store storage.Storage, instructions map[string]string, maxUpload int64, publisher events.Publisher) *DepositService {
+	methods := make(map[string]models.DepositMethod)
+	for method, text := range instructions {
+		currency, ok := depositCurrencies[method]
+		if !ok || text == "" {
+			continue
+		}
+		methods[method] = models.DepositMethod{Method: method, Currency: currency, Instructions: text}
+	}
+
+	return &DepositService{
+		db:        db,
+		wallet:    wallet,
+		storage:   store,
+		methods:   methods,
+		maxUpload: maxUpload,
+		publisher: publisher,
+	}
+}
+
+// notify sends d to its owner and the admin queue once tx commits.
+func (s *DepositService) notify(tx *sql.Tx, d *models.DepositRequest) {
+	afterCommit(tx, fmt.Sprintf("deposit:%d", d.ID), func() {
+		publish(s.publisher, events.DepositUpdated, events.TopicUserWallet, d.UserID, d)
+		publish(s.publisher, events.DepositUpdated, events.TopicAdminQueue, 0, d)
+	})
+}
+
+// GetMethods lists the available deposit methods.
+func (s *DepositService) GetMethods() []models.DepositMethod {
+	methods := make([]models.DepositMethod, 0, len(s.methods))
+	for _, m := range s.methods {
+		methods = append(methods, m)
+	}
+	sort.Slice(methods, func(i, j int) bool { return methods[i].Method < methods[j].Method })
+	return methods
+}
+
+// CreateDeposit records a deposit intent and returns the reference the user
+// must quote with their payment, along with where to pay. A user can only
+// have one open deposit at a time.
+func (s *DepositService) CreateDeposit(userID int, req models.WalletDepositRequest) (*models.DepositRequest, error) {
+	method, ok := s.methods[req.Method]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrDepositMethodUnavailable, req.Method)
+	}
+	if req.Currency != method.Currency {
+		return nil, fmt.Errorf("%w: %s deposits are in %s", ErrDepositMethodUnavailable, req.Method, method.Currency)
+	}
+	amount := money.Of(req.Amount, req.Currency)
+	if err := amount.Validate(); err != nil {
+		return nil, err
+	}
+
+	reference, err := depositReference()
+	if err != nil {
+		return nil, err
+	}
+
+	var deposit *models.DepositRequest
+	err = runInTx(s.db, func(tx *sql.Tx) error {
+		// The wallet lock serializes concurrent requests of the same user
+		if _, err := s.wallet.lockWallet(tx, userID); err != nil {
+			return err
+		}
+
+		var open int
+		err := tx.QueryRow(`
+			SELECT COUNT(*) FROM deposit_requests
+			WHERE user_id = $1 AND status IN ($2, $3)`,
+			userID, models.DepositPending, models.DepositSubmitted).Scan(&open)
+		if err != nil {
+			return fmt.Errorf("failed to check open deposits: %w", err)
+		}
+		if open > 0 {
+			return ErrDepositOpen
+		}
+
+		deposit, err = scanDeposit(tx.QueryRow(`
+			INSERT INTO deposit_requests (user_id, reference, currency, amount, method, instructions, status, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+			RETURNING `+depositColumns,
+			userID, reference, req.Currency, req.Amount, req.Method, method.Instructions, models.DepositPending))
+		if err != nil {
+			return fmt.Errorf("failed to create deposit request: %w", err)
+		}
+		s.notify(tx, deposit)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return deposit, nil
+}
+
+// UploadProof stores the payment proof of an open deposit and submits it for
+// review. Uploading again replaces the previous proof.
+func (s *DepositService) UploadProof(userID, depositID int, r io.Reader) (*models.DepositRequest, error) {
+	data, err := io.ReadAll(io.LimitReader(r, s.maxUpload+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read payment proof: %w", err)
+	}
+	if int64(len(data)) > s.maxUpload {
+		return nil, fmt.Errorf("%w: limit is %d bytes", ErrProofTooLarge, s.maxUpload)
+	}
+	contentType := http.DetectContentType(data)
+	ext, ok := proofExtensions[contentType]
+	if !ok {
+		return nil, ErrProofType
+	}
+
+	deposit, err := s.userDeposit(userID, depositID)
+	if err != nil {
+		return nil, err
+	}
+	if deposit.Status != models.DepositPending && deposit.Status != models.DepositSubmitted {
+		return nil, fmt.Errorf("%w: %s", ErrDepositNotAllowed, deposit.Status)
+	}
+
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, fmt.Errorf("failed to generate file name: %w", err)
+	}
+	key := fmt.Sprintf("deposit-proofs/%d/%s-%s%s", userID, deposit.Reference, hex.EncodeToString(suffix), ext)
+	if err := s.storage.Put(key, bytes.NewReader(data), contentType); err != nil {
+		return nil, err
+	}
+
+	var previous string
+	deposit, err = s.update(depositID, func(tx *sql.Tx, d *models.DepositRequest) (*models.DepositRequest, error) {
+		previous = d.ProofKey
+		if d.UserID != userID {
+			return nil, ErrDepositNotFound
+		}
+		if d.Status != models.DepositPending && d.Status != models.DepositSubmitted {
+			return nil, fmt.Errorf("%w: %s", ErrDepositNotAllowed, d.Status)
+		}
+		d, err := scanDeposit(tx.QueryRow(`
+			UPDATE deposit_requests
+			SET proof_key = $1, proof_content_type = $2, status = $3, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $4
+			RETURNING `+depositColumns,
+			key, contentType, models.DepositSubmitted, depositID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to attach payment proof: %w", err)
+		}
+		return d, nil
+	})
+	// Whichever file is no longer referenced goes: the new one when the
+	// deposit could not take it, otherwise the one it replaced
+	if err != nil {
+		s.deleteProof(key)
+		return nil, err
+	}
+	if previous != "" {
+		s.deleteProof(previous)
+	}
+	return deposit, nil
+}
+
+func (s *DepositService) deleteProof(key string) {
+	if err := s.storage.Delete(key); err != nil {
+		log.Printf("Error deleting payment proof %s: %v", key, err)
+	}
+}
+
+// GetProof opens the payment proof of a deposit for review.
+func (s *DepositService) GetProof(depositID int) (io.ReadCloser, string, error) {
+	deposit, err := scanDeposit(s.db.QueryRow(`
+		SELECT `+depositColumns+` FROM deposit_requests WHERE id = $1`, depositID))
+	if err == sql.ErrNoRows {
+		return nil, "", ErrDepositNotFound
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get deposit request: %w", err)
+	}
+	return s.openProof(deposit)
+}
+
+// GetUserProof opens the payment proof of one of the user's deposits.
+func (s *DepositService) GetUserProof(userID, depositID int) (io.ReadCloser, string, error) {
+	deposit, err := s.userDeposit(userID, depositID)
+	if err != nil {
+		return nil, "", err
+	}
+	return s.openProof(deposit)
+}
+
+func (s *DepositService) openProof(deposit *models.DepositRequest) (io.ReadCloser, string, error) {
+	if !deposit.HasProof {
+		return nil, "", storage.ErrNotFound
+	}
+
+	r, err := s.storage.Get(deposit.ProofKey)
+	if err != nil {
+		return nil, "", err
+	}
+	return r, deposit.ProofType, nil
+}
+
+func (s *DepositService) GetUserDeposits(userID, limit, offset int) ([]models.DepositRequest, error) {
+	return s.list(`WHERE user_id = $1`, userID, limit, offset)
+}
+
+// GetDeposits lists all deposit requests for admins, optionally filtered by
+// status.
+func (s *DepositService) GetDeposits(status string, limit, offset int) ([]models.DepositRequest, error) {
+	return s.list(`WHERE ($1 = '' OR status = $1)`, status, limit, offset)
+}
+
+func (s *DepositService) list(where string, arg interface{}, limit, offset int) ([]models.DepositRequest, error) {
+	rows, err := s.db.Query(`
+		SELECT `+depositColumns+`
+		FROM deposit_requests
+		`+where+`
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3`,
+		arg, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deposit requests: %w", err)
+	}
+	defer rows.Close()
+
+	deposits := []models.DepositRequest{}
+	for rows.Next() {
+		d, err := scanDeposit(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan deposit request: %w", err)
+		}
+		deposits = append(deposits, *d)
+	}
+
+	return deposits, nil
+}
+
+// CancelDeposit lets a user drop their own deposit before it is reviewed.
+func (s *DepositService) CancelDeposit(userID, depositID int) (*models.DepositRequest, error) {
+	return s.update(depositID, func(tx *sql.Tx, d *models.DepositRequest) (*models.DepositRequest, error) {
+		if d.UserID != userID {
+			return nil, ErrDepositNotFound
+		}
+		if d.Status != models.DepositPending && d.Status != models.DepositSubmitted {
+			return nil, fmt.Errorf("%w: %s", ErrDepositNotAllowed, d.Status)
+		}
+		return setDepositStatus(tx, d.ID, models.DepositCancelled, nil, "")
+	})
+}
+
+// ApproveDeposit credits the wallet with a deposit whose proof has been
+// checked.
+func (s *DepositService) ApproveDeposit(depositID, adminID int) (*models.DepositRequest, error) {
+	return s.update(depositID, func(tx *sql.Tx, d *models.DepositRequest) (*models.DepositRequest, error) {
+		if d.Status != models.DepositSubmitted {
+			return nil, fmt.Errorf("%w: %s", ErrDepositNotAllowed, d.Status)
+		}
+		return s.approve(tx, d, &adminID, "")
+	})
+}
+
+// approve credits a locked deposit and closes it. processedBy is nil when
+// the deposit was matched automatically.
+func (s *DepositService) approve(tx *sql.Tx, d *models.DepositRequest, processedBy *int, note string) (*models.DepositRequest, error) {
+	description := fmt.Sprintf("Deposit %s via %s", d.Reference, d.Method)
+	if note != "" {
+		description += " (" + note + ")"
+	}
+	err := s.wallet.credit(tx, d.UserID, money.Of(d.Amount, d.Currency), "deposit",
+		fmt.Sprintf("deposit:%d", d.ID), description)
+	if err != nil {
+		return nil, err
+	}
+
+	approved, err := setDepositStatus(tx, d.ID, models.DepositApproved, processedBy, "")
+	if err != nil {
+		return nil, err
+	}
+	// Matched payments approve outside update
+	s.notify(tx, approved)
+	return approved, nil
+}
+
+// RejectDeposit closes an open deposit without crediting anything.
+func (s *DepositService) RejectDeposit(depositID, adminID int, reason string) (*models.DepositRequest, error) {
+	return s.update(depositID, func(tx *sql.Tx, d *models.DepositRequest) (*models.DepositRequest, error) {
+		if d.Status != models.DepositPending && d.Status != models.DepositSubmitted {
+			return nil, fmt.Errorf("%w: %s", ErrDepositNotAllowed, d.Status)
+		}
+		return setDepositStatus(tx, d.ID, models.DepositRejected, &adminID, reason)
+	})
+}
+
+func (s *DepositService) userDeposit(userID, depositID int) (*models.DepositRequest, error) {
+	deposit, err := scanDeposit(s.db.QueryRow(`
+		SELECT `+depositColumns+`
+		FROM deposit_requests WHERE id = $1 AND user_id = $2`, depositID, userID))
+	if err == sql.ErrNoRows {
+		return nil, ErrDepositNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deposit request: %w", err)
+	}
+	return deposit, nil
+}
+
+// update locks a deposit request and applies fn to it in one transaction.
+func (s *DepositService) update(depositID int, fn func(tx *sql.Tx, d *models.DepositRequest) (*models.DepositRequest, error)) (*models.DepositRequest, error) {
+	var deposit *models.DepositRequest
+
+	err := runInTx(s.db, func(tx *sql.Tx) error {
+		d, err := scanDeposit(tx.QueryRow(`
+			SELECT `+depositColumns+`
+			FROM deposit_requests WHERE id = $1 FOR UPDATE`, depositID))
+		if err == sql.ErrNoRows {
+			return ErrDepositNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to lock deposit request: %w", err)
+		}
+
+		deposit, err = fn(tx, d)
+		if err != nil {
+			return err
+		}
+		s.notify(tx, deposit)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return deposit, nil
+}
+
+func setDepositStatus(tx *sql.Tx, depositID int, status string, processedBy *int, rejectReason string) (*models.DepositRequest, error) {
+	d, err := scanDeposit(tx.QueryRow(`
+		UPDATE deposit_requests
+		SET status = $1,
+			processed_by = COALESCE($2, processed_by),
+			reject_reason = COALESCE(NULLIF($3, ''), reject_reason),
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4
+		RETURNING `+depositColumns,
+		status, processedBy, rejectReason, depositID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update deposit request: %w", err)
+	}
+	return d, nil
+}
+
+// depositReference returns a reference such as DEP7K2M9QXA that users quote
+// in their payment note.
+func depositReference() (string, error) {
+	const alphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate deposit reference: %w", err)
+	}
+	for i := range b {
+		b[i] = alphabet[int(b[i])%len(alphabet)]
+	}
+	return "DEP" + string(b), nil
+}
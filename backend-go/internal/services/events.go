@@ -0,0 +1,19 @@
+package services
+
+import (
+	"log"
+
+	"bdpayx-backend/internal/events"
+)
+
+// publish pushes an event to connected clients. Callers publish from
+// afterCommit hooks, so clients never hear of changes that rolled back. An
+// event that cannot be built is logged rather than failing the change.
+func publish(p events.Publisher, eventType, topic string, userID int, payload interface{}) {
+	event, err := events.New(eventType, topic, userID, payload)
+	if err != nil {
+		log.Printf("Error building %s event: %v", eventType, err)
+		return
+	}
+	p.Publish(event)
+}
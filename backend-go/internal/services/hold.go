@@ -0,0 +1,341 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"bdpayx-backend/internal/ledger"
+	"bdpayx-backend/internal/models"
+	"bdpayx-backend/internal/money"
+)
+
+var (
+	ErrHoldNotFound  = errors.New("hold not found")
+	ErrHoldNotActive = errors.New("hold is no longer active")
+)
+
+const holdColumns = `id, user_id, currency, amount, status, reference, COALESCE(description, ''), expires_at, created_at, updated_at`
+
+func scanHold(row rowScanner) (*models.WalletHold, error) {
+	var h models.WalletHold
+	var expiresAt sql.NullTime
+	err := row.Scan(&h.ID, &h.UserID, &h.Currency, &h.Amount, &h.Status,
+		&h.Reference, &h.Description, &expiresAt, &h.CreatedAt, &h.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		h.ExpiresAt = &expiresAt.Time
+	}
+	return &h, nil
+}
+
+// CreateHold moves amount from the available balance into the held balance.
+// A ttl of zero keeps the hold until it is captured or released.
+func (s *WalletService) CreateHold(userID int, amount money.Money, reference, description string, ttl time.Duration) (*models.WalletHold, error) {
+	if err := amount.Validate(); err != nil {
+		return nil, err
+	}
+
+	var hold *models.WalletHold
+	err := runInTx(s.db, func(tx *sql.Tx) error {
+		var err error
+		hold, err = s.createHold(tx, userID, amount, reference, description, ttl)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// CaptureHold spends held funds: they leave the wallet for platform cash,
+// e.g. once a withdrawal has been paid out.
+func (s *WalletService) CaptureHold(holdID int, description string) error {
+	return runInTx(s.db, func(tx *sql.Tx) error {
+		hold, err := lockHold(tx, holdID)
+		if err != nil {
+			return err
+		}
+		return s.captureToCash(tx, hold, description)
+	})
+}
+
+// ReleaseHold returns held funds to the available balance.
+func (s *WalletService) ReleaseHold(holdID int, description string) error {
+	return runInTx(s.db, func(tx *sql.Tx) error {
+		hold, err := lockHold(tx, holdID)
+		if err != nil {
+			return err
+		}
+		return s.releaseHold(tx, hold, models.HoldReleased, description)
+	})
+}
+
+// GetHolds lists a user's holds, newest first. An empty status lists all.
+func (s *WalletService) GetHolds(userID int, status string) ([]models.WalletHold, error) {
+	rows, err := s.db.Query(`
+		SELECT `+holdColumns+`
+		FROM wallet_holds
+		WHERE user_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC`,
+		userID, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wallet holds: %w", err)
+	}
+	defer rows.Close()
+
+	holds := []models.WalletHold{}
+	for rows.Next() {
+		h, err := scanHold(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan wallet hold: %w", err)
+		}
+		holds = append(holds, *h)
+	}
+
+	return holds, nil
+}
+
+// ExpireHolds releases every active hold whose expiry has passed.
+func (s *WalletService) ExpireHolds() (int, error) {
+	rows, err := s.db.Query(`
+		SELECT id FROM wallet_holds
+		WHERE status = $1 AND expires_at < CURRENT_TIMESTAMP`, models.HoldActive)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find expired holds: %w", err)
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan expired hold: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	expired := 0
+	for _, id := range ids {
+		err := runInTx(s.db, func(tx *sql.Tx) error {
+			hold, err := lockHold(tx, id)
+			if err != nil {
+				return err
+			}
+			return s.releaseHold(tx, hold, models.HoldExpired, "Hold expired")
+		})
+		// Captured or released since the query ran
+		if errors.Is(err, ErrHoldNotActive) {
+			continue
+		}
+		if err != nil {
+			return expired, err
+		}
+		expired++
+	}
+
+	return expired, nil
+}
+
+func (s *WalletService) StartHoldExpiry() {
+	log.Println("⏳ Starting wallet hold expiry...")
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if expired, err := s.ExpireHolds(); err != nil {
+			log.Printf("Error expiring wallet holds: %v", err)
+		} else if expired > 0 {
+			log.Printf("⏳ Released %d expired wallet holds", expired)
+		}
+	}
+}
+
+func (s *WalletService) createHold(tx *sql.Tx, userID int, amount money.Money, reference, description string, ttl time.Duration) (*models.WalletHold, error) {
+	walletID, err := s.lockWallet(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := s.ledger.UserAccount(tx, userID, amount.Currency)
+	if err != nil {
+		return nil, err
+	}
+	held, err := s.ledger.HeldAccount(tx, userID, amount.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.ledger.Post(tx, ledger.Entry{
+		Kind:        "hold",
+		Reference:   reference,
+		Description: description,
+		Postings: []ledger.Posting{
+			{AccountID: account.ID, Amount: amount.Amount.Neg()},
+			{AccountID: held.ID, Amount: amount.Amount},
+		},
+	})
+	if err != nil {
+		return nil, walletError(err)
+	}
+
+	var ttlSeconds sql.NullFloat64
+	if ttl > 0 {
+		ttlSeconds = sql.NullFloat64{Float64: ttl.Seconds(), Valid: true}
+	}
+	hold, err := scanHold(tx.QueryRow(`
+		INSERT INTO wallet_holds (user_id, wallet_id, currency, amount, status, reference, description, expires_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, CURRENT_TIMESTAMP + $8 * INTERVAL '1 second', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		RETURNING `+holdColumns,
+		userID, walletID, amount.Currency, amount.Amount, models.HoldActive, reference, description, ttlSeconds))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create wallet hold: %w", err)
+	}
+
+	if err := s.recordHistory(tx, walletID, "hold", amount.Amount, amount.Currency,
+		result.Balances[account.ID], description, result.EntryID); err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// captureHold debits the held amount against the given counter postings,
+// which must balance it, and marks the hold captured.
+func (s *WalletService) captureHold(tx *sql.Tx, hold *models.WalletHold, kind, description string, counter []ledger.Posting) (*ledger.Result, error) {
+	walletID, err := s.lockWallet(tx, hold.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := s.ledger.UserAccount(tx, hold.UserID, hold.Currency)
+	if err != nil {
+		return nil, err
+	}
+	held, err := s.ledger.HeldAccount(tx, hold.UserID, hold.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	postings := append([]ledger.Posting{{AccountID: held.ID, Amount: hold.Amount.Neg()}}, counter...)
+	result, err := s.ledger.Post(tx, ledger.Entry{
+		Kind:        kind,
+		Reference:   hold.Reference,
+		Description: description,
+		Postings:    postings,
+	})
+	if err != nil {
+		return nil, walletError(err)
+	}
+
+	if err := setHoldStatus(tx, hold.ID, models.HoldCaptured); err != nil {
+		return nil, err
+	}
+
+	// Capturing does not change the available balance
+	if err := s.recordHistory(tx, walletID, "hold_capture", hold.Amount, hold.Currency,
+		account.Balance, description, result.EntryID); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *WalletService) captureToCash(tx *sql.Tx, hold *models.WalletHold, description string) error {
+	cash, err := s.ledger.PlatformAccount(tx, ledger.PlatformCash, hold.Currency)
+	if err != nil {
+		return err
+	}
+	_, err = s.captureHold(tx, hold, "hold_capture", description, []ledger.Posting{
+		{AccountID: cash.ID, Amount: hold.Amount},
+	})
+	return err
+}
+
+// releaseHold returns the held amount to the wallet and closes the hold with
+// status released or expired.
+func (s *WalletService) releaseHold(tx *sql.Tx, hold *models.WalletHold, status, description string) error {
+	walletID, err := s.lockWallet(tx, hold.UserID)
+	if err != nil {
+		return err
+	}
+
+	account, err := s.ledger.UserAccount(tx, hold.UserID, hold.Currency)
+	if err != nil {
+		return err
+	}
+	held, err := s.ledger.HeldAccount(tx, hold.UserID, hold.Currency)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.ledger.Post(tx, ledger.Entry{
+		Kind:        "hold_" + status,
+		Reference:   hold.Reference,
+		Description: description,
+		Postings: []ledger.Posting{
+			{AccountID: held.ID, Amount: hold.Amount.Neg()},
+			{AccountID: account.ID, Amount: hold.Amount},
+		},
+	})
+	if err != nil {
+		return walletError(err)
+	}
+
+	if err := setHoldStatus(tx, hold.ID, status); err != nil {
+		return err
+	}
+
+	transactionType := "hold_release"
+	if status == models.HoldExpired {
+		transactionType = "hold_expire"
+	}
+	return s.recordHistory(tx, walletID, transactionType, hold.Amount, hold.Currency,
+		result.Balances[account.ID], description, result.EntryID)
+}
+
+// lockHold locks an active hold for the rest of tx.
+func lockHold(tx *sql.Tx, holdID int) (*models.WalletHold, error) {
+	return lockActiveHold(tx, `id = $1`, holdID)
+}
+
+// lockHoldByReference locks the active hold placed for a reference, such as
+// an exchange order.
+func lockHoldByReference(tx *sql.Tx, reference string) (*models.WalletHold, error) {
+	return lockActiveHold(tx, `reference = $1 AND status = 'active'`, reference)
+}
+
+func lockActiveHold(tx *sql.Tx, where string, arg interface{}) (*models.WalletHold, error) {
+	hold, err := scanHold(tx.QueryRow(`
+		SELECT `+holdColumns+`
+		FROM wallet_holds
+		WHERE `+where+`
+		ORDER BY id
+		LIMIT 1
+		FOR UPDATE`, arg))
+	if err == sql.ErrNoRows {
+		return nil, ErrHoldNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock wallet hold: %w", err)
+	}
+	if hold.Status != models.HoldActive {
+		return nil, fmt.Errorf("%w: hold %d is %s", ErrHoldNotActive, hold.ID, hold.Status)
+	}
+	return hold, nil
+}
+
+func setHoldStatus(tx *sql.Tx, holdID int, status string) error {
+	_, err := tx.Exec(`
+		UPDATE wallet_holds
+		SET status = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2`,
+		status, holdID)
+	if err != nil {
+		return fmt.Errorf("failed to update wallet hold: %w", err)
+	}
+	return nil
+}
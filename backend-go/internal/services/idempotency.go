@@ -0,0 +1,131 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"bdpayx-backend/internal/models"
+)
+
+type IdempotencyService struct {
+	db          *sql.DB
+	redisClient *RedisService
+	ttl         time.Duration
+}
+
+func NewIdempotencyService(db *sql.DB, redisClient *RedisService, ttl time.Duration) *IdempotencyService {
+	return &IdempotencyService{
+		db:          db,
+		redisClient: redisClient,
+		ttl:         ttl,
+	}
+}
+
+func idempotencyCacheKey(userID int, key string) string {
+	return fmt.Sprintf("idempotency:%d:%s", userID, key)
+}
+
+// Reserve claims key for the user. It returns nil when the caller now owns
+// the key and should process the request, or the existing record when the
+// key was used before and has not expired.
+func (s *IdempotencyService) Reserve(userID int, key, requestHash string) (*models.IdempotencyRecord, error) {
+	// Completed responses are cached in Redis when it is configured
+	if cached, err := s.redisClient.Get(idempotencyCacheKey(userID, key)); err == nil {
+		var record models.IdempotencyRecord
+		if err := json.Unmarshal([]byte(cached), &record); err == nil {
+			return &record, nil
+		}
+	}
+
+	// Insert the key, or take over an expired one
+	result, err := s.db.Exec(`
+		INSERT INTO idempotency_keys (user_id, key, request_hash, created_at, expires_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP + $4 * INTERVAL '1 second')
+		ON CONFLICT (user_id, key) DO UPDATE
+		SET request_hash = EXCLUDED.request_hash, status_code = NULL, response_body = NULL,
+			created_at = EXCLUDED.created_at, expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at < CURRENT_TIMESTAMP`,
+		userID, key, requestHash, int64(s.ttl.Seconds()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 1 {
+		return nil, nil
+	}
+
+	var record models.IdempotencyRecord
+	var statusCode sql.NullInt64
+	var body sql.NullString
+	err = s.db.QueryRow(`
+		SELECT request_hash, status_code, response_body
+		FROM idempotency_keys WHERE user_id = $1 AND key = $2`,
+		userID, key).Scan(&record.RequestHash, &statusCode, &body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+	record.Completed = statusCode.Valid
+	record.StatusCode = int(statusCode.Int64)
+	record.Body = []byte(body.String)
+
+	return &record, nil
+}
+
+// Complete stores the response of the request that owns key.
+func (s *IdempotencyService) Complete(userID int, key string, requestHash string, statusCode int, body []byte) error {
+	_, err := s.db.Exec(`
+		UPDATE idempotency_keys
+		SET status_code = $1, response_body = $2
+		WHERE user_id = $3 AND key = $4`,
+		statusCode, string(body), userID, key)
+	if err != nil {
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+
+	record, err := json.Marshal(models.IdempotencyRecord{
+		RequestHash: requestHash,
+		Completed:   true,
+		StatusCode:  statusCode,
+		Body:        body,
+	})
+	if err == nil {
+		s.redisClient.Set(idempotencyCacheKey(userID, key), record, s.ttl)
+	}
+
+	return nil
+}
+
+// Release frees key so that a retry is processed again, e.g. after the
+// original request failed with a server error.
+func (s *IdempotencyService) Release(userID int, key string) error {
+	_, err := s.db.Exec("DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2", userID, key)
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+func (s *IdempotencyService) DeleteExpired() (int64, error) {
+	result, err := s.db.Exec("DELETE FROM idempotency_keys WHERE expires_at < CURRENT_TIMESTAMP")
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency keys: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+func (s *IdempotencyService) StartCleanup() {
+	log.Println("🧹 Starting idempotency key cleanup...")
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if deleted, err := s.DeleteExpired(); err != nil {
+			log.Printf("Error cleaning up idempotency keys: %v", err)
+		} else if deleted > 0 {
+			log.Printf("🧹 Removed %d expired idempotency keys", deleted)
+		}
+	}
+}
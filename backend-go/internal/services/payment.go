@@ -0,0 +1,421 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"bdpayx-backend/internal/models"
+	"bdpayx-backend/internal/money"
+	"bdpayx-backend/internal/payments"
+)
+
+var (
+	ErrDuplicatePayment    = errors.New("payment with this transaction ID was already recorded")
+	ErrPaymentNotFound     = errors.New("payment not found")
+	ErrPaymentResolved     = errors.New("payment is already matched or resolved")
+	ErrReconcileTarget     = errors.New("give exactly one of deposit_id or transaction_id")
+	ErrPaymentDoesNotMatch = errors.New("payment does not match the chosen deposit or transaction")
+)
+
+// Targets of a matched payment
+const (
+	matchDeposit     = "deposit"
+	matchTransaction = "transaction"
+)
+
+var depositReferencePattern = regexp.MustCompile(`\bDEP[A-Z2-9]{8}\b`)
+
+const paymentColumns = `id, provider, trx_id, currency, amount, COALESCE(sender, ''), COALESCE(reference, ''), sms_body, received_at,
+	status, COALESCE(matched_type, ''), matched_id, COALESCE(note, ''), resolved_by, created_at, updated_at`
+
+func scanPayment(row rowScanner) (*models.IncomingPayment, error) {
+	var p models.IncomingPayment
+	var matchedID, resolvedBy sql.NullInt64
+	err := row.Scan(&p.ID, &p.Provider, &p.TrxID, &p.Currency, &p.Amount, &p.Sender, &p.Reference,
+		&p.SMSBody, &p.ReceivedAt, &p.Status, &p.MatchedType, &matchedID, &p.Note, &resolvedBy,
+		&p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if matchedID.Valid {
+		id := int(matchedID.Int64)
+		p.MatchedID = &id
+	}
+	if resolvedBy.Valid {
+		id := int(resolvedBy.Int64)
+		p.ResolvedBy = &id
+	}
+	return &p, nil
+}
+
+// PaymentService records mobile-money payments reported by SMS and matches
+// them to open deposit requests and exchange orders.
+type PaymentService struct {
+	db           *sql.DB
+	deposits     *DepositService
+	transactions *TransactionService
+	window       time.Duration
+}
+
+// NewPaymentService matches payments against deposits and orders placed at
+// most window before the money was received.
+func NewPaymentService(db *sql.DB, deposits *DepositService, transactions *TransactionService, window time.Duration) *PaymentService {
+	return &PaymentService{
+		db:           db,
+		deposits:     deposits,
+		transactions: transactions,
+		window:       window,
+	}
+}
+
+// ProcessSMS parses a forwarded SMS and records the payment it reports. The
+// payment is matched to a deposit by the reference the payer quoted, or else
+// to the only open deposit or order of the same amount placed within the
+// match window before the SMS was received. Anything else is left unmatched for an admin. Errors from the
+// payments package mean the SMS was not a payment and nothing was stored.
+func (s *PaymentService) ProcessSMS(smsSender, body string, receivedAt *time.Time) (*models.IncomingPayment, error) {
+	parsed, err := payments.Parse(smsSender, body)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Reference == "" || !depositReferencePattern.MatchString(strings.ToUpper(parsed.Reference)) {
+		parsed.Reference = depositReferencePattern.FindString(strings.ToUpper(body))
+	}
+
+	// received_at is stored in the database's local time like created_at, and
+	// a phone clock running ahead cannot date the money into the future
+	var payment *models.IncomingPayment
+	err = runInTx(s.db, func(tx *sql.Tx) error {
+		var err error
+		payment, err = scanPayment(tx.QueryRow(`
+			INSERT INTO incoming_payments (provider, trx_id, currency, amount, sender, reference, sms_sender, sms_body, received_at, status, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7, $8, LEAST(COALESCE($9::TIMESTAMPTZ::TIMESTAMP, CURRENT_TIMESTAMP), CURRENT_TIMESTAMP), $10, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+			ON CONFLICT (provider, trx_id) DO NOTHING
+			RETURNING `+paymentColumns,
+			parsed.Provider, parsed.TrxID, parsed.Currency, parsed.Amount, parsed.Sender, parsed.Reference,
+			smsSender, body, receivedAt, models.PaymentUnmatched))
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%w: %s %s", ErrDuplicatePayment, parsed.Provider, parsed.TrxID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to record payment: %w", err)
+		}
+
+		matched, err := s.match(tx, payment)
+		if err != nil {
+			return err
+		}
+		if matched != nil {
+			payment = matched
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return payment, nil
+}
+
+// match tries the automatic matching rules and returns the updated payment,
+// or nil if it stays unmatched.
+func (s *PaymentService) match(tx *sql.Tx, p *models.IncomingPayment) (*models.IncomingPayment, error) {
+	note := fmt.Sprintf("%s TrxID %s", p.Provider, p.TrxID)
+
+	deposit, err := s.findDeposit(tx, p)
+	if err != nil {
+		return nil, err
+	}
+	if deposit != nil {
+		if _, err := s.deposits.approve(tx, deposit, nil, "auto-matched "+note); err != nil {
+			return nil, err
+		}
+		return resolvePayment(tx, p.ID, models.PaymentMatched, matchDeposit, deposit.ID, nil, "")
+	}
+	// A quoted reference names a deposit; if it does not fit, an admin decides
+	if p.Reference != "" {
+		return nil, nil
+	}
+
+	transactionID, err := s.findTransaction(tx, p)
+	if err != nil {
+		return nil, err
+	}
+	if transactionID != 0 {
+		if err := s.payTransaction(tx, transactionID, SystemActor, p, "Payment received: "+note); err != nil {
+			return nil, err
+		}
+		return resolvePayment(tx, p.ID, models.PaymentMatched, matchTransaction, transactionID, nil, "")
+	}
+
+	return nil, nil
+}
+
+// findDeposit locks the open deposit a payment belongs to: the one with the
+// quoted reference, or else the only one of the same method and amount
+// opened within the match window before the payment was received.
+func (s *PaymentService) findDeposit(tx *sql.Tx, p *models.IncomingPayment) (*models.DepositRequest, error) {
+	var rows *sql.Rows
+	var err error
+	if p.Reference != "" {
+		rows, err = tx.Query(`
+			SELECT `+depositColumns+`
+			FROM deposit_requests
+			WHERE reference = $1 AND status IN ($2, $3) AND method = $4 AND currency = $5 AND amount = $6
+			FOR UPDATE`,
+			p.Reference, models.DepositPending, models.DepositSubmitted, p.Provider, p.Currency, p.Amount)
+	} else {
+		rows, err = tx.Query(`
+			SELECT `+depositColumns+`
+			FROM deposit_requests
+			WHERE status IN ($1, $2) AND method = $3 AND currency = $4 AND amount = $5
+			AND created_at BETWEEN $7::TIMESTAMP - $6 * INTERVAL '1 second' AND $7::TIMESTAMP
+			ORDER BY id
+			LIMIT 2
+			FOR UPDATE`,
+			models.DepositPending, models.DepositSubmitted, p.Provider, p.Currency, p.Amount, s.window.Seconds(), p.ReceivedAt)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find matching deposit: %w", err)
+	}
+	defer rows.Close()
+
+	var candidates []*models.DepositRequest
+	for rows.Next() {
+		d, err := scanDeposit(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan deposit request: %w", err)
+		}
+		candidates = append(candidates, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Two deposits of the same amount are ambiguous without a reference
+	if len(candidates) != 1 {
+		return nil, nil
+	}
+	return candidates[0], nil
+}
+
+// findTransaction returns the only externally funded order of the paid
+// amount that is waiting for payment and was placed within the match window
+// before the payment was received.
+func (s *PaymentService) findTransaction(tx *sql.Tx, p *models.IncomingPayment) (int, error) {
+	rows, err := tx.Query(`
+		SELECT id FROM transactions
+		WHERE status IN ($1, $2) AND funding_source = $3 AND from_currency = $4 AND from_amount = $5
+		AND created_at BETWEEN $7::TIMESTAMP - $6 * INTERVAL '1 second' AND $7::TIMESTAMP
+		ORDER BY id
+		LIMIT 2`,
+		models.TransactionPending, models.TransactionAwaitingPayment, models.FundingExternal,
+		p.Currency, p.Amount, s.window.Seconds(), p.ReceivedAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find matching transaction: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return 0, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(ids) != 1 {
+		return 0, nil
+	}
+	return ids[0], nil
+}
+
+// payTransaction moves an order waiting for payment to payment_submitted and
+// records the payment as its proof.
+func (s *PaymentService) payTransaction(tx *sql.Tx, transactionID int, actor Actor, p *models.IncomingPayment, reason string) error {
+	var status string
+	err := tx.QueryRow(`SELECT status FROM transactions WHERE id = $1 FOR UPDATE`, transactionID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return ErrTransactionNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock transaction: %w", err)
+	}
+
+	// The proof goes in first so the transitions report it
+	_, err = tx.Exec(`
+		UPDATE transactions SET payment_proof = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`,
+		fmt.Sprintf("%s:%s", p.Provider, p.TrxID), transactionID)
+	if err != nil {
+		return fmt.Errorf("failed to record payment proof: %w", err)
+	}
+
+	if status == models.TransactionPending {
+		if _, err := s.transactions.transition(tx, transactionID, models.TransactionAwaitingPayment, actor, reason, ""); err != nil {
+			return err
+		}
+	}
+	if _, err := s.transactions.transition(tx, transactionID, models.TransactionPaymentSubmitted, actor, reason, ""); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetPayments lists recorded payments, newest first. An empty status lists
+// all of them.
+func (s *PaymentService) GetPayments(status string, limit, offset int) ([]models.IncomingPayment, error) {
+	rows, err := s.db.Query(`
+		SELECT `+paymentColumns+`
+		FROM incoming_payments
+		WHERE ($1 = '' OR status = $1)
+		ORDER BY received_at DESC
+		LIMIT $2 OFFSET $3`,
+		status, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payments: %w", err)
+	}
+	defer rows.Close()
+
+	list := []models.IncomingPayment{}
+	for rows.Next() {
+		p, err := scanPayment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan payment: %w", err)
+		}
+		list = append(list, *p)
+	}
+
+	return list, nil
+}
+
+// ReconcilePayment assigns an unmatched payment to a deposit request, which
+// is approved, or to an exchange order, which moves to payment_submitted.
+// Currency and amount must agree.
+func (s *PaymentService) ReconcilePayment(paymentID, adminID int, req models.ReconcilePaymentRequest) (*models.IncomingPayment, error) {
+	if (req.DepositID == 0) == (req.TransactionID == 0) {
+		return nil, ErrReconcileTarget
+	}
+
+	var payment *models.IncomingPayment
+	err := runInTx(s.db, func(tx *sql.Tx) error {
+		p, err := lockUnmatchedPayment(tx, paymentID)
+		if err != nil {
+			return err
+		}
+		note := fmt.Sprintf("%s TrxID %s", p.Provider, p.TrxID)
+
+		if req.DepositID != 0 {
+			d, err := scanDeposit(tx.QueryRow(`
+				SELECT `+depositColumns+`
+				FROM deposit_requests WHERE id = $1 FOR UPDATE`, req.DepositID))
+			if err == sql.ErrNoRows {
+				return ErrDepositNotFound
+			}
+			if err != nil {
+				return fmt.Errorf("failed to lock deposit request: %w", err)
+			}
+			if d.Status != models.DepositPending && d.Status != models.DepositSubmitted {
+				return fmt.Errorf("%w: %s", ErrDepositNotAllowed, d.Status)
+			}
+			if d.Currency != p.Currency || !d.Amount.Equal(p.Amount) {
+				return fmt.Errorf("%w: deposit is %s %s, payment is %s %s",
+					ErrPaymentDoesNotMatch, d.Amount, d.Currency, p.Amount, p.Currency)
+			}
+
+			if _, err := s.deposits.approve(tx, d, &adminID, "reconciled "+note); err != nil {
+				return err
+			}
+			payment, err = resolvePayment(tx, p.ID, models.PaymentReconciled, matchDeposit, d.ID, &adminID, req.Note)
+			return err
+		}
+
+		var currency, funding string
+		var amount money.Decimal
+		err = tx.QueryRow(`
+			SELECT from_currency, from_amount, funding_source FROM transactions WHERE id = $1`,
+			req.TransactionID).Scan(&currency, &amount, &funding)
+		if err == sql.ErrNoRows {
+			return ErrTransactionNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get transaction: %w", err)
+		}
+		if funding != models.FundingExternal || currency != p.Currency || !amount.Equal(p.Amount) {
+			return fmt.Errorf("%w: order is %s %s (%s funded), payment is %s %s",
+				ErrPaymentDoesNotMatch, amount, currency, funding, p.Amount, p.Currency)
+		}
+
+		if err := s.payTransaction(tx, req.TransactionID, AdminActor(adminID), p, "Payment reconciled: "+note); err != nil {
+			return err
+		}
+		payment, err = resolvePayment(tx, p.ID, models.PaymentReconciled, matchTransaction, req.TransactionID, &adminID, req.Note)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return payment, nil
+}
+
+// IgnorePayment closes an unmatched payment that belongs to nothing we
+// expect, e.g. a personal transfer to the merchant number.
+func (s *PaymentService) IgnorePayment(paymentID, adminID int, note string) (*models.IncomingPayment, error) {
+	var payment *models.IncomingPayment
+	err := runInTx(s.db, func(tx *sql.Tx) error {
+		p, err := lockUnmatchedPayment(tx, paymentID)
+		if err != nil {
+			return err
+		}
+		payment, err = resolvePayment(tx, p.ID, models.PaymentIgnored, "", 0, &adminID, note)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return payment, nil
+}
+
+func lockUnmatchedPayment(tx *sql.Tx, paymentID int) (*models.IncomingPayment, error) {
+	p, err := scanPayment(tx.QueryRow(`
+		SELECT `+paymentColumns+`
+		FROM incoming_payments WHERE id = $1 FOR UPDATE`, paymentID))
+	if err == sql.ErrNoRows {
+		return nil, ErrPaymentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock payment: %w", err)
+	}
+	if p.Status != models.PaymentUnmatched {
+		return nil, fmt.Errorf("%w: %s", ErrPaymentResolved, p.Status)
+	}
+	return p, nil
+}
+
+func resolvePayment(tx *sql.Tx, paymentID int, status, matchedType string, matchedID int, resolvedBy *int, note string) (*models.IncomingPayment, error) {
+	var target sql.NullInt64
+	if matchedID != 0 {
+		target = sql.NullInt64{Int64: int64(matchedID), Valid: true}
+	}
+
+	p, err := scanPayment(tx.QueryRow(`
+		UPDATE incoming_payments
+		SET status = $1, matched_type = NULLIF($2, ''), matched_id = $3, resolved_by = $4,
+			note = NULLIF($5, ''), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $6
+		RETURNING `+paymentColumns,
+		status, matchedType, target, resolvedBy, note, paymentID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update payment: %w", err)
+	}
+	return p, nil
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"bdpayx-backend/internal/models"
+	"bdpayx-backend/internal/money"
+	"bdpayx-backend/internal/rates"
+)
+
+var (
+	ErrTierNotFound   = errors.New("pricing tier not found")
+	ErrTierOverlap    = errors.New("pricing tier overlaps an existing tier of the same pair and segment")
+	ErrInvalidTier    = errors.New("invalid pricing tier")
+	ErrAmountBelowFee = errors.New("amount does not cover the fixed fee")
+	ErrUserNotFound   = errors.New("user not found")
+)
+
+const pricingColumns = `id, from_currency, to_currency, COALESCE(segment, ''), min_amount, max_amount,
+	spread, fixed_fee, created_at, updated_at`
+
+func scanPricingTier(row rowScanner) (*models.PricingTier, error) {
+	var t models.PricingTier
+	err := row.Scan(&t.ID, &t.FromCurrency, &t.ToCurrency, &t.Segment, &t.MinAmount, &t.MaxAmount,
+		&t.Spread, &t.FixedFee, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// pricing is what an exchange is priced with besides the market rate: the
+// spread and fixed fee of the matching tier, or the pair's default spread.
+type pricing struct {
+	TierID  *int
+	Segment string
+	Spread  money.Decimal
+	Fee     money.Decimal
+}
+
+func (p pricing) sameTier(o pricing) bool {
+	if p.TierID == nil || o.TierID == nil {
+		return p.TierID == nil && o.TierID == nil
+	}
+	return *p.TierID == *o.TierID
+}
+
+// PricingService manages volume tiers: spreads and fixed fees that depend on
+// the amount sent, the direction of the pair and optionally the user's
+// pricing segment.
+type PricingService struct {
+	db *sql.DB
+}
+
+func NewPricingService(db *sql.DB) *PricingService {
+	return &PricingService{db: db}
+}
+
+// match returns the tier that prices amount for a user segment, or nil. A
+// tier of the segment beats a tier for everyone.
+func (s *PricingService) match(fromCurrency, toCurrency string, amount money.Decimal, segment string) (*models.PricingTier, error) {
+	if s == nil || s.db == nil {
+		return nil, nil
+	}
+
+	tier, err := scanPricingTier(s.db.QueryRow(`
+		SELECT `+pricingColumns+`
+		FROM pricing_tiers
+		WHERE from_currency = $1 AND to_currency = $2
+		AND min_amount <= $3 AND (max_amount IS NULL OR $3 < max_amount)
+		AND (segment IS NULL OR segment = NULLIF($4, ''))
+		ORDER BY segment IS NULL, min_amount DESC
+		LIMIT 1`,
+		fromCurrency, toCurrency, amount, segment))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pricing tier: %w", err)
+	}
+	return tier, nil
+}
+
+// price returns the pricing of amount: the matching tier's, or spread without
+// a fee when no tier matches.
+func (s *PricingService) price(fromCurrency, toCurrency string, amount money.Decimal, segment string, spread money.Decimal) (pricing, error) {
+	tier, err := s.match(fromCurrency, toCurrency, amount, segment)
+	if err != nil {
+		return pricing{}, err
+	}
+	if tier == nil {
+		return pricing{Spread: spread}, nil
+	}
+	return pricing{TierID: &tier.ID, Segment: tier.Segment, Spread: tier.Spread, Fee: tier.FixedFee}, nil
+}
+
+// lowestSpreads returns the lowest spread any tier charges per pair, keyed
+// as "BDT_INR".
+func (s *PricingService) lowestSpreads() (map[string]money.Decimal, error) {
+	spreads := make(map[string]money.Decimal)
+	if s == nil || s.db == nil {
+		return spreads, nil
+	}
+
+	rows, err := s.db.Query(`
+		SELECT from_currency, to_currency, MIN(spread)
+		FROM pricing_tiers
+		GROUP BY from_currency, to_currency`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tier spreads: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var from, to string
+		var spread money.Decimal
+		if err := rows.Scan(&from, &to, &spread); err != nil {
+			return nil, fmt.Errorf("failed to scan tier spread: %w", err)
+		}
+		spreads[rates.Pair(from, to)] = spread
+	}
+	return spreads, rows.Err()
+}
+
+// UserSegment returns the pricing segment of a user; empty for none.
+func (s *PricingService) UserSegment(userID int) (string, error) {
+	if s == nil || s.db == nil || userID == 0 {
+		return "", nil
+	}
+
+	var segment string
+	err := s.db.QueryRow(`SELECT COALESCE(pricing_segment, '') FROM users WHERE id = $1`, userID).Scan(&segment)
+	if err == sql.ErrNoRows {
+		return "", ErrUserNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get user segment: %w", err)
+	}
+	return segment, nil
+}
+
+// SetUserSegment puts a user into a pricing segment; empty removes them
+// from any.
+func (s *PricingService) SetUserSegment(userID int, segment string) error {
+	result, err := s.db.Exec(`
+		UPDATE users SET pricing_segment = NULLIF($1, ''), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2`,
+		strings.ToLower(strings.TrimSpace(segment)), userID)
+	if err != nil {
+		return fmt.Errorf("failed to update user segment: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// GetTiers lists tiers, optionally of one pair, ordered for reading.
+func (s *PricingService) GetTiers(fromCurrency, toCurrency string) ([]models.PricingTier, error) {
+	rows, err := s.db.Query(`
+		SELECT `+pricingColumns+`
+		FROM pricing_tiers
+		WHERE ($1 = '' OR from_currency = $1) AND ($2 = '' OR to_currency = $2)
+		ORDER BY from_currency, to_currency, segment NULLS FIRST, min_amount`,
+		strings.ToUpper(fromCurrency), strings.ToUpper(toCurrency))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pricing tiers: %w", err)
+	}
+	defer rows.Close()
+
+	tiers := []models.PricingTier{}
+	for rows.Next() {
+		t, err := scanPricingTier(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan pricing tier: %w", err)
+		}
+		tiers = append(tiers, *t)
+	}
+
+	return tiers, nil
+}
+
+func (s *PricingService) CreateTier(req models.PricingTierRequest) (*models.PricingTier, error) {
+	return s.saveTier(0, req)
+}
+
+func (s *PricingService) UpdateTier(tierID int, req models.PricingTierRequest) (*models.PricingTier, error) {
+	return s.saveTier(tierID, req)
+}
+
+func (s *PricingService) DeleteTier(tierID int) error {
+	result, err := s.db.Exec(`DELETE FROM pricing_tiers WHERE id = $1`, tierID)
+	if err != nil {
+		return fmt.Errorf("failed to delete pricing tier: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrTierNotFound
+	}
+	return nil
+}
+
+// saveTier creates a tier (tierID 0) or replaces one. The pair's rate row is
+// locked while checking for overlaps so concurrent edits cannot both pass.
+func (s *PricingService) saveTier(tierID int, req models.PricingTierRequest) (*models.PricingTier, error) {
+	from := strings.ToUpper(req.FromCurrency)
+	to := strings.ToUpper(req.ToCurrency)
+	segment := strings.ToLower(strings.TrimSpace(req.Segment))
+	if err := validateTier(from, req); err != nil {
+		return nil, err
+	}
+
+	var tier *models.PricingTier
+	err := runInTx(s.db, func(tx *sql.Tx) error {
+		var rateID int
+		err := tx.QueryRow(`
+			SELECT id FROM exchange_rates WHERE from_currency = $1 AND to_currency = $2 FOR UPDATE`,
+			from, to).Scan(&rateID)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%w for %s to %s", ErrRateNotFound, from, to)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to lock exchange rate: %w", err)
+		}
+
+		var overlapping int
+		err = tx.QueryRow(`
+			SELECT COUNT(*) FROM pricing_tiers
+			WHERE from_currency = $1 AND to_currency = $2 AND segment IS NOT DISTINCT FROM NULLIF($3, '')
+			AND id <> $4
+			AND (max_amount IS NULL OR $5 < max_amount)
+			AND ($6::DECIMAL IS NULL OR min_amount < $6)`,
+			from, to, segment, tierID, req.MinAmount, req.MaxAmount).Scan(&overlapping)
+		if err != nil {
+			return fmt.Errorf("failed to check pricing tiers: %w", err)
+		}
+		if overlapping > 0 {
+			return ErrTierOverlap
+		}
+
+		if tierID == 0 {
+			tier, err = scanPricingTier(tx.QueryRow(`
+				INSERT INTO pricing_tiers (from_currency, to_currency, segment, min_amount, max_amount, spread, fixed_fee, created_at, updated_at)
+				VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+				RETURNING `+pricingColumns,
+				from, to, segment, req.MinAmount, req.MaxAmount, req.Spread, req.FixedFee))
+		} else {
+			tier, err = scanPricingTier(tx.QueryRow(`
+				UPDATE pricing_tiers
+				SET from_currency = $1, to_currency = $2, segment = NULLIF($3, ''), min_amount = $4, max_amount = $5,
+					spread = $6, fixed_fee = $7, updated_at = CURRENT_TIMESTAMP
+				WHERE id = $8
+				RETURNING `+pricingColumns,
+				from, to, segment, req.MinAmount, req.MaxAmount, req.Spread, req.FixedFee, tierID))
+		}
+		if err == sql.ErrNoRows {
+			return ErrTierNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to save pricing tier: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tier, nil
+}
+
+func validateTier(fromCurrency string, req models.PricingTierRequest) error {
+	decimals := money.Decimals(fromCurrency)
+	switch {
+	case req.MinAmount.IsNegative() || !req.MinAmount.Exact(decimals):
+		return fmt.Errorf("%w: min_amount must be a non-negative %s amount", ErrInvalidTier, fromCurrency)
+	case req.MaxAmount != nil && (req.MaxAmount.Cmp(req.MinAmount) <= 0 || !req.MaxAmount.Exact(decimals)):
+		return fmt.Errorf("%w: max_amount must be above min_amount", ErrInvalidTier)
+	case req.Spread.IsNegative() || req.Spread.Cmp(money.NewFromInt(1)) >= 0 || !req.Spread.Exact(4):
+		return fmt.Errorf("%w: spread must be a fraction from 0 to below 1 with at most 4 decimals", ErrInvalidTier)
+	case req.FixedFee.IsNegative() || !req.FixedFee.Exact(decimals):
+		return fmt.Errorf("%w: fixed_fee must be a non-negative %s amount", ErrInvalidTier, fromCurrency)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"bdpayx-backend/internal/models"
+	"bdpayx-backend/internal/money"
+)
+
+var (
+	ErrQuoteInvalid = errors.New("invalid quote")
+	ErrQuoteExpired = errors.New("quote has expired, please request a new one")
+)
+
+// quotePayload is what a quote ID pins. It is signed, not encrypted: the
+// client may read it but cannot change it. A quote issued to a signed-in user
+// carries their ID and can only be redeemed by them.
+type quotePayload struct {
+	Nonce        string        `json:"n"`
+	FromCurrency string        `json:"f"`
+	ToCurrency   string        `json:"t"`
+	FromAmount   money.Decimal `json:"a"`
+	Rate         money.Decimal `json:"r"`
+	Spread       money.Decimal `json:"s"`
+	Fee          money.Decimal `json:"x"`
+	TierID       *int          `json:"i,omitempty"`
+	Segment      string        `json:"g,omitempty"`
+	UserID       int           `json:"u,omitempty"`
+	ExpiresAt    int64         `json:"e"`
+}
+
+// Quote is a priced exchange pinned to the market rate, spread and fee that
+// were live when it was issued.
+type Quote struct {
+	ID           string
+	Nonce        string
+	FromCurrency string
+	ToCurrency   string
+	FromAmount   money.Decimal
+	ToAmount     money.Decimal
+	Rate         money.Decimal
+	Spread       money.Decimal
+	Fee          money.Decimal
+	ExchangeRate money.Decimal
+	ExpiresAt    time.Time
+}
+
+type QuoteService struct {
+	rateService *RateService
+	pricing     *PricingService
+	secret      []byte
+	ttl         time.Duration
+}
+
+func NewQuoteService(rateService *RateService, pricing *PricingService, secret string, ttl time.Duration) *QuoteService {
+	return &QuoteService{
+		rateService: rateService,
+		pricing:     pricing,
+		secret:      []byte(secret),
+		ttl:         ttl,
+	}
+}
+
+// Issue prices an exchange at the current rate and returns it together with
+// a signed quote ID that pins that pricing until it expires. amount is sent
+// or, on the receive side, what should arrive. userID is 0 for anonymous
+// callers, who get the pricing for everyone.
+func (s *QuoteService) Issue(fromCurrency, toCurrency string, amount money.Decimal, side string, userID int) (*models.ExchangeCalculateResponse, error) {
+	segment, err := s.pricing.UserSegment(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *models.ExchangeCalculateResponse
+	if side == models.SideReceive {
+		result, err = s.rateService.CalculateReceive(fromCurrency, toCurrency, amount, segment)
+	} else {
+		side = models.SideSend
+		result, err = s.rateService.CalculateExchange(fromCurrency, toCurrency, amount, segment)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.Side = side
+
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate quote nonce: %w", err)
+	}
+
+	expiresAt := time.Now().Add(s.ttl).UTC().Truncate(time.Second)
+	payload := quotePayload{
+		Nonce:        hex.EncodeToString(nonce),
+		FromCurrency: fromCurrency,
+		ToCurrency:   toCurrency,
+		FromAmount:   result.FromAmount,
+		Rate:         result.MarketRate,
+		Spread:       result.Spread,
+		Fee:          result.Fees.FixedFee,
+		TierID:       result.Fees.TierID,
+		Segment:      result.Fees.Segment,
+		UserID:       userID,
+		ExpiresAt:    expiresAt.Unix(),
+	}
+
+	id, err := s.sign(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	result.QuoteID = id
+	result.ExpiresAt = &expiresAt
+	return result, nil
+}
+
+// Redeem verifies a quote ID for the user placing the order and recomputes
+// its amounts server-side.
+func (s *QuoteService) Redeem(id string, userID int) (*Quote, error) {
+	payload, err := s.verify(id)
+	if err != nil {
+		return nil, err
+	}
+	if payload.UserID != 0 && payload.UserID != userID {
+		return nil, ErrQuoteInvalid
+	}
+
+	expiresAt := time.Unix(payload.ExpiresAt, 0).UTC()
+	if time.Now().After(expiresAt) {
+		return nil, ErrQuoteExpired
+	}
+
+	priced, err := s.rateService.priceExchange(payload.FromCurrency, payload.ToCurrency, payload.FromAmount,
+		payload.Rate, pricing{TierID: payload.TierID, Segment: payload.Segment, Spread: payload.Spread, Fee: payload.Fee})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Quote{
+		ID:           id,
+		Nonce:        payload.Nonce,
+		FromCurrency: payload.FromCurrency,
+		ToCurrency:   payload.ToCurrency,
+		FromAmount:   priced.FromAmount,
+		ToAmount:     priced.ToAmount,
+		Rate:         payload.Rate,
+		Spread:       payload.Spread,
+		Fee:          priced.Fees.FixedFee,
+		ExchangeRate: priced.ExchangeRate,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+func (s *QuoteService) mac(data string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func (s *QuoteService) sign(payload quotePayload) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode quote: %w", err)
+	}
+	body := base64.RawURLEncoding.EncodeToString(data)
+	return body + "." + base64.RawURLEncoding.EncodeToString(s.mac(body)), nil
+}
+
+func (s *QuoteService) verify(id string) (*quotePayload, error) {
+	body, signature, ok := strings.Cut(id, ".")
+	if !ok {
+		return nil, ErrQuoteInvalid
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sig, s.mac(body)) {
+		return nil, ErrQuoteInvalid
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return nil, ErrQuoteInvalid
+	}
+	var payload quotePayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, ErrQuoteInvalid
+	}
+	return &payload, nil
+}
@@ -1,159 +1,545 @@
 package services
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
-	"math"
-	"math/rand"
+	"sort"
 	"time"
 
+	"bdpayx-backend/internal/events"
 	"bdpayx-backend/internal/models"
+	"bdpayx-backend/internal/money"
+	"bdpayx-backend/internal/rates"
 )
 
+var (
+	ErrRateNotFound       = errors.New("exchange rate not found")
+	ErrReceiveUnreachable = errors.New("amount cannot be received exactly")
+	ErrInvalidSpread      = errors.New("spread must be a fraction from 0 to below 1 with at most 4 decimals")
+	ErrRatePinned         = errors.New("rate is pinned by an override")
+)
+
+const (
+	// rateScale matches the DECIMAL(18,8) rate columns
+	rateScale = 8
+	// quotedRateScale is the fewest decimal places a quoted rate is shown with
+	quotedRateScale = 4
+)
+
+// defaultSpread is what a pair added without a spread is given
+var defaultSpread = money.MustParse("0.02")
+
 type RateService struct {
 	db          *sql.DB
 	redisClient *RedisService
+	rounding    money.RoundingMode
+	feed        *rates.Chain
+	staleAfter  time.Duration
+	pricing     *PricingService
+	publisher   events.Publisher
 }
 
-func NewRateService(db *sql.DB, redisClient *RedisService) *RateService {
+func NewRateService(db *sql.DB, redisClient *RedisService, rounding money.RoundingMode, feed *rates.Chain, staleAfter time.Duration, pricing *PricingService, publisher events.Publisher) *RateService {
 	return &RateService{
 		db:          db,
 		redisClient: redisClient,
+		rounding:    rounding,
+		feed:        feed,
+		staleAfter:  staleAfter,
+		pricing:     pricing,
+		publisher:   publisher,
 	}
 }
 
+const rateColumns = `id, from_currency, to_currency, rate, spread, COALESCE(source, ''),
+	updated_at < CURRENT_TIMESTAMP - $1 * INTERVAL '1 second', created_at, updated_at`
+
+func scanRate(row rowScanner) (*models.ExchangeRate, error) {
+	var rate models.ExchangeRate
+	err := row.Scan(&rate.ID, &rate.FromCurrency, &rate.ToCurrency, &rate.Rate, &rate.Spread,
+		&rate.Source, &rate.Stale, &rate.CreatedAt, &rate.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &rate, nil
+}
+
+// GetRates returns every pair keyed as "BDT_INR". Rates the feed has not
+// refreshed within the staleness window are flagged as stale.
 func (s *RateService) GetRates() (map[string]models.ExchangeRate, error) {
 	// Return mock data if database is not available (test mode)
 	if s.db == nil {
 		return s.getMockRates(), nil
 	}
 
-	rows, err := s.db.Query(`
-		SELECT id, from_currency, to_currency, rate, spread, created_at, updated_at
-		FROM exchange_rates`)
+	rows, err := s.db.Query(`SELECT `+rateColumns+` FROM exchange_rates`, s.staleAfter.Seconds())
 	if err != nil {
 		return nil, fmt.Errorf("failed to get rates: %w", err)
 	}
 	defer rows.Close()
 
-	rates := make(map[string]models.ExchangeRate)
+	result := make(map[string]models.ExchangeRate)
 	for rows.Next() {
-		var rate models.ExchangeRate
-		err := rows.Scan(&rate.ID, &rate.FromCurrency, &rate.ToCurrency,
-			&rate.Rate, &rate.Spread, &rate.CreatedAt, &rate.UpdatedAt)
+		rate, err := scanRate(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan rate: %w", err)
 		}
-		key := rate.FromCurrency + "_" + rate.ToCurrency
-		rates[key] = rate
+		rate.Mode = models.RateModeAutomatic
+		s.flagFallback(rate)
+		result[rates.Pair(rate.FromCurrency, rate.ToCurrency)] = *rate
 	}
 
-	return rates, nil
+	if err := s.applyOverrideModes(result); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
+// GetRate returns the rate of a pair, crossed through another currency when
+// the pair has no rate of its own.
 func (s *RateService) GetRate(fromCurrency, toCurrency string) (*models.ExchangeRate, error) {
+	rate, err := s.storedRate(fromCurrency, toCurrency)
+	if errors.Is(err, ErrRateNotFound) {
+		return s.crossRate(fromCurrency, toCurrency)
+	}
+	return rate, err
+}
+
+func (s *RateService) storedRate(fromCurrency, toCurrency string) (*models.ExchangeRate, error) {
 	// Return mock data if database is not available (test mode)
 	if s.db == nil {
-		rates := s.getMockRates()
-		key := fromCurrency + "_" + toCurrency
-		if rate, exists := rates[key]; exists {
+		mock := s.getMockRates()
+		if rate, exists := mock[rates.Pair(fromCurrency, toCurrency)]; exists {
 			return &rate, nil
 		}
-		return nil, fmt.Errorf("exchange rate not found for %s to %s", fromCurrency, toCurrency)
+		return nil, fmt.Errorf("%w for %s to %s", ErrRateNotFound, fromCurrency, toCurrency)
 	}
 
-	var rate models.ExchangeRate
-	err := s.db.QueryRow(`
-		SELECT id, from_currency, to_currency, rate, spread, created_at, updated_at
-		FROM exchange_rates WHERE from_currency = $1 AND to_currency = $2`,
-		fromCurrency, toCurrency).Scan(
-		&rate.ID, &rate.FromCurrency, &rate.ToCurrency,
-		&rate.Rate, &rate.Spread, &rate.CreatedAt, &rate.UpdatedAt)
+	rate, err := scanRate(s.db.QueryRow(`
+		SELECT `+rateColumns+`
+		FROM exchange_rates WHERE from_currency = $2 AND to_currency = $3`,
+		s.staleAfter.Seconds(), fromCurrency, toCurrency))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("exchange rate not found for %s to %s", fromCurrency, toCurrency)
+			return nil, fmt.Errorf("%w for %s to %s", ErrRateNotFound, fromCurrency, toCurrency)
 		}
 		return nil, fmt.Errorf("failed to get rate: %w", err)
 	}
-	return &rate, nil
+	s.flagFallback(rate)
+	return rate, nil
+}
+
+// flagFallback marks a rate set by a fallback provider as degraded. Fallbacks
+// keep refreshing it, so it also turns stale once the primary provider has
+// not answered for the staleness window.
+func (s *RateService) flagFallback(rate *models.ExchangeRate) {
+	if s.feed == nil || !s.feed.IsFallback(rate.Source) {
+		return
+	}
+	rate.Degraded = true
+	if time.Since(s.feed.LastPrimarySuccess()) > s.staleAfter {
+		rate.Stale = true
+	}
 }
 
-func (s *RateService) CalculateExchange(fromCurrency, toCurrency string, amount float64) (*models.ExchangeCalculateResponse, error) {
+// crossRate derives a pair from two stored ones that meet in an intermediate
+// currency, e.g. USD to INR from USD to BDT and BDT to INR. The rates
+// multiply and the spreads compound; of several intermediates the first in
+// code order is used.
+func (s *RateService) crossRate(fromCurrency, toCurrency string) (*models.ExchangeRate, error) {
+	all, err := s.GetRates()
+	if err != nil {
+		return nil, err
+	}
+	return cross(all, fromCurrency, toCurrency)
+}
+
+func cross(all map[string]models.ExchangeRate, fromCurrency, toCurrency string) (*models.ExchangeRate, error) {
+	if fromCurrency == toCurrency {
+		return nil, fmt.Errorf("%w for %s to %s", ErrRateNotFound, fromCurrency, toCurrency)
+	}
+
+	var vias []string
+	for _, rate := range all {
+		if rate.FromCurrency != fromCurrency || rate.ToCurrency == toCurrency {
+			continue
+		}
+		if _, ok := all[rates.Pair(rate.ToCurrency, toCurrency)]; ok {
+			vias = append(vias, rate.ToCurrency)
+		}
+	}
+	if len(vias) == 0 {
+		return nil, fmt.Errorf("%w for %s to %s", ErrRateNotFound, fromCurrency, toCurrency)
+	}
+	sort.Strings(vias)
+
+	first := all[rates.Pair(fromCurrency, vias[0])]
+	second := all[rates.Pair(vias[0], toCurrency)]
+	one := money.NewFromInt(1)
+	updatedAt := first.UpdatedAt
+	if second.UpdatedAt.Before(updatedAt) {
+		updatedAt = second.UpdatedAt
+	}
+
+	return &models.ExchangeRate{
+		FromCurrency: fromCurrency,
+		ToCurrency:   toCurrency,
+		Rate:         first.Rate.Mul(second.Rate),
+		Spread:       one.Sub(one.Sub(first.Spread).Mul(one.Sub(second.Spread))),
+		Source:       "cross",
+		Via:          vias[0],
+		Stale:        first.Stale || second.Stale,
+		Degraded:     first.Degraded || second.Degraded,
+		CreatedAt:    updatedAt,
+		UpdatedAt:    updatedAt,
+	}, nil
+}
+
+// GetCrossRates derives every pair between quoted currencies that has no
+// rate of its own, keyed as "USD_INR".
+func (s *RateService) GetCrossRates() (map[string]models.ExchangeRate, error) {
+	all, err := s.GetRates()
+	if err != nil {
+		return nil, err
+	}
+
+	currencies := make(map[string]bool)
+	for _, rate := range all {
+		currencies[rate.FromCurrency] = true
+		currencies[rate.ToCurrency] = true
+	}
+
+	result := make(map[string]models.ExchangeRate)
+	for from := range currencies {
+		for to := range currencies {
+			pair := rates.Pair(from, to)
+			if _, ok := all[pair]; ok || from == to {
+				continue
+			}
+			if rate, err := cross(all, from, to); err == nil {
+				result[pair] = *rate
+			}
+		}
+	}
+	return result, nil
+}
+
+// CalculateExchange prices sending amount at the current rate, with the
+// spread and fixed fee of the tier that matches the amount and segment.
+func (s *RateService) CalculateExchange(fromCurrency, toCurrency string, amount money.Decimal, segment string) (*models.ExchangeCalculateResponse, error) {
+	if err := money.Of(amount, fromCurrency).Validate(); err != nil {
+		return nil, err
+	}
+
 	rate, err := s.GetRate(fromCurrency, toCurrency)
 	if err != nil {
 		return nil, err
 	}
 
-	// Apply spread to the rate
-	adjustedRate := rate.Rate * (1 - rate.Spread)
-	toAmount := amount * adjustedRate
+	p, err := s.pricing.price(fromCurrency, toCurrency, amount, segment, rate.Spread)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.priceExchange(fromCurrency, toCurrency, amount, rate.Rate, p)
+}
+
+// CalculateReceive prices the smallest amount to send for exactly toAmount
+// to arrive. The tier is chosen by the amount sent, which in turn depends on
+// the tier, so the two are solved together; a target that only a tier
+// boundary separates from the amounts around it cannot be met.
+func (s *RateService) CalculateReceive(fromCurrency, toCurrency string, toAmount money.Decimal, segment string) (*models.ExchangeCalculateResponse, error) {
+	if err := money.Of(toAmount, toCurrency).Validate(); err != nil {
+		return nil, err
+	}
+
+	rate, err := s.GetRate(fromCurrency, toCurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	p := pricing{Spread: rate.Spread}
+	for attempt := 0; attempt < 3; attempt++ {
+		amount, err := s.solveSendAmount(fromCurrency, toCurrency, toAmount, rate.Rate, p)
+		if err != nil {
+			return nil, err
+		}
+
+		matched, err := s.pricing.price(fromCurrency, toCurrency, amount, segment, rate.Spread)
+		if err != nil {
+			return nil, err
+		}
+		if matched.sameTier(p) {
+			return s.priceExchange(fromCurrency, toCurrency, amount, rate.Rate, p)
+		}
+		p = matched
+	}
+
+	return nil, fmt.Errorf("%w: %s %s falls between two pricing tiers", ErrReceiveUnreachable, toAmount, toCurrency)
+}
+
+// solveSendAmount finds the smallest amount whose forward pricing pays out
+// exactly target. The payout only grows with the net amount, so the net is
+// binary searched between a bound that pays too little and one that pays
+// enough, in the smallest units of the sending currency.
+func (s *RateService) solveSendAmount(fromCurrency, toCurrency string, target, rate money.Decimal, p pricing) (money.Decimal, error) {
+	fromDecimals := money.Decimals(fromCurrency)
+	adjustedRate := rate.Mul(money.NewFromInt(1).Sub(p.Spread))
+	payout := func(net int64) money.Decimal {
+		return money.Of(money.New(net, fromDecimals).Mul(adjustedRate), toCurrency).Round(s.rounding).Amount
+	}
+
+	// Anything at or below one unit short of target pays out less than target
+	low, err := target.Sub(money.New(1, money.Decimals(toCurrency))).Quo(adjustedRate, fromDecimals, money.Floor)
+	if err != nil {
+		return money.Decimal{}, err
+	}
+	high, err := target.Quo(adjustedRate, fromDecimals, money.Ceiling)
+	if err != nil {
+		return money.Decimal{}, err
+	}
+	lo, err := low.Units(fromDecimals)
+	if err != nil {
+		return money.Decimal{}, err
+	}
+	hi, err := high.Units(fromDecimals)
+	if err != nil {
+		return money.Decimal{}, err
+	}
+
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		if payout(mid).Cmp(target) >= 0 {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+
+	if got := payout(hi); got.Cmp(target) != 0 {
+		return money.Decimal{}, fmt.Errorf("%w: the nearest amounts that can arrive are %s and %s %s",
+			ErrReceiveUnreachable, payout(hi-1), got, toCurrency)
+	}
+	return money.New(hi, fromDecimals).Add(p.Fee.Round(fromDecimals, s.rounding)), nil
+}
+
+// priceExchange takes the fixed fee off amount and converts the rest at the
+// market rate less the spread. The adjusted rate is exact; only amounts are
+// rounded.
+func (s *RateService) priceExchange(fromCurrency, toCurrency string, amount, rate money.Decimal, p pricing) (*models.ExchangeCalculateResponse, error) {
+	fromAmount := amount.Round(money.Decimals(fromCurrency), s.rounding)
+	fee := p.Fee.Round(money.Decimals(fromCurrency), s.rounding)
+	net := fromAmount.Sub(fee)
+	if !net.IsPositive() {
+		return nil, fmt.Errorf("%w of %s %s", ErrAmountBelowFee, fee, fromCurrency)
+	}
+
+	adjustedRate := rate.Mul(money.NewFromInt(1).Sub(p.Spread))
+	toAmount := money.Of(net.Mul(adjustedRate), toCurrency).Round(s.rounding)
+	atMarket := money.Of(net.Mul(rate), toCurrency).Round(s.rounding)
 
 	return &models.ExchangeCalculateResponse{
-		FromAmount:   amount,
-		ToAmount:     math.Round(toAmount*100) / 100, // Round to 2 decimal places
-		ExchangeRate: adjustedRate,
-		Spread:       rate.Spread,
+		FromAmount:   fromAmount,
+		ToAmount:     toAmount.Amount,
+		MarketRate:   rate,
+		ExchangeRate: adjustedRate.Reduce(quotedRateScale),
+		Spread:       p.Spread,
+		Fees: models.FeeBreakdown{
+			TierID:     p.TierID,
+			Segment:    p.Segment,
+			FixedFee:   fee,
+			NetAmount:  net,
+			Spread:     p.Spread,
+			SpreadCost: atMarket.Amount.Sub(toAmount.Amount),
+		},
 	}, nil
 }
 
-func (s *RateService) UpdateRate(fromCurrency, toCurrency string, newRate float64) error {
+// SaveRate sets the market rate of a pair, adding the pair when it is new. A
+// nil spread keeps the pair's spread, or gives a new pair the default one.
+// Pairs pinned by an override are refused.
+func (s *RateService) SaveRate(fromCurrency, toCurrency string, newRate money.Decimal, spread *money.Decimal, source string) error {
+	if err := validateSpread(spread); err != nil {
+		return err
+	}
+
 	// Skip update if database is not available (test mode)
 	if s.db == nil {
-		log.Printf("📊 Mock rate update: %s_%s = %.4f", fromCurrency, toCurrency, newRate)
+		log.Printf("📊 Mock rate update: %s_%s = %s (%s)", fromCurrency, toCurrency, newRate, source)
 		return nil
 	}
 
-	_, err := s.db.Exec(`
-		UPDATE exchange_rates 
-		SET rate = $1, updated_at = CURRENT_TIMESTAMP
-		WHERE from_currency = $2 AND to_currency = $3`,
-		newRate, fromCurrency, toCurrency)
+	return runInTx(s.db, func(tx *sql.Tx) error {
+		if _, err := lockUnpinnedRate(tx, fromCurrency, toCurrency); err != nil {
+			return err
+		}
+		return s.saveRate(tx, fromCurrency, toCurrency, newRate, spread, source)
+	})
+}
+
+// lockUnpinnedRate locks a pair's rate for the rest of tx and fails with
+// ErrRatePinned while an override pins it. Overrides take the same row lock
+// when they activate. It reports whether the pair exists.
+func lockUnpinnedRate(tx *sql.Tx, fromCurrency, toCurrency string) (bool, error) {
+	var pinned bool
+	err := tx.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM rate_overrides o
+			WHERE o.from_currency = r.from_currency AND o.to_currency = r.to_currency AND o.status = $3
+		)
+		FROM exchange_rates r
+		WHERE r.from_currency = $1 AND r.to_currency = $2
+		FOR UPDATE OF r`,
+		fromCurrency, toCurrency, models.OverrideActive).Scan(&pinned)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
 	if err != nil {
-		return fmt.Errorf("failed to update rate: %w", err)
+		return false, fmt.Errorf("failed to lock rate: %w", err)
+	}
+	if pinned {
+		return true, fmt.Errorf("%w: %s to %s", ErrRatePinned, fromCurrency, toCurrency)
+	}
+	return true, nil
+}
+
+func validateSpread(spread *money.Decimal) error {
+	if spread != nil && (spread.IsNegative() || spread.Cmp(money.NewFromInt(1)) >= 0 || !spread.Exact(4)) {
+		return ErrInvalidSpread
 	}
 	return nil
 }
 
-func (s *RateService) StartRateFluctuation() {
-	log.Println("🔄 Starting rate fluctuation service...")
+// saveRate upserts a pair's rate inside the caller's transaction.
+func (s *RateService) saveRate(tx *sql.Tx, fromCurrency, toCurrency string, newRate money.Decimal, spread *money.Decimal, source string) error {
+	_, err := tx.Exec(`
+		INSERT INTO exchange_rates (from_currency, to_currency, rate, spread, source, created_at, updated_at)
+		VALUES ($1, $2, $3, COALESCE($4::DECIMAL, $6::DECIMAL), $5, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT (from_currency, to_currency) DO UPDATE
+		SET rate = EXCLUDED.rate, spread = COALESCE($4::DECIMAL, exchange_rates.spread),
+			source = EXCLUDED.source, updated_at = CURRENT_TIMESTAMP`,
+		fromCurrency, toCurrency, newRate, spread, source, defaultSpread)
+	if err != nil {
+		return fmt.Errorf("failed to save rate: %w", err)
+	}
+
+	return s.recordRateTick(tx, fromCurrency, toCurrency, newRate, source)
+}
+
+// UpdateRate stores a new market rate for a pair and the source it came
+// from, and records the change in rate_history. Pairs pinned by an override
+// are left alone.
+func (s *RateService) UpdateRate(fromCurrency, toCurrency string, newRate money.Decimal, source string) error {
+	// Skip update if database is not available (test mode)
+	if s.db == nil {
+		log.Printf("📊 Mock rate update: %s_%s = %s (%s)", fromCurrency, toCurrency, newRate, source)
+		return nil
+	}
+
+	return runInTx(s.db, func(tx *sql.Tx) error {
+		exists, err := lockUnpinnedRate(tx, fromCurrency, toCurrency)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("%w for %s to %s", ErrRateNotFound, fromCurrency, toCurrency)
+		}
+
+		_, err = tx.Exec(`
+			UPDATE exchange_rates 
+			SET rate = $1, source = $2, updated_at = CURRENT_TIMESTAMP
+			WHERE from_currency = $3 AND to_currency = $4`,
+			newRate, source, fromCurrency, toCurrency)
+		if err != nil {
+			return fmt.Errorf("failed to update rate: %w", err)
+		}
+
+		return s.recordRateTick(tx, fromCurrency, toCurrency, newRate, source)
+	})
+}
+
+// FeedStatus reports the rate providers in priority order and the state of
+// their circuit breakers.
+func (s *RateService) FeedStatus() []rates.ProviderStatus {
+	if s.feed == nil {
+		return nil
+	}
+	return s.feed.Status()
+}
+
+// StartRateFeed refreshes the rates from the provider chain every interval.
+func (s *RateService) StartRateFeed(interval time.Duration) {
+	log.Println("🔄 Starting rate feed...")
+	
+	if err := s.loadSimulatorParams(); err != nil {
+		log.Printf("Error loading simulator parameters: %v", err)
+	}
 	
-	ticker := time.NewTicker(30 * time.Second) // Update every 30 seconds
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
-	for {
-		select {
-		case <-ticker.C:
-			s.fluctuateRates()
-		}
+	for range ticker.C {
+		s.refreshRates(interval)
 	}
 }
 
-func (s *RateService) fluctuateRates() {
-	rates, err := s.GetRates()
+// refreshRates stores the answer of the first healthy provider. When every
+// provider fails the last good rates stay in place and turn stale once they
+// are older than the staleness window.
+func (s *RateService) refreshRates(timeout time.Duration) {
+	if s.feed == nil {
+		return
+	}
+
+	current, err := s.GetRates()
+	if err != nil {
+		log.Printf("Error getting rates for refresh: %v", err)
+		return
+	}
+
+	// Pinned pairs are neither fetched nor simulated until their override ends
+	sim := s.simulator()
+	last := make(rates.Rates, len(current))
+	for pair, rate := range current {
+		if rate.Mode == models.RateModePinned {
+			delete(current, pair)
+			continue
+		}
+		last[pair] = rate.Rate
+		// Simulate on from rates set by hand or by another provider rather
+		// than drifting back to where the simulator left them
+		if sim != nil && rate.Source != sim.Name() {
+			sim.Recentre(pair, rate.Rate.Float64())
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	fetched, source, err := s.feed.Fetch(ctx, last)
 	if err != nil {
-		log.Printf("Error getting rates for fluctuation: %v", err)
+		log.Printf("⚠️ Keeping last good rates: %v", err)
 		return
 	}
 
-	for _, rate := range rates {
-		// Generate random fluctuation between -0.5% to +0.5%
-		fluctuation := (rand.Float64() - 0.5) * 0.01 // -0.005 to +0.005
-		newRate := rate.Rate * (1 + fluctuation)
-		
-		// Ensure rate doesn't go below a minimum threshold
-		minRate := rate.Rate * 0.95 // Don't go below 95% of original
-		maxRate := rate.Rate * 1.05 // Don't go above 105% of original
-		
-		if newRate < minRate {
-			newRate = minRate
-		} else if newRate > maxRate {
-			newRate = maxRate
+	// Only pairs we already quote are taken from the feed
+	for pair, rate := range current {
+		newRate, ok := fetched[pair]
+		if !ok {
+			continue
+		}
+		newRate = newRate.Round(rateScale, s.rounding)
+		if !newRate.IsPositive() {
+			log.Printf("Ignoring non-positive rate %s for %s from %s", newRate, pair, source)
+			continue
 		}
 
-		err := s.UpdateRate(rate.FromCurrency, rate.ToCurrency, newRate)
-		if err != nil {
-			log.Printf("Error updating rate %s_%s: %v", rate.FromCurrency, rate.ToCurrency, err)
+		err := s.UpdateRate(rate.FromCurrency, rate.ToCurrency, newRate, source)
+		if err != nil && !errors.Is(err, ErrRatePinned) {
+			log.Printf("Error updating rate %s: %v", pair, err)
 		}
 	}
 }
@@ -166,8 +552,10 @@ func (s *RateService) getMockRates() map[string]models.ExchangeRate {
 			ID:           1,
 			FromCurrency: "BDT",
 			ToCurrency:   "INR",
-			Rate:         0.70,
-			Spread:       0.02,
+			Rate:         money.MustParse("0.70"),
+			Spread:       money.MustParse("0.02"),
+			Source:       "mock",
+			Mode:         models.RateModeAutomatic,
 			CreatedAt:    now,
 			UpdatedAt:    now,
 		},
@@ -175,8 +563,10 @@ func (s *RateService) getMockRates() map[string]models.ExchangeRate {
 			ID:           2,
 			FromCurrency: "INR",
 			ToCurrency:   "BDT",
-			Rate:         1.43,
-			Spread:       0.02,
+			Rate:         money.MustParse("1.43"),
+			Spread:       money.MustParse("0.02"),
+			Source:       "mock",
+			Mode:         models.RateModeAutomatic,
 			CreatedAt:    now,
 			UpdatedAt:    now,
 		},
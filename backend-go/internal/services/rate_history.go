@@ -0,0 +1,324 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"bdpayx-backend/internal/events"
+	"bdpayx-backend/internal/models"
+	"bdpayx-backend/internal/money"
+	"bdpayx-backend/internal/rates"
+)
+
+var ErrUnknownInterval = errors.New("unknown candle interval")
+
+// maxCandles caps a single history page
+const maxCandles = 1000
+
+// candleInterval describes one candle resolution: how its buckets are cut,
+// which finer data it is built from and how long it is kept (0 = forever).
+type candleInterval struct {
+	name      string
+	length    time.Duration
+	bucket    string
+	source    string
+	retention time.Duration
+}
+
+// candleIntervals are built in order, each from the one before it, so they
+// survive the raw ticks being pruned.
+var candleIntervals = []candleInterval{
+	{"1m", time.Minute, `date_trunc('minute', %s)`, "", 30 * 24 * time.Hour},
+	{"5m", 5 * time.Minute, `date_trunc('hour', %[1]s) + floor(date_part('minute', %[1]s) / 5) * INTERVAL '5 minutes'`, "1m", 180 * 24 * time.Hour},
+	{"1h", time.Hour, `date_trunc('hour', %s)`, "5m", 0},
+	{"1d", 24 * time.Hour, `date_trunc('day', %s)`, "1h", 0},
+}
+
+func findCandleInterval(name string) (candleInterval, bool) {
+	for _, i := range candleIntervals {
+		if i.name == name {
+			return i, true
+		}
+	}
+	return candleInterval{}, false
+}
+
+// recordRateTick appends a rate change to rate_history and publishes it
+// once tx commits.
+func (s *RateService) recordRateTick(tx *sql.Tx, fromCurrency, toCurrency string, rate money.Decimal, source string) error {
+	tick := models.RateTick{FromCurrency: fromCurrency, ToCurrency: toCurrency, Rate: rate, Source: source}
+	err := tx.QueryRow(`
+		INSERT INTO rate_history (from_currency, to_currency, rate, source, recorded_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+		RETURNING recorded_at`,
+		fromCurrency, toCurrency, rate, source).Scan(&tick.RecordedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record rate history: %w", err)
+	}
+
+	pair := rates.Pair(fromCurrency, toCurrency)
+	afterCommit(tx, "rate:"+pair, func() {
+		publish(s.publisher, events.RateUpdated, events.RatesTopic(pair), 0, tick)
+	})
+	return nil
+}
+
+// GetCandles returns OHLC candles of a pair for buckets starting in
+// [from, to), oldest first. A zero to means now, a zero from one page of
+// candles before to. Buckets without rate changes carry the previous close
+// forward; offset and limit count buckets.
+func (s *RateService) GetCandles(fromCurrency, toCurrency, interval string, from, to time.Time, limit, offset int) ([]models.RateCandle, error) {
+	ci, ok := findCandleInterval(interval)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownInterval, interval)
+	}
+	if limit > maxCandles {
+		limit = maxCandles
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.Add(-time.Duration(limit) * ci.length)
+	}
+	if s.db == nil {
+		return []models.RateCandle{}, nil
+	}
+
+	// The buckets of this page
+	start := from.UTC().Truncate(ci.length)
+	if start.Before(from) {
+		start = start.Add(ci.length)
+	}
+	start = start.Add(time.Duration(offset) * ci.length)
+	end := start.Add(time.Duration(limit) * ci.length)
+	if end.After(to) {
+		end = to.UTC()
+	}
+	if !start.Before(end) {
+		return []models.RateCandle{}, nil
+	}
+
+	rows, err := s.db.Query(`
+		SELECT from_currency, to_currency, period, bucket_start, open, high, low, close, ticks
+		FROM rate_candles
+		WHERE from_currency = $1 AND to_currency = $2 AND period = $3
+		AND bucket_start >= $4 AND bucket_start < $5
+		ORDER BY bucket_start`,
+		fromCurrency, toCurrency, interval, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get candles: %w", err)
+	}
+	defer rows.Close()
+
+	stored := []models.RateCandle{}
+	for rows.Next() {
+		c, err := scanCandle(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan candle: %w", err)
+		}
+		stored = append(stored, *c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get candles: %w", err)
+	}
+
+	// The close that carries into the page
+	prev, err := scanCandle(s.db.QueryRow(`
+		SELECT from_currency, to_currency, period, bucket_start, open, high, low, close, ticks
+		FROM rate_candles
+		WHERE from_currency = $1 AND to_currency = $2 AND period = $3 AND bucket_start < $4
+		ORDER BY bucket_start DESC
+		LIMIT 1`,
+		fromCurrency, toCurrency, interval, start))
+	if err == sql.ErrNoRows {
+		prev = nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get candle: %w", err)
+	}
+
+	return fillCandleGaps(stored, prev, ci, start, end), nil
+}
+
+func scanCandle(row rowScanner) (*models.RateCandle, error) {
+	var c models.RateCandle
+	err := row.Scan(&c.FromCurrency, &c.ToCurrency, &c.Interval, &c.Start,
+		&c.Open, &c.High, &c.Low, &c.Close, &c.Ticks)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// fillCandleGaps returns a candle for every bucket in [start, end), taking
+// stored candles where there are any. An empty bucket gets a flat candle at
+// the previous close with no ticks; buckets before the first known rate are
+// left out.
+func fillCandleGaps(stored []models.RateCandle, prev *models.RateCandle, ci candleInterval, start, end time.Time) []models.RateCandle {
+	candles := []models.RateCandle{}
+	i := 0
+	for bucket := start; bucket.Before(end); bucket = bucket.Add(ci.length) {
+		next := bucket.Add(ci.length)
+		found := false
+		for ; i < len(stored) && stored[i].Start.Before(next); i++ {
+			candles = append(candles, stored[i])
+			prev = &stored[i]
+			found = true
+		}
+		if found || prev == nil {
+			continue
+		}
+		candles = append(candles, models.RateCandle{
+			FromCurrency: prev.FromCurrency,
+			ToCurrency:   prev.ToCurrency,
+			Interval:     ci.name,
+			Start:        bucket,
+			Open:         prev.Close,
+			High:         prev.Close,
+			Low:          prev.Close,
+			Close:        prev.Close,
+		})
+	}
+	return candles
+}
+
+// GetRateAt returns the rate that was live at a moment: the last change at
+// or before it. Once raw ticks have been pruned the close of the finest
+// candle still kept is used instead.
+func (s *RateService) GetRateAt(fromCurrency, toCurrency string, at time.Time) (*models.RateTick, error) {
+	if s.db == nil {
+		return nil, fmt.Errorf("%w: no rate history without a database", ErrRateNotFound)
+	}
+
+	tick := models.RateTick{FromCurrency: fromCurrency, ToCurrency: toCurrency}
+	err := s.db.QueryRow(`
+		SELECT rate, COALESCE(source, ''), recorded_at
+		FROM rate_history
+		WHERE from_currency = $1 AND to_currency = $2 AND recorded_at <= $3
+		ORDER BY recorded_at DESC, id DESC
+		LIMIT 1`,
+		fromCurrency, toCurrency, at).Scan(&tick.Rate, &tick.Source, &tick.RecordedAt)
+	if err == nil {
+		return &tick, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get rate history: %w", err)
+	}
+
+	for _, interval := range candleIntervals {
+		// A candle that ends after at would leak later rates into its close
+		err := s.db.QueryRow(`
+			SELECT close, bucket_start
+			FROM rate_candles
+			WHERE from_currency = $1 AND to_currency = $2 AND period = $3
+			AND bucket_start + $4 * INTERVAL '1 second' <= $5
+			ORDER BY bucket_start DESC
+			LIMIT 1`,
+			fromCurrency, toCurrency, interval.name, interval.length.Seconds(), at).Scan(&tick.Rate, &tick.RecordedAt)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get candle: %w", err)
+		}
+		tick.Source = "candle:" + interval.name
+		return &tick, nil
+	}
+
+	return nil, fmt.Errorf("%w for %s to %s at %s", ErrRateNotFound, fromCurrency, toCurrency, at.Format(time.RFC3339))
+}
+
+// StartCandleAggregation rolls rate changes up into candles every minute and
+// prunes ticks and candles past their retention.
+func (s *RateService) StartCandleAggregation(tickRetention time.Duration) {
+	log.Println("🕯️ Starting rate candle aggregation...")
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := s.aggregateCandles(); err != nil {
+			log.Printf("Error aggregating rate candles: %v", err)
+			continue
+		}
+		if err := s.pruneRateHistory(tickRetention); err != nil {
+			log.Printf("Error pruning rate history: %v", err)
+		}
+	}
+}
+
+// aggregateCandles rebuilds the two most recent buckets of every interval.
+// Rebuilding is idempotent, so a missed run is caught up by the next.
+func (s *RateService) aggregateCandles() error {
+	for _, interval := range candleIntervals {
+		since := 2 * interval.length
+
+		var query string
+		if interval.source == "" {
+			bucket := fmt.Sprintf(interval.bucket, "recorded_at")
+			query = `
+				INSERT INTO rate_candles (from_currency, to_currency, period, bucket_start, open, high, low, close, ticks)
+				SELECT from_currency, to_currency, $1::varchar, ` + bucket + `,
+					(array_agg(rate ORDER BY recorded_at, id))[1], MAX(rate), MIN(rate),
+					(array_agg(rate ORDER BY recorded_at DESC, id DESC))[1], COUNT(*)
+				FROM rate_history
+				WHERE recorded_at >= ` + fmt.Sprintf(interval.bucket, `CURRENT_TIMESTAMP - $2 * INTERVAL '1 second'`) + `
+				GROUP BY from_currency, to_currency, ` + bucket
+		} else {
+			bucket := fmt.Sprintf(interval.bucket, "bucket_start")
+			query = `
+				INSERT INTO rate_candles (from_currency, to_currency, period, bucket_start, open, high, low, close, ticks)
+				SELECT from_currency, to_currency, $1::varchar, ` + bucket + `,
+					(array_agg(open ORDER BY bucket_start))[1], MAX(high), MIN(low),
+					(array_agg(close ORDER BY bucket_start DESC))[1], SUM(ticks)
+				FROM rate_candles
+				WHERE period = $3
+				AND bucket_start >= ` + fmt.Sprintf(interval.bucket, `CURRENT_TIMESTAMP - $2 * INTERVAL '1 second'`) + `
+				GROUP BY from_currency, to_currency, ` + bucket
+		}
+		query += `
+			ON CONFLICT (from_currency, to_currency, period, bucket_start) DO UPDATE
+			SET open = EXCLUDED.open, high = EXCLUDED.high, low = EXCLUDED.low,
+				close = EXCLUDED.close, ticks = EXCLUDED.ticks`
+
+		args := []interface{}{interval.name, since.Seconds()}
+		if interval.source != "" {
+			args = append(args, interval.source)
+		}
+		if _, err := s.db.Exec(query, args...); err != nil {
+			return fmt.Errorf("failed to aggregate %s candles: %w", interval.name, err)
+		}
+	}
+	return nil
+}
+
+// pruneRateHistory downsamples old data: raw ticks are dropped after
+// tickRetention, fine candles after their own retention. Coarser candles
+// built from them are kept.
+func (s *RateService) pruneRateHistory(tickRetention time.Duration) error {
+	if tickRetention > 0 {
+		_, err := s.db.Exec(`
+			DELETE FROM rate_history WHERE recorded_at < CURRENT_TIMESTAMP - $1 * INTERVAL '1 second'`,
+			tickRetention.Seconds())
+		if err != nil {
+			return fmt.Errorf("failed to prune rate history: %w", err)
+		}
+	}
+
+	for _, interval := range candleIntervals {
+		if interval.retention == 0 {
+			continue
+		}
+		_, err := s.db.Exec(`
+			DELETE FROM rate_candles
+			WHERE period = $1 AND bucket_start < CURRENT_TIMESTAMP - $2 * INTERVAL '1 second'`,
+			interval.name, interval.retention.Seconds())
+		if err != nil {
+			return fmt.Errorf("failed to prune %s candles: %w", interval.name, err)
+		}
+	}
+	return nil
+}
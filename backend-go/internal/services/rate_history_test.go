@@ -0,0 +1,134 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"bdpayx-backend/internal/models"
+	"bdpayx-backend/internal/money"
+)
+
+func testCandle(start time.Time, open, high, low, close string, ticks int) models.RateCandle {
+	return models.RateCandle{
+		FromCurrency: "BDT",
+		ToCurrency:   "INR",
+		Interval:     "1m",
+		Start:        start,
+		Open:         money.MustParse(open),
+		High:         money.MustParse(high),
+		Low:          money.MustParse(low),
+		Close:        money.MustParse(close),
+		Ticks:        ticks,
+	}
+}
+
+func TestFillCandleGaps(t *testing.T) {
+	ci, _ := findCandleInterval("1m")
+	t0 := time.Date(2024, 12, 15, 10, 0, 0, 0, time.UTC)
+	minute := func(n int) time.Time { return t0.Add(time.Duration(n) * time.Minute) }
+
+	stored := []models.RateCandle{
+		testCandle(minute(1), "0.7000", "0.7010", "0.6990", "0.7005", 4),
+		testCandle(minute(4), "0.7005", "0.7020", "0.7005", "0.7020", 2),
+	}
+	candles := fillCandleGaps(stored, nil, ci, t0, minute(7))
+
+	// Nothing is known before minute 1, after it every bucket has a candle
+	want := []struct {
+		start int
+		close string
+		ticks int
+	}{
+		{1, "0.7005", 4},
+		{2, "0.7005", 0},
+		{3, "0.7005", 0},
+		{4, "0.7020", 2},
+		{5, "0.7020", 0},
+		{6, "0.7020", 0},
+	}
+	if len(candles) != len(want) {
+		t.Fatalf("got %d candles, want %d: %+v", len(candles), len(want), candles)
+	}
+	for i, w := range want {
+		c := candles[i]
+		if !c.Start.Equal(minute(w.start)) || c.Close.String() != w.close || c.Ticks != w.ticks {
+			t.Errorf("candle %d = %s close %s ticks %d, want minute %d close %s ticks %d",
+				i, c.Start.Format("15:04"), c.Close, c.Ticks, w.start, w.close, w.ticks)
+		}
+		if c.Ticks == 0 {
+			if !c.Open.Equal(c.Close) || !c.High.Equal(c.Close) || !c.Low.Equal(c.Close) {
+				t.Errorf("filled candle %d is not flat: %+v", i, c)
+			}
+			if c.FromCurrency != "BDT" || c.ToCurrency != "INR" || c.Interval != "1m" {
+				t.Errorf("filled candle %d has pair %s_%s %s", i, c.FromCurrency, c.ToCurrency, c.Interval)
+			}
+		}
+	}
+}
+
+func TestFillCandleGapsCarriesIntoPage(t *testing.T) {
+	ci, _ := findCandleInterval("1h")
+	t0 := time.Date(2024, 12, 15, 0, 0, 0, 0, time.UTC)
+	prev := testCandle(t0.Add(-5*time.Hour), "1.4200", "1.4300", "1.4100", "1.4261", 9)
+
+	candles := fillCandleGaps(nil, &prev, ci, t0, t0.Add(3*time.Hour))
+	if len(candles) != 3 {
+		t.Fatalf("got %d candles, want 3", len(candles))
+	}
+	for i, c := range candles {
+		if !c.Start.Equal(t0.Add(time.Duration(i)*time.Hour)) || c.Close.String() != "1.4261" || c.Interval != "1h" {
+			t.Errorf("candle %d = %+v", i, c)
+		}
+	}
+
+	if candles := fillCandleGaps(nil, nil, ci, t0, t0.Add(3*time.Hour)); len(candles) != 0 {
+		t.Errorf("got %d candles for a pair without history", len(candles))
+	}
+}
+
+func TestGetCandlesFillsGaps(t *testing.T) {
+	db := testDB(t)
+	s := NewRateService(db, nil, money.HalfUp, nil, time.Minute, nil, nil)
+
+	// A stretch of past no other test writes to
+	t0 := time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(time.Now().UnixNano()%1e6) * time.Hour)
+	for _, c := range []models.RateCandle{
+		testCandle(t0, "0.7000", "0.7000", "0.7000", "0.7000", 1),
+		testCandle(t0.Add(3*time.Minute), "0.7100", "0.7100", "0.7100", "0.7100", 1),
+	} {
+		_, err := db.Exec(`
+			INSERT INTO rate_candles (from_currency, to_currency, period, bucket_start, open, high, low, close, ticks)
+			VALUES ('XTA', 'XTB', '1m', $1, $2, $3, $4, $5, $6)`,
+			c.Start, c.Open, c.High, c.Low, c.Close, c.Ticks)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	candles, err := s.GetCandles("XTA", "XTB", "1m", t0.Add(time.Minute), t0.Add(5*time.Minute), 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closes := []string{}
+	for _, c := range candles {
+		closes = append(closes, c.Close.String())
+	}
+	want := []string{"0.70000000", "0.70000000", "0.71000000", "0.71000000"}
+	if len(closes) != len(want) {
+		t.Fatalf("closes %v, want %v", closes, want)
+	}
+	for i := range want {
+		if closes[i] != want[i] {
+			t.Fatalf("closes %v, want %v", closes, want)
+		}
+	}
+
+	// Offset and limit count buckets
+	candles, err = s.GetCandles("XTA", "XTB", "1m", t0.Add(time.Minute), t0.Add(5*time.Minute), 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candles) != 2 || !candles[0].Start.Equal(t0.Add(2*time.Minute)) || candles[1].Ticks != 1 {
+		t.Errorf("page %+v", candles)
+	}
+}
@@ -0,0 +1,414 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"bdpayx-backend/internal/models"
+	"bdpayx-backend/internal/rates"
+)
+
+var (
+	ErrOverrideNotFound = errors.New("rate override not found")
+	ErrOverrideOverlap  = errors.New("rate override overlaps another override of the pair")
+	ErrOverrideResolved = errors.New("rate override has already ended")
+	ErrInvalidOverride  = errors.New("invalid rate override")
+)
+
+// overrideCheckInterval is how late a scheduled override may start or end
+const overrideCheckInterval = 5 * time.Second
+
+const overrideColumns = `id, from_currency, to_currency, rate, spread, previous_spread, status, force,
+	starts_at, expires_at, COALESCE(reason, ''), created_by, cancelled_by, created_at, updated_at`
+
+func scanRateOverride(row rowScanner) (*models.RateOverride, error) {
+	var o models.RateOverride
+	var cancelledBy sql.NullInt64
+	err := row.Scan(&o.ID, &o.FromCurrency, &o.ToCurrency, &o.Rate, &o.Spread, &o.PreviousSpread, &o.Status,
+		&o.Force, &o.StartsAt, &o.ExpiresAt, &o.Reason, &o.CreatedBy, &cancelledBy, &o.CreatedAt, &o.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if cancelledBy.Valid {
+		id := int(cancelledBy.Int64)
+		o.CancelledBy = &id
+	}
+	return &o, nil
+}
+
+// applyOverrideModes marks the pairs an active override pins and when the
+// next scheduled one starts.
+func (s *RateService) applyOverrideModes(result map[string]models.ExchangeRate) error {
+	rows, err := s.db.Query(`
+		SELECT from_currency, to_currency, status, starts_at, expires_at
+		FROM rate_overrides
+		WHERE status IN ($1, $2)
+		ORDER BY starts_at`,
+		models.OverrideActive, models.OverrideScheduled)
+	if err != nil {
+		return fmt.Errorf("failed to get rate overrides: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var from, to, status string
+		var startsAt time.Time
+		var expiresAt *time.Time
+		if err := rows.Scan(&from, &to, &status, &startsAt, &expiresAt); err != nil {
+			return fmt.Errorf("failed to scan rate override: %w", err)
+		}
+
+		pair := rates.Pair(from, to)
+		rate, ok := result[pair]
+		if !ok {
+			continue
+		}
+		if status == models.OverrideActive {
+			rate.Mode = models.RateModePinned
+			rate.PinnedUntil = expiresAt
+		} else if rate.ScheduledAt == nil {
+			rate.ScheduledAt = &startsAt
+		}
+		result[pair] = rate
+	}
+	return rows.Err()
+}
+
+// CreateOverride pins a pair's rate now or at a later time. One that starts
+// now replaces the rate at once; a scheduled one is applied by
+// StartRateOverrides. Overrides of a pair may not overlap, and like any admin
+// rate they are refused when they would open an arbitrage loop unless forced.
+// Unforced scheduled ones are checked again when they start.
+func (s *RateService) CreateOverride(adminID int, req models.RateOverrideRequest) (*models.RateOverride, []models.ArbitrageLoop, error) {
+	if err := validateSpread(req.Spread); err != nil {
+		return nil, nil, err
+	}
+	if s.db == nil {
+		return nil, nil, fmt.Errorf("%w: overrides need a database", ErrInvalidOverride)
+	}
+
+	now := time.Now().UTC()
+	startsAt := now
+	if req.StartsAt != nil && req.StartsAt.After(now) {
+		startsAt = req.StartsAt.UTC()
+	}
+	var expiresAt *time.Time
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(startsAt) {
+			return nil, nil, fmt.Errorf("%w: expires_at must be after starts_at", ErrInvalidOverride)
+		}
+		utc := req.ExpiresAt.UTC()
+		expiresAt = &utc
+	}
+
+	current, err := s.GetRates()
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, ok := current[rates.Pair(req.FromCurrency, req.ToCurrency)]; !ok {
+		return nil, nil, fmt.Errorf("%w for %s to %s", ErrRateNotFound, req.FromCurrency, req.ToCurrency)
+	}
+	loops, err := s.checkArbitrage(current, req.FromCurrency, req.ToCurrency, req.Rate, req.Spread, req.Force)
+	if err != nil {
+		return nil, loops, err
+	}
+
+	status := models.OverrideScheduled
+	if !startsAt.After(now) {
+		status = models.OverrideActive
+	}
+
+	var override *models.RateOverride
+	err = runInTx(s.db, func(tx *sql.Tx) error {
+		var rateID int
+		err := tx.QueryRow(`
+			SELECT id FROM exchange_rates WHERE from_currency = $1 AND to_currency = $2 FOR UPDATE`,
+			req.FromCurrency, req.ToCurrency).Scan(&rateID)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%w for %s to %s", ErrRateNotFound, req.FromCurrency, req.ToCurrency)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to lock exchange rate: %w", err)
+		}
+
+		var overlapping int
+		err = tx.QueryRow(`
+			SELECT COUNT(*) FROM rate_overrides
+			WHERE from_currency = $1 AND to_currency = $2 AND status IN ($3, $4)
+			AND starts_at < COALESCE($6::TIMESTAMP, 'infinity')
+			AND COALESCE(expires_at, 'infinity') > $5`,
+			req.FromCurrency, req.ToCurrency, models.OverrideScheduled, models.OverrideActive,
+			startsAt, expiresAt).Scan(&overlapping)
+		if err != nil {
+			return fmt.Errorf("failed to check rate overrides: %w", err)
+		}
+		if overlapping > 0 {
+			return ErrOverrideOverlap
+		}
+
+		override, err = scanRateOverride(tx.QueryRow(`
+			INSERT INTO rate_overrides (from_currency, to_currency, rate, spread, status, force, starts_at, expires_at,
+				reason, created_by, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+			RETURNING `+overrideColumns,
+			req.FromCurrency, req.ToCurrency, req.Rate, req.Spread, status, req.Force, startsAt, expiresAt,
+			req.Reason, adminID))
+		if err != nil {
+			return fmt.Errorf("failed to create rate override: %w", err)
+		}
+
+		if status == models.OverrideActive {
+			return s.pinRate(tx, override)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return override, loops, nil
+}
+
+// GetOverrides lists overrides, newest first, optionally of one status.
+func (s *RateService) GetOverrides(status string, limit, offset int) ([]models.RateOverride, error) {
+	if s.db == nil {
+		return []models.RateOverride{}, nil
+	}
+
+	rows, err := s.db.Query(`
+		SELECT `+overrideColumns+`
+		FROM rate_overrides
+		WHERE ($1 = '' OR status = $1)
+		ORDER BY starts_at DESC, id DESC
+		LIMIT $2 OFFSET $3`,
+		status, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rate overrides: %w", err)
+	}
+	defer rows.Close()
+
+	overrides := []models.RateOverride{}
+	for rows.Next() {
+		o, err := scanRateOverride(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan rate override: %w", err)
+		}
+		overrides = append(overrides, *o)
+	}
+
+	return overrides, nil
+}
+
+// CancelOverride ends a scheduled or active override. A pair it pinned gets
+// its spread back and moves again from the next feed refresh.
+func (s *RateService) CancelOverride(overrideID, adminID int) (*models.RateOverride, error) {
+	if s.db == nil {
+		return nil, ErrOverrideNotFound
+	}
+
+	var override *models.RateOverride
+	err := runInTx(s.db, func(tx *sql.Tx) error {
+		var err error
+		override, err = s.endOverride(tx, overrideID, models.OverrideCancelled, &adminID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return override, nil
+}
+
+// StartRateOverrides starts scheduled overrides and expires ended ones.
+// Everything is read from rate_overrides, so a restart picks up where the
+// last run stopped.
+func (s *RateService) StartRateOverrides() {
+	log.Println("📌 Starting rate override scheduler...")
+
+	ticker := time.NewTicker(overrideCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := s.applyRateOverrides(); err != nil {
+			log.Printf("Error applying rate overrides: %v", err)
+		}
+	}
+}
+
+// applyRateOverrides expires before it activates, so an override can take
+// over from one that ends at the same moment.
+func (s *RateService) applyRateOverrides() error {
+	// starts_at and expires_at are UTC; CURRENT_TIMESTAMP would compare them
+	// in the database's time zone
+	now := time.Now().UTC()
+
+	// Scheduled overrides that ended while we were down never apply
+	ended, err := s.overrideIDs(`status IN ($1, $2) AND expires_at <= $3`,
+		models.OverrideActive, models.OverrideScheduled, now)
+	if err != nil {
+		return fmt.Errorf("failed to find ended rate overrides: %w", err)
+	}
+	expired := 0
+	for _, id := range ended {
+		err := runInTx(s.db, func(tx *sql.Tx) error {
+			_, err := s.endOverride(tx, id, models.OverrideExpired, nil)
+			return err
+		})
+		// Cancelled since the query ran
+		if errors.Is(err, ErrOverrideResolved) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to expire rate override %d: %w", id, err)
+		}
+		expired++
+	}
+	if expired > 0 {
+		log.Printf("📌 %d rate overrides expired", expired)
+	}
+
+	due, err := s.overrideIDs(`status = $1 AND starts_at <= $2`, models.OverrideScheduled, now)
+	if err != nil {
+		return fmt.Errorf("failed to find due rate overrides: %w", err)
+	}
+	for _, id := range due {
+		if err := s.activateOverride(id); err != nil {
+			log.Printf("Error activating rate override %d: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// overrideIDs lists the overrides matching where, in the order they start.
+func (s *RateService) overrideIDs(where string, args ...interface{}) ([]int, error) {
+	rows, err := s.db.Query(`SELECT id FROM rate_overrides WHERE `+where+` ORDER BY starts_at, id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// activateOverride starts a scheduled override. Rates have moved since it
+// was created, so an unforced one that would now open an arbitrage loop is
+// skipped instead.
+func (s *RateService) activateOverride(overrideID int) error {
+	override, err := scanRateOverride(s.db.QueryRow(`
+		SELECT `+overrideColumns+` FROM rate_overrides WHERE id = $1`, overrideID))
+	if err != nil {
+		return fmt.Errorf("failed to get rate override: %w", err)
+	}
+
+	status := models.OverrideActive
+	if !override.Force {
+		current, err := s.GetRates()
+		if err != nil {
+			return err
+		}
+		loops, err := s.checkArbitrage(current, override.FromCurrency, override.ToCurrency, override.Rate, override.Spread, false)
+		if errors.Is(err, ErrArbitrage) {
+			log.Printf("⚠️ Skipping rate override %d: %s_%s at %s would open %d arbitrage loops",
+				override.ID, override.FromCurrency, override.ToCurrency, override.Rate, len(loops))
+			status = models.OverrideSkipped
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return runInTx(s.db, func(tx *sql.Tx) error {
+		// Another instance may have activated or an admin cancelled it meanwhile
+		override, err := scanRateOverride(tx.QueryRow(`
+			UPDATE rate_overrides
+			SET status = $1, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $2 AND status = $3
+			RETURNING `+overrideColumns,
+			status, overrideID, models.OverrideScheduled))
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to activate rate override: %w", err)
+		}
+		if status == models.OverrideSkipped {
+			return nil
+		}
+
+		log.Printf("📌 Pinned %s_%s at %s until %s", override.FromCurrency, override.ToCurrency,
+			override.Rate, untilText(override.ExpiresAt))
+		return s.pinRate(tx, override)
+	})
+}
+
+// pinRate applies an override that has just become active. A spread it
+// replaces is kept on the override for endOverride to restore.
+func (s *RateService) pinRate(tx *sql.Tx, override *models.RateOverride) error {
+	if override.Spread != nil {
+		_, err := tx.Exec(`
+			UPDATE rate_overrides o
+			SET previous_spread = r.spread
+			FROM exchange_rates r
+			WHERE o.id = $1 AND r.from_currency = o.from_currency AND r.to_currency = o.to_currency`,
+			override.ID)
+		if err != nil {
+			return fmt.Errorf("failed to record previous spread: %w", err)
+		}
+	}
+	return s.saveRate(tx, override.FromCurrency, override.ToCurrency, override.Rate, override.Spread, "override")
+}
+
+// endOverride moves a scheduled or active override to status, expired or
+// cancelled. An active one gives the pair back the spread it replaced.
+func (s *RateService) endOverride(tx *sql.Tx, overrideID int, status string, cancelledBy *int) (*models.RateOverride, error) {
+	var current string
+	err := tx.QueryRow(`SELECT status FROM rate_overrides WHERE id = $1 FOR UPDATE`, overrideID).Scan(&current)
+	if err == sql.ErrNoRows {
+		return nil, ErrOverrideNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock rate override: %w", err)
+	}
+	if current != models.OverrideScheduled && current != models.OverrideActive {
+		return nil, fmt.Errorf("%w: %s", ErrOverrideResolved, current)
+	}
+
+	override, err := scanRateOverride(tx.QueryRow(`
+		UPDATE rate_overrides
+		SET status = $1, cancelled_by = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3
+		RETURNING `+overrideColumns,
+		status, cancelledBy, overrideID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to end rate override: %w", err)
+	}
+
+	if current == models.OverrideActive && override.PreviousSpread != nil {
+		_, err := tx.Exec(`
+			UPDATE exchange_rates
+			SET spread = $1, updated_at = CURRENT_TIMESTAMP
+			WHERE from_currency = $2 AND to_currency = $3`,
+			*override.PreviousSpread, override.FromCurrency, override.ToCurrency)
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore spread: %w", err)
+		}
+	}
+	return override, nil
+}
+
+func untilText(t *time.Time) string {
+	if t == nil {
+		return "cancelled"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"bdpayx-backend/internal/events"
+	"bdpayx-backend/internal/models"
+	"bdpayx-backend/internal/money"
+)
+
+// testRateService starts the pairs XOA_XOB and XOB_XOA afresh. Nothing else
+// quotes these codes, so their loops are their own.
+func testRateService(t *testing.T, db *sql.DB) *RateService {
+	t.Helper()
+
+	for _, query := range []string{
+		`DELETE FROM rate_overrides WHERE from_currency IN ('XOA', 'XOB')`,
+		`DELETE FROM exchange_rates WHERE from_currency IN ('XOA', 'XOB')`,
+	} {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := NewRateService(db, nil, money.HalfUp, nil, time.Minute, NewPricingService(db), events.NewMemoryBroker())
+	spread := money.MustParse("0.0100")
+	if err := s.SaveRate("XOA", "XOB", money.MustParse("2.0000"), &spread, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveRate("XOB", "XOA", money.MustParse("0.4900"), &spread, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func testSpread(t *testing.T, s *RateService) string {
+	t.Helper()
+	rate, err := s.storedRate("XOA", "XOB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rate.Spread.String()
+}
+
+func TestOverrideRestoresSpread(t *testing.T) {
+	db := testDB(t)
+	s := testRateService(t, db)
+	adminID := createTestUser(t, db)
+
+	spread := money.MustParse("0.0300")
+	override, _, err := s.CreateOverride(adminID, models.RateOverrideRequest{
+		FromCurrency: "XOA", ToCurrency: "XOB", Rate: money.MustParse("1.9000"), Spread: &spread,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := testSpread(t, s); got != "0.0300" {
+		t.Fatalf("spread %s while pinned, want 0.0300", got)
+	}
+
+	// Admin rates are refused while the pair is pinned
+	if err := s.SaveRate("XOA", "XOB", money.MustParse("2.1000"), nil, "admin"); !errors.Is(err, ErrRatePinned) {
+		t.Errorf("SaveRate on a pinned pair: %v, want ErrRatePinned", err)
+	}
+
+	cancelled, err := s.CancelOverride(override.ID, adminID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled.PreviousSpread == nil || cancelled.PreviousSpread.String() != "0.0100" {
+		t.Errorf("previous spread %v, want 0.0100", cancelled.PreviousSpread)
+	}
+	if got := testSpread(t, s); got != "0.0100" {
+		t.Errorf("spread %s after cancel, want 0.0100 back", got)
+	}
+	if _, err := s.CancelOverride(override.ID, adminID); !errors.Is(err, ErrOverrideResolved) {
+		t.Errorf("second cancel: %v, want ErrOverrideResolved", err)
+	}
+}
+
+func TestOverrideExpiryRestoresSpread(t *testing.T) {
+	db := testDB(t)
+	s := testRateService(t, db)
+	adminID := createTestUser(t, db)
+
+	spread := money.MustParse("0.0300")
+	expiresAt := time.Now().Add(time.Hour)
+	override, _, err := s.CreateOverride(adminID, models.RateOverrideRequest{
+		FromCurrency: "XOA", ToCurrency: "XOB", Rate: money.MustParse("1.9000"), Spread: &spread,
+		ExpiresAt: &expiresAt,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec(`UPDATE rate_overrides SET expires_at = $1 WHERE id = $2`, time.Now().UTC().Add(-time.Second), override.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.applyRateOverrides(); err != nil {
+		t.Fatal(err)
+	}
+
+	var status string
+	if err := db.QueryRow(`SELECT status FROM rate_overrides WHERE id = $1`, override.ID).Scan(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status != models.OverrideExpired {
+		t.Errorf("status %s, want expired", status)
+	}
+	if got := testSpread(t, s); got != "0.0100" {
+		t.Errorf("spread %s after expiry, want 0.0100 back", got)
+	}
+}
+
+func TestScheduledOverrideSkippedOnArbitrage(t *testing.T) {
+	db := testDB(t)
+	s := testRateService(t, db)
+	adminID := createTestUser(t, db)
+
+	// 2.0500 and back at 0.4900 returns 0.98: no loop when it is created
+	startsAt := time.Now().Add(time.Hour)
+	expiresAt := startsAt.Add(time.Hour)
+	request := models.RateOverrideRequest{
+		FromCurrency: "XOA", ToCurrency: "XOB", Rate: money.MustParse("2.0500"),
+		StartsAt: &startsAt, ExpiresAt: &expiresAt,
+	}
+	skipped, _, err := s.CreateOverride(adminID, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.StartsAt, request.ExpiresAt, request.Force = &expiresAt, nil, true
+	forced, _, err := s.CreateOverride(adminID, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The way back moves meanwhile; at 0.5000 the override would return 1.0046
+	if _, err := s.SetRate("XOB", "XOA", money.MustParse("0.5000"), nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, o := range []*models.RateOverride{skipped, forced} {
+		if _, err := db.Exec(`UPDATE rate_overrides SET starts_at = $1 WHERE id = $2`, time.Now().UTC(), o.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.activateOverride(skipped.ID); err != nil {
+		t.Fatal(err)
+	}
+	rate, _ := s.storedRate("XOA", "XOB")
+	if rate.Rate.String() != "2.00000000" {
+		t.Errorf("rate %s, want the skipped override not applied", rate.Rate)
+	}
+
+	// A forced one applies regardless
+	if err := s.activateOverride(forced.ID); err != nil {
+		t.Fatal(err)
+	}
+	rate, _ = s.storedRate("XOA", "XOB")
+	if rate.Rate.String() != "2.05000000" {
+		t.Errorf("rate %s, want the forced override applied", rate.Rate)
+	}
+
+	want := map[int]string{skipped.ID: models.OverrideSkipped, forced.ID: models.OverrideActive}
+	for id, status := range want {
+		var got string
+		if err := db.QueryRow(`SELECT status FROM rate_overrides WHERE id = $1`, id).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != status {
+			t.Errorf("override %d is %s, want %s", id, got, status)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"bdpayx-backend/internal/events"
+	"bdpayx-backend/internal/money"
+)
+
+// mockRateService prices with the mock rates: BDT_INR 0.70 and INR_BDT 1.43,
+// both with a 2% spread, and no pricing tiers.
+func mockRateService(rounding money.RoundingMode) *RateService {
+	return NewRateService(nil, nil, rounding, nil, time.Minute, NewPricingService(nil), events.NewMemoryBroker())
+}
+
+func TestSolveSendAmount(t *testing.T) {
+	tierID := 1
+	tests := []struct {
+		name     string
+		from, to string
+		rate     string
+		pricing  pricing
+		rounding money.RoundingMode
+		target   string
+	}{
+		{"spread only", "BDT", "INR", "0.70", pricing{Spread: money.MustParse("0.02")}, money.HalfUp, "1000.00"},
+		{"spread only half even", "BDT", "INR", "0.70", pricing{Spread: money.MustParse("0.02")}, money.HalfEven, "1000.00"},
+		{"odd target", "BDT", "INR", "0.70", pricing{Spread: money.MustParse("0.02")}, money.HalfUp, "123.45"},
+		{"odd target half even", "BDT", "INR", "0.70", pricing{Spread: money.MustParse("0.02")}, money.HalfEven, "123.45"},
+		{"smallest unit", "BDT", "INR", "0.70", pricing{Spread: money.MustParse("0.02")}, money.HalfUp, "0.01"},
+		{"tier with fixed fee", "BDT", "INR", "0.70",
+			pricing{TierID: &tierID, Spread: money.MustParse("0.015"), Fee: money.MustParse("25")}, money.HalfUp, "5000.00"},
+		{"tier with fixed fee half even", "BDT", "INR", "0.70",
+			pricing{TierID: &tierID, Spread: money.MustParse("0.015"), Fee: money.MustParse("25")}, money.HalfEven, "5000.00"},
+		{"tier with fractional fee", "INR", "BDT", "1.43",
+			pricing{TierID: &tierID, Spread: money.MustParse("0.01"), Fee: money.MustParse("2.505")}, money.HalfEven, "1000.01"},
+		{"tier without spread", "INR", "BDT", "1.43",
+			pricing{TierID: &tierID, Fee: money.MustParse("10")}, money.HalfUp, "715.00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := mockRateService(tt.rounding)
+			rate, target := money.MustParse(tt.rate), money.MustParse(tt.target)
+
+			amount, err := s.solveSendAmount(tt.from, tt.to, target, rate, tt.pricing)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := s.priceExchange(tt.from, tt.to, amount, rate, tt.pricing)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.ToAmount.Equal(target) {
+				t.Errorf("sending %s pays out %s, want %s", amount, got.ToAmount, target)
+			}
+
+			// One unit less must fall short, or the amount was not the smallest
+			less := amount.Sub(money.New(1, money.Decimals(tt.from)))
+			if short, err := s.priceExchange(tt.from, tt.to, less, rate, tt.pricing); err == nil && short.ToAmount.Cmp(target) >= 0 {
+				t.Errorf("sending %s already pays out %s", less, short.ToAmount)
+			}
+		})
+	}
+}
+
+func TestSolveSendAmountUnreachable(t *testing.T) {
+	s := mockRateService(money.HalfUp)
+
+	// At 1.4014 BDT per INR one paisa pays out 0.01 BDT and two pay out
+	// 0.03, so 0.02 can never arrive
+	_, err := s.solveSendAmount("INR", "BDT", money.MustParse("0.02"), money.MustParse("1.43"),
+		pricing{Spread: money.MustParse("0.02")})
+	if !errors.Is(err, ErrReceiveUnreachable) {
+		t.Fatalf("err %v, want ErrReceiveUnreachable", err)
+	}
+}
+
+func TestCalculateReceive(t *testing.T) {
+	tests := []struct {
+		from, to string
+		rounding money.RoundingMode
+		target   string
+	}{
+		{"BDT", "INR", money.HalfUp, "700.00"},
+		{"BDT", "INR", money.HalfEven, "700.00"},
+		{"BDT", "INR", money.HalfUp, "99.99"},
+		{"INR", "BDT", money.HalfUp, "1000.00"},
+		{"INR", "BDT", money.HalfEven, "1000.00"},
+		{"INR", "BDT", money.HalfEven, "14.01"},
+	}
+
+	for _, tt := range tests {
+		s := mockRateService(tt.rounding)
+		target := money.MustParse(tt.target)
+
+		receive, err := s.CalculateReceive(tt.from, tt.to, target, "")
+		if err != nil {
+			t.Errorf("%s %s to %s: %v", tt.target, tt.from, tt.to, err)
+			continue
+		}
+		if !receive.ToAmount.Equal(target) {
+			t.Errorf("%s %s to %s: receive prices %s", tt.target, tt.from, tt.to, receive.ToAmount)
+		}
+
+		send, err := s.CalculateExchange(tt.from, tt.to, receive.FromAmount, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !send.ToAmount.Equal(target) {
+			t.Errorf("%s %s to %s: sending %s pays out %s", tt.target, tt.from, tt.to, receive.FromAmount, send.ToAmount)
+		}
+	}
+}
+
+func TestCalculateReceiveUnreachable(t *testing.T) {
+	s := mockRateService(money.HalfUp)
+	if _, err := s.CalculateReceive("INR", "BDT", money.MustParse("0.02"), ""); !errors.Is(err, ErrReceiveUnreachable) {
+		t.Errorf("err %v, want ErrReceiveUnreachable", err)
+	}
+}
@@ -65,4 +65,57 @@ func (r *RedisService) Exists(key string) (bool, error) {
 	}
 	result, err := r.client.Exists(r.ctx, key).Result()
 	return result > 0, err
-}
\ No newline at end of file
+}
+
+func (r *RedisService) Publish(channel string, message interface{}) error {
+	if r == nil || r.client == nil {
+		return fmt.Errorf("redis client not available")
+	}
+	return r.client.Publish(r.ctx, channel, message).Err()
+}
+
+// publishSequenced numbers a message with INCR on KEYS[1] and publishes it
+// as "<seq>|<message>" in one step, so subscribers receive the numbers in
+// order. A positive ARGV[3] makes the counter expire after that many
+// milliseconds without messages.
+var publishSequenced = redis.NewScript(`
+local seq = redis.call('INCR', KEYS[1])
+if tonumber(ARGV[3]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+end
+redis.call('PUBLISH', ARGV[1], seq .. '|' .. ARGV[2])
+return seq
+`)
+
+// PublishSequenced publishes message on channel prefixed with the next
+// number of counterKey, and returns that number. The counter is dropped
+// once nothing has been published for ttl, or kept for good when ttl is 0.
+func (r *RedisService) PublishSequenced(channel, counterKey, message string, ttl time.Duration) (int64, error) {
+	if r == nil || r.client == nil {
+		return 0, fmt.Errorf("redis client not available")
+	}
+	return publishSequenced.Run(r.ctx, r.client, []string{counterKey}, channel, message, ttl.Milliseconds()).Int64()
+}
+
+// Subscribe calls handler with every message published on channel from now
+// on. The connection is re-established after failures; messages published
+// while it is down are lost.
+func (r *RedisService) Subscribe(channel string, handler func(payload string)) error {
+	if r == nil || r.client == nil {
+		return fmt.Errorf("redis client not available")
+	}
+
+	pubsub := r.client.Subscribe(r.ctx, channel)
+	// Wait for the subscription, so nothing published after we return is missed
+	if _, err := pubsub.Receive(r.ctx); err != nil {
+		pubsub.Close()
+		return err
+	}
+
+	go func() {
+		for msg := range pubsub.Channel() {
+			handler(msg.Payload)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"database/sql"
+	"log"
+	"sync"
+	"time"
+)
+
+// RevocationList records signed-out sessions until their access tokens
+// expire. With Redis configured every instance sees the entries; they are
+// also kept locally, so this instance's own revocations hold while Redis is
+// unreachable. Without Redis, or while it fails, sessions are looked up in
+// refresh_tokens, where signing out revokes a session's tokens.
+type RevocationList struct {
+	db          *sql.DB
+	redisClient *RedisService
+
+	mu      sync.Mutex
+	revoked map[string]time.Time
+}
+
+func NewRevocationList(db *sql.DB, redisClient *RedisService) *RevocationList {
+	return &RevocationList{
+		db:          db,
+		redisClient: redisClient,
+		revoked:     make(map[string]time.Time),
+	}
+}
+
+func revocationKey(sessionID string) string {
+	return "auth:revoked:" + sessionID
+}
+
+// Revoke rejects the access tokens of a session for ttl, which must be at
+// least their lifetime.
+func (l *RevocationList) Revoke(sessionID string, ttl time.Duration) {
+	now := time.Now()
+
+	l.mu.Lock()
+	for id, until := range l.revoked {
+		if now.After(until) {
+			delete(l.revoked, id)
+		}
+	}
+	l.revoked[sessionID] = now.Add(ttl)
+	l.mu.Unlock()
+
+	if l.redisClient != nil {
+		if err := l.redisClient.Set(revocationKey(sessionID), 1, ttl); err != nil {
+			log.Printf("Failed to store revocation of session %s: %v", sessionID, err)
+		}
+	}
+}
+
+// IsRevoked reports whether a session was signed out. When neither Redis nor
+// the database can answer, the session is treated as revoked.
+func (l *RevocationList) IsRevoked(sessionID string) bool {
+	l.mu.Lock()
+	until, ok := l.revoked[sessionID]
+	l.mu.Unlock()
+	if ok && time.Now().Before(until) {
+		return true
+	}
+
+	if l.redisClient != nil {
+		revoked, err := l.redisClient.Exists(revocationKey(sessionID))
+		if err == nil {
+			return revoked
+		}
+		log.Printf("Failed to check revocation of session %s in Redis: %v", sessionID, err)
+	}
+	return l.revokedInDB(sessionID)
+}
+
+// revokedInDB reports whether the refresh tokens of a session were revoked.
+func (l *RevocationList) revokedInDB(sessionID string) bool {
+	// Test mode without a database has nothing to look up
+	if l.db == nil {
+		return false
+	}
+
+	var revoked bool
+	err := l.db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM refresh_tokens WHERE family_id = $1 AND revoked_at IS NOT NULL)`,
+		sessionID).Scan(&revoked)
+	if err != nil {
+		log.Printf("Failed to check revocation of session %s: %v", sessionID, err)
+		return true
+	}
+	return revoked
+}
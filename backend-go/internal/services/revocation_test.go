@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"bdpayx-backend/internal/events"
+	"bdpayx-backend/internal/models"
+)
+
+// unreachableRedis fails every command, like a Redis that went away.
+func unreachableRedis(t *testing.T) *RedisService {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: 100 * time.Millisecond})
+	t.Cleanup(func() { client.Close() })
+	return &RedisService{client: client, ctx: context.Background()}
+}
+
+func TestRevocationListLocal(t *testing.T) {
+	for name, redisClient := range map[string]*RedisService{"no redis": nil, "failing redis": unreachableRedis(t)} {
+		l := NewRevocationList(nil, redisClient)
+		l.Revoke("session-a", time.Minute)
+		l.Revoke("session-b", -time.Second)
+
+		if !l.IsRevoked("session-a") {
+			t.Errorf("%s: revoked session accepted", name)
+		}
+		if l.IsRevoked("session-b") {
+			t.Errorf("%s: revocation outlived its ttl", name)
+		}
+		if l.IsRevoked("session-c") {
+			t.Errorf("%s: unknown session rejected", name)
+		}
+	}
+}
+
+func TestRevocationListFallsBackToDatabase(t *testing.T) {
+	db := testDB(t)
+	userID := createTestUser(t, db)
+
+	// Two instances without Redis: one signs the session out, the other
+	// only learns of it from the database
+	signingOut := NewRevocationList(db, nil)
+	other := NewRevocationList(db, nil)
+	failing := NewRevocationList(db, unreachableRedis(t))
+	auth := NewAuthService(db, "test-secret", time.Minute, time.Hour, signingOut, events.NewMemoryBroker())
+
+	if _, err := auth.startSession(models.User{ID: userID}); err != nil {
+		t.Fatal(err)
+	}
+	var sessionID string
+	if err := db.QueryRow(`SELECT family_id FROM refresh_tokens WHERE user_id = $1`, userID).Scan(&sessionID); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, l := range map[string]*RevocationList{"other": other, "failing redis": failing} {
+		if l.IsRevoked(sessionID) {
+			t.Errorf("%s: live session rejected", name)
+		}
+	}
+
+	if err := auth.Logout(userID, sessionID); err != nil {
+		t.Fatal(err)
+	}
+	for name, l := range map[string]*RevocationList{"signing out": signingOut, "other": other, "failing redis": failing} {
+		if !l.IsRevoked(sessionID) {
+			t.Errorf("%s: signed-out session accepted", name)
+		}
+	}
+}
+
+func TestRevocationListFailsClosed(t *testing.T) {
+	db := testDB(t)
+	l := NewRevocationList(db, unreachableRedis(t))
+	db.Close()
+
+	if !l.IsRevoked("any-session") {
+		t.Error("session accepted while neither Redis nor the database could answer")
+	}
+}
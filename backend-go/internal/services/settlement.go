@@ -0,0 +1,114 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+
+	"bdpayx-backend/internal/ledger"
+	"bdpayx-backend/internal/models"
+	"bdpayx-backend/internal/money"
+)
+
+// The methods below run inside a database transaction owned by the caller,
+// so an order's status change and its wallet movements commit together.
+
+// settleExchange completes an exchange paid from the wallet: the order's
+// hold is captured into the platform FX account, which pays the to amount
+// into the wallet. Both legs are one journal entry.
+func (s *WalletService) settleExchange(tx *sql.Tx, userID int, to money.Money, reference, description string) error {
+	hold, err := lockHoldByReference(tx, reference)
+	if err != nil {
+		return err
+	}
+
+	fxFrom, err := s.ledger.PlatformAccount(tx, ledger.PlatformFX, hold.Currency)
+	if err != nil {
+		return err
+	}
+	fxTo, err := s.ledger.PlatformAccount(tx, ledger.PlatformFX, to.Currency)
+	if err != nil {
+		return err
+	}
+	account, err := s.ledger.UserAccount(tx, userID, to.Currency)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.captureHold(tx, hold, "exchange", description, []ledger.Posting{
+		{AccountID: fxFrom.ID, Amount: hold.Amount},
+		{AccountID: fxTo.ID, Amount: to.Amount.Neg()},
+		{AccountID: account.ID, Amount: to.Amount},
+	})
+	if err != nil {
+		return err
+	}
+
+	walletID, err := s.lockWallet(tx, userID)
+	if err != nil {
+		return err
+	}
+	return s.recordHistory(tx, walletID, "exchange", to.Amount, to.Currency,
+		result.Balances[account.ID], description, result.EntryID)
+}
+
+// releaseExchange releases the hold of an exchange that will not complete.
+func (s *WalletService) releaseExchange(tx *sql.Tx, reference, description string) error {
+	hold, err := lockHoldByReference(tx, reference)
+	if err != nil {
+		return err
+	}
+	return s.releaseHold(tx, hold, models.HoldReleased, description)
+}
+
+// refundExchange reverses a settled exchange. It fails with
+// ErrInsufficientFunds if the bought currency has been spent since.
+func (s *WalletService) refundExchange(tx *sql.Tx, userID int, from, to money.Money, reference, description string) error {
+	walletID, err := s.lockWallet(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	toAccount, err := s.ledger.UserAccount(tx, userID, to.Currency)
+	if err != nil {
+		return err
+	}
+	fxTo, err := s.ledger.PlatformAccount(tx, ledger.PlatformFX, to.Currency)
+	if err != nil {
+		return err
+	}
+	fxFrom, err := s.ledger.PlatformAccount(tx, ledger.PlatformFX, from.Currency)
+	if err != nil {
+		return err
+	}
+	fromAccount, err := s.ledger.UserAccount(tx, userID, from.Currency)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.ledger.Post(tx, ledger.Entry{
+		Kind:        "exchange_refund",
+		Reference:   reference,
+		Description: description,
+		Postings: []ledger.Posting{
+			{AccountID: toAccount.ID, Amount: to.Amount.Neg()},
+			{AccountID: fxTo.ID, Amount: to.Amount},
+			{AccountID: fxFrom.ID, Amount: from.Amount.Neg()},
+			{AccountID: fromAccount.ID, Amount: from.Amount},
+		},
+	})
+	if err != nil {
+		return walletError(err)
+	}
+
+	if err := s.recordHistory(tx, walletID, "exchange_reversal", to.Amount, to.Currency,
+		result.Balances[toAccount.ID], description, result.EntryID); err != nil {
+		return err
+	}
+	return s.recordHistory(tx, walletID, "refund", from.Amount, from.Currency,
+		result.Balances[fromAccount.ID], description, result.EntryID)
+}
+
+// transactionReference is the ledger reference of an exchange order.
+func transactionReference(transactionID int) string {
+	return fmt.Sprintf("transaction:%d", transactionID)
+}
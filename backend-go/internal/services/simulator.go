@@ -0,0 +1,196 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+
+	"bdpayx-backend/internal/models"
+	"bdpayx-backend/internal/money"
+	"bdpayx-backend/internal/rates"
+)
+
+const simulatorColumns = `from_currency, to_currency, base_rate, min_rate, max_rate, base_volatility,
+	max_volatility, mean_reversion, max_trend_duration, updated_by, updated_at`
+
+func scanSimulatorParams(row rowScanner) (*models.SimulatorParams, error) {
+	var p models.SimulatorParams
+	var updatedBy sql.NullInt64
+	err := row.Scan(&p.FromCurrency, &p.ToCurrency, &p.BaseRate, &p.MinRate, &p.MaxRate,
+		&p.BaseVolatility, &p.MaxVolatility, &p.MeanReversion, &p.MaxTrendDuration,
+		&updatedBy, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if updatedBy.Valid {
+		id := int(updatedBy.Int64)
+		p.UpdatedBy = &id
+	}
+	p.Custom = true
+	return &p, nil
+}
+
+func simParams(p *models.SimulatorParams) rates.SimParams {
+	return rates.SimParams{
+		BaseRate:         p.BaseRate.Float64(),
+		MinRate:          p.MinRate.Float64(),
+		MaxRate:          p.MaxRate.Float64(),
+		BaseVolatility:   p.BaseVolatility,
+		MaxVolatility:    p.MaxVolatility,
+		MeanReversion:    p.MeanReversion,
+		MaxTrendDuration: p.MaxTrendDuration,
+	}
+}
+
+// loadSimulatorParams hands the stored per-pair parameters to the simulator.
+func (s *RateService) loadSimulatorParams() error {
+	sim := s.simulator()
+	if sim == nil || s.db == nil {
+		return nil
+	}
+
+	rows, err := s.db.Query(`SELECT ` + simulatorColumns + ` FROM rate_simulator_params`)
+	if err != nil {
+		return fmt.Errorf("failed to get simulator parameters: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanSimulatorParams(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan simulator parameters: %w", err)
+		}
+		pair := rates.Pair(p.FromCurrency, p.ToCurrency)
+		if err := sim.SetParams(pair, simParams(p)); err != nil {
+			log.Printf("Ignoring simulator parameters for %s: %v", pair, err)
+		}
+	}
+	return rows.Err()
+}
+
+func (s *RateService) simulator() *rates.Simulator {
+	if s.feed == nil {
+		return nil
+	}
+	return s.feed.Simulator()
+}
+
+// GetSimulatorParams lists the simulator parameters of every pair, with the
+// live market state of pairs that have been simulated.
+func (s *RateService) GetSimulatorParams() ([]models.SimulatorParams, error) {
+	current, err := s.GetRates()
+	if err != nil {
+		return nil, err
+	}
+
+	stored := make(map[string]*models.SimulatorParams)
+	if s.db != nil {
+		rows, err := s.db.Query(`SELECT ` + simulatorColumns + ` FROM rate_simulator_params`)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get simulator parameters: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			p, err := scanSimulatorParams(rows)
+			if err != nil {
+				return nil, fmt.Errorf("failed to scan simulator parameters: %w", err)
+			}
+			stored[rates.Pair(p.FromCurrency, p.ToCurrency)] = p
+		}
+	}
+
+	sim := s.simulator()
+	list := []models.SimulatorParams{}
+	for pair, rate := range current {
+		p, ok := stored[pair]
+		if !ok {
+			var defaults rates.SimParams
+			found := false
+			if sim != nil {
+				defaults, found = sim.Params(pair)
+			}
+			if !found {
+				defaults = rates.DefaultSimParams(rate.Rate.Float64())
+			}
+			p = &models.SimulatorParams{
+				FromCurrency:     rate.FromCurrency,
+				ToCurrency:       rate.ToCurrency,
+				BaseRate:         money.NewFromFloat(defaults.BaseRate, rateScale),
+				MinRate:          money.NewFromFloat(defaults.MinRate, rateScale),
+				MaxRate:          money.NewFromFloat(defaults.MaxRate, rateScale),
+				BaseVolatility:   defaults.BaseVolatility,
+				MaxVolatility:    defaults.MaxVolatility,
+				MeanReversion:    defaults.MeanReversion,
+				MaxTrendDuration: defaults.MaxTrendDuration,
+			}
+		}
+
+		if sim != nil {
+			if state, ok := sim.State(pair); ok {
+				p.State = &models.SimulatorState{
+					Rate:       state.Rate,
+					Trend:      state.Trend,
+					Momentum:   state.Momentum,
+					Volatility: state.Volatility,
+				}
+			}
+		}
+		list = append(list, *p)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return rates.Pair(list[i].FromCurrency, list[i].ToCurrency) < rates.Pair(list[j].FromCurrency, list[j].ToCurrency)
+	})
+	return list, nil
+}
+
+// UpdateSimulatorParams stores new parameters for a pair and applies them
+// from the next tick on.
+func (s *RateService) UpdateSimulatorParams(fromCurrency, toCurrency string, adminID int, req models.UpdateSimulatorParamsRequest) (*models.SimulatorParams, error) {
+	if _, err := s.storedRate(fromCurrency, toCurrency); err != nil {
+		return nil, err
+	}
+
+	p := &models.SimulatorParams{
+		FromCurrency:     fromCurrency,
+		ToCurrency:       toCurrency,
+		BaseRate:         req.BaseRate,
+		MinRate:          req.MinRate,
+		MaxRate:          req.MaxRate,
+		BaseVolatility:   req.BaseVolatility,
+		MaxVolatility:    req.MaxVolatility,
+		MeanReversion:    req.MeanReversion,
+		MaxTrendDuration: req.MaxTrendDuration,
+	}
+	if err := simParams(p).Validate(); err != nil {
+		return nil, err
+	}
+
+	if s.db != nil {
+		var err error
+		p, err = scanSimulatorParams(s.db.QueryRow(`
+			INSERT INTO rate_simulator_params (from_currency, to_currency, base_rate, min_rate, max_rate,
+				base_volatility, max_volatility, mean_reversion, max_trend_duration, updated_by, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+			ON CONFLICT (from_currency, to_currency) DO UPDATE
+			SET base_rate = EXCLUDED.base_rate, min_rate = EXCLUDED.min_rate, max_rate = EXCLUDED.max_rate,
+				base_volatility = EXCLUDED.base_volatility, max_volatility = EXCLUDED.max_volatility,
+				mean_reversion = EXCLUDED.mean_reversion, max_trend_duration = EXCLUDED.max_trend_duration,
+				updated_by = EXCLUDED.updated_by, updated_at = CURRENT_TIMESTAMP
+			RETURNING `+simulatorColumns,
+			fromCurrency, toCurrency, req.BaseRate, req.MinRate, req.MaxRate, req.BaseVolatility,
+			req.MaxVolatility, req.MeanReversion, req.MaxTrendDuration, adminID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to save simulator parameters: %w", err)
+		}
+	}
+
+	if sim := s.simulator(); sim != nil {
+		if err := sim.SetParams(rates.Pair(fromCurrency, toCurrency), simParams(p)); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
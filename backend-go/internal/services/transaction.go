@@ -2,41 +2,106 @@ package services
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 
+	"bdpayx-backend/internal/events"
 	"bdpayx-backend/internal/models"
+	"bdpayx-backend/internal/money"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrQuoteUsed           = errors.New("quote has already been used")
+	ErrTransactionNotFound = errors.New("transaction not found")
 )
 
+// transactionColumns is selected wherever a full models.Transaction is read
+const transactionColumns = `id, user_id, from_currency, to_currency, from_amount, to_amount, exchange_rate, fee, status, funding_source,
+	COALESCE(payment_proof, ''), COALESCE(admin_notes, ''), created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTransaction(row rowScanner) (*models.Transaction, error) {
+	var t models.Transaction
+	err := row.Scan(&t.ID, &t.UserID, &t.FromCurrency, &t.ToCurrency,
+		&t.FromAmount, &t.ToAmount, &t.ExchangeRate, &t.Fee, &t.Status, &t.FundingSource,
+		&t.PaymentProof, &t.AdminNotes, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
 type TransactionService struct {
-	db *sql.DB
+	db        *sql.DB
+	wallet    *WalletService
+	publisher events.Publisher
 }
 
-func NewTransactionService(db *sql.DB) *TransactionService {
-	return &TransactionService{db: db}
+func NewTransactionService(db *sql.DB, wallet *WalletService, publisher events.Publisher) *TransactionService {
+	return &TransactionService{db: db, wallet: wallet, publisher: publisher}
 }
 
-func (s *TransactionService) CreateTransaction(userID int, req models.CreateTransactionRequest) (*models.Transaction, error) {
-	var transaction models.Transaction
-	
-	err := s.db.QueryRow(`
-		INSERT INTO transactions (user_id, from_currency, to_currency, from_amount, to_amount, exchange_rate, status, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, 'pending', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
-		RETURNING id, user_id, from_currency, to_currency, from_amount, to_amount, exchange_rate, status, payment_proof, admin_notes, created_at, updated_at`,
-		userID, req.FromCurrency, req.ToCurrency, req.FromAmount, req.ToAmount, req.ExchangeRate).Scan(
-		&transaction.ID, &transaction.UserID, &transaction.FromCurrency, &transaction.ToCurrency,
-		&transaction.FromAmount, &transaction.ToAmount, &transaction.ExchangeRate, &transaction.Status,
-		&transaction.PaymentProof, &transaction.AdminNotes, &transaction.CreatedAt, &transaction.UpdatedAt)
-	
+// notify sends t to its owner and the admin queue once tx commits.
+func (s *TransactionService) notify(tx *sql.Tx, t *models.Transaction) {
+	afterCommit(tx, fmt.Sprintf("transaction:%d", t.ID), func() {
+		publish(s.publisher, events.TransactionUpdated, events.TopicUserTransactions, t.UserID, t)
+		publish(s.publisher, events.TransactionUpdated, events.TopicAdminQueue, 0, t)
+	})
+}
+
+// CreateTransaction places an order at the rate pinned by a redeemed quote.
+// Each quote can only be used once. Orders paid from the wallet place a hold
+// on the from amount right away and skip straight to payment_submitted.
+func (s *TransactionService) CreateTransaction(userID int, quote *Quote, payFromWallet bool) (*models.Transaction, error) {
+	var transaction *models.Transaction
+
+	status, funding, reason := models.TransactionPending, models.FundingExternal, "Order placed"
+	if payFromWallet {
+		status, funding, reason = models.TransactionPaymentSubmitted, models.FundingWallet, "Order placed, paid from wallet"
+	}
+
+	err := runInTx(s.db, func(tx *sql.Tx) error {
+		var err error
+		transaction, err = scanTransaction(tx.QueryRow(`
+			INSERT INTO transactions (user_id, from_currency, to_currency, from_amount, to_amount, exchange_rate, fee, quote_id, status, funding_source, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+			RETURNING `+transactionColumns,
+			userID, quote.FromCurrency, quote.ToCurrency, quote.FromAmount, quote.ToAmount, quote.ExchangeRate,
+			quote.Fee, quote.Nonce, status, funding))
+		if err != nil {
+			var pqErr *pq.Error
+			if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+				return ErrQuoteUsed
+			}
+			return fmt.Errorf("failed to create transaction: %w", err)
+		}
+
+		if payFromWallet {
+			_, err := s.wallet.createHold(tx, userID, money.Of(transaction.FromAmount, transaction.FromCurrency),
+				transactionReference(transaction.ID), fmt.Sprintf("Held for exchange #%d", transaction.ID), 0)
+			if err != nil {
+				return err
+			}
+		}
+
+		s.notify(tx, transaction)
+		return recordTransactionEvent(tx, transaction.ID, "", status, UserActor(userID), reason)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create transaction: %w", err)
+		return nil, err
 	}
-	
-	return &transaction, nil
+
+	return transaction, nil
 }
 
 func (s *TransactionService) GetUserTransactions(userID int, limit, offset int) ([]models.Transaction, error) {
 	rows, err := s.db.Query(`
-		SELECT id, user_id, from_currency, to_currency, from_amount, to_amount, exchange_rate, status, payment_proof, admin_notes, created_at, updated_at
+		SELECT `+transactionColumns+`
 		FROM transactions 
 		WHERE user_id = $1 
 		ORDER BY created_at DESC 
@@ -49,58 +114,36 @@ func (s *TransactionService) GetUserTransactions(userID int, limit, offset int)
 
 	var transactions []models.Transaction
 	for rows.Next() {
-		var t models.Transaction
-		err := rows.Scan(&t.ID, &t.UserID, &t.FromCurrency, &t.ToCurrency,
-			&t.FromAmount, &t.ToAmount, &t.ExchangeRate, &t.Status,
-			&t.PaymentProof, &t.AdminNotes, &t.CreatedAt, &t.UpdatedAt)
+		t, err := scanTransaction(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan transaction: %w", err)
 		}
-		transactions = append(transactions, t)
+		transactions = append(transactions, *t)
 	}
 
 	return transactions, nil
 }
 
 func (s *TransactionService) GetTransaction(transactionID, userID int) (*models.Transaction, error) {
-	var transaction models.Transaction
-	
-	err := s.db.QueryRow(`
-		SELECT id, user_id, from_currency, to_currency, from_amount, to_amount, exchange_rate, status, payment_proof, admin_notes, created_at, updated_at
+	transaction, err := scanTransaction(s.db.QueryRow(`
+		SELECT `+transactionColumns+`
 		FROM transactions 
 		WHERE id = $1 AND user_id = $2`,
-		transactionID, userID).Scan(
-		&transaction.ID, &transaction.UserID, &transaction.FromCurrency, &transaction.ToCurrency,
-		&transaction.FromAmount, &transaction.ToAmount, &transaction.ExchangeRate, &transaction.Status,
-		&transaction.PaymentProof, &transaction.AdminNotes, &transaction.CreatedAt, &transaction.UpdatedAt)
+		transactionID, userID))
 	
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("transaction not found")
+			return nil, ErrTransactionNotFound
 		}
 		return nil, fmt.Errorf("failed to get transaction: %w", err)
 	}
 	
-	return &transaction, nil
-}
-
-func (s *TransactionService) UpdateTransactionStatus(transactionID int, status, adminNotes string) error {
-	_, err := s.db.Exec(`
-		UPDATE transactions 
-		SET status = $1, admin_notes = $2, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $3`,
-		status, adminNotes, transactionID)
-	
-	if err != nil {
-		return fmt.Errorf("failed to update transaction status: %w", err)
-	}
-	
-	return nil
+	return transaction, nil
 }
 
 func (s *TransactionService) GetAllTransactions(limit, offset int) ([]models.Transaction, error) {
 	rows, err := s.db.Query(`
-		SELECT id, user_id, from_currency, to_currency, from_amount, to_amount, exchange_rate, status, payment_proof, admin_notes, created_at, updated_at
+		SELECT `+transactionColumns+`
 		FROM transactions 
 		ORDER BY created_at DESC 
 		LIMIT $1 OFFSET $2`,
@@ -112,15 +155,12 @@ func (s *TransactionService) GetAllTransactions(limit, offset int) ([]models.Tra
 
 	var transactions []models.Transaction
 	for rows.Next() {
-		var t models.Transaction
-		err := rows.Scan(&t.ID, &t.UserID, &t.FromCurrency, &t.ToCurrency,
-			&t.FromAmount, &t.ToAmount, &t.ExchangeRate, &t.Status,
-			&t.PaymentProof, &t.AdminNotes, &t.CreatedAt, &t.UpdatedAt)
+		t, err := scanTransaction(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan transaction: %w", err)
 		}
-		transactions = append(transactions, t)
+		transactions = append(transactions, *t)
 	}
 
 	return transactions, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"bdpayx-backend/internal/models"
+	"bdpayx-backend/internal/money"
+)
+
+var (
+	ErrUnknownStatus       = errors.New("unknown transaction status")
+	ErrInvalidTransition   = errors.New("invalid status transition")
+	ErrTransitionForbidden = errors.New("status transition not permitted")
+)
+
+const (
+	RoleUser   = "user"
+	RoleAdmin  = "admin"
+	RoleSystem = "system"
+)
+
+// Actor is whoever moves a transaction between statuses. System actors are
+// background jobs and carry no ID.
+type Actor struct {
+	Role string
+	ID   int
+}
+
+func UserActor(userID int) Actor {
+	return Actor{Role: RoleUser, ID: userID}
+}
+
+func AdminActor(adminID int) Actor {
+	return Actor{Role: RoleAdmin, ID: adminID}
+}
+
+var SystemActor = Actor{Role: RoleSystem}
+
+// transactionTransitions lists, for every status, the statuses it may move to
+// and which roles may make that move. Statuses without an entry are final.
+var transactionTransitions = map[string]map[string][]string{
+	models.TransactionPending: {
+		models.TransactionAwaitingPayment: {RoleAdmin, RoleSystem},
+		models.TransactionCancelled:       {RoleUser, RoleAdmin},
+		models.TransactionRejected:        {RoleAdmin},
+		models.TransactionExpired:         {RoleAdmin, RoleSystem},
+	},
+	models.TransactionAwaitingPayment: {
+		models.TransactionPaymentSubmitted: {RoleAdmin, RoleSystem},
+		models.TransactionCancelled:        {RoleAdmin},
+		models.TransactionRejected:         {RoleAdmin},
+		models.TransactionExpired:          {RoleAdmin, RoleSystem},
+	},
+	models.TransactionPaymentSubmitted: {
+		models.TransactionVerifying: {RoleAdmin, RoleSystem},
+		models.TransactionRejected:  {RoleAdmin},
+	},
+	models.TransactionVerifying: {
+		models.TransactionCompleted: {RoleAdmin},
+		models.TransactionRejected:  {RoleAdmin},
+	},
+	models.TransactionCompleted: {
+		models.TransactionRefunded: {RoleAdmin},
+	},
+}
+
+var transactionStatuses = map[string]bool{
+	models.TransactionPending:          true,
+	models.TransactionAwaitingPayment:  true,
+	models.TransactionPaymentSubmitted: true,
+	models.TransactionVerifying:        true,
+	models.TransactionCompleted:        true,
+	models.TransactionRejected:         true,
+	models.TransactionCancelled:        true,
+	models.TransactionExpired:          true,
+	models.TransactionRefunded:         true,
+}
+
+// checkTransition reports whether actor may move a transaction from one
+// status to another.
+func checkTransition(from, to string, actor Actor) error {
+	if !transactionStatuses[to] {
+		return fmt.Errorf("%w: %s", ErrUnknownStatus, to)
+	}
+	roles, ok := transactionTransitions[from][to]
+	if !ok {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, from, to)
+	}
+	for _, role := range roles {
+		if role == actor.Role {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s may not move %s -> %s", ErrTransitionForbidden, actor.Role, from, to)
+}
+
+// TransitionTransaction moves a transaction to a new status if the lifecycle
+// and the actor's role allow it, and records the change in
+// transaction_events. Users only see their own transactions; anyone else's
+// is reported as not found. Non-empty admin notes replace the stored ones.
+func (s *TransactionService) TransitionTransaction(transactionID int, to string, actor Actor, reason, adminNotes string) (*models.Transaction, error) {
+	var transaction *models.Transaction
+
+	err := runInTx(s.db, func(tx *sql.Tx) error {
+		var err error
+		transaction, err = s.transition(tx, transactionID, to, actor, reason, adminNotes)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return transaction, nil
+}
+
+// transition applies a status change inside the caller's database
+// transaction, so other work can commit or roll back with it.
+func (s *TransactionService) transition(tx *sql.Tx, transactionID int, to string, actor Actor, reason, adminNotes string) (*models.Transaction, error) {
+	var ownerID int
+	var from string
+	err := tx.QueryRow(`SELECT user_id, status FROM transactions WHERE id = $1 FOR UPDATE`,
+		transactionID).Scan(&ownerID, &from)
+	if err == sql.ErrNoRows || (err == nil && actor.Role == RoleUser && ownerID != actor.ID) {
+		return nil, ErrTransactionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock transaction: %w", err)
+	}
+
+	if err := checkTransition(from, to, actor); err != nil {
+		return nil, err
+	}
+
+	transaction, err := scanTransaction(tx.QueryRow(`
+		UPDATE transactions
+		SET status = $1, admin_notes = COALESCE(NULLIF($2, ''), admin_notes), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3
+		RETURNING `+transactionColumns,
+		to, adminNotes, transactionID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update transaction status: %w", err)
+	}
+
+	if err := s.settle(tx, transaction, to); err != nil {
+		return nil, err
+	}
+
+	if err := recordTransactionEvent(tx, transactionID, from, to, actor, reason); err != nil {
+		return nil, err
+	}
+	s.notify(tx, transaction)
+	return transaction, nil
+}
+
+// settle applies the wallet side of a status change. Only wallet funded
+// orders touch the wallet; external ones are paid in and out off-platform.
+func (s *TransactionService) settle(tx *sql.Tx, t *models.Transaction, to string) error {
+	if t.FundingSource != models.FundingWallet {
+		return nil
+	}
+
+	from := money.Of(t.FromAmount, t.FromCurrency)
+	bought := money.Of(t.ToAmount, t.ToCurrency)
+	reference := transactionReference(t.ID)
+
+	switch to {
+	case models.TransactionCompleted:
+		return s.wallet.settleExchange(tx, t.UserID, bought, reference,
+			fmt.Sprintf("Exchange #%d %s to %s", t.ID, from, bought))
+	case models.TransactionRejected, models.TransactionCancelled, models.TransactionExpired:
+		return s.wallet.releaseExchange(tx, reference,
+			fmt.Sprintf("Released hold of exchange #%d (%s)", t.ID, to))
+	case models.TransactionRefunded:
+		return s.wallet.refundExchange(tx, t.UserID, from, bought, reference,
+			fmt.Sprintf("Refund of exchange #%d", t.ID))
+	}
+	return nil
+}
+
+// GetTransactionEvents returns the status history of a transaction, oldest
+// first. A userID of 0 skips the ownership check for admins.
+func (s *TransactionService) GetTransactionEvents(transactionID, userID int) ([]models.TransactionEvent, error) {
+	var ownerID int
+	err := s.db.QueryRow(`SELECT user_id FROM transactions WHERE id = $1`, transactionID).Scan(&ownerID)
+	if err == sql.ErrNoRows || (err == nil && userID != 0 && ownerID != userID) {
+		return nil, ErrTransactionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction: %w", err)
+	}
+
+	rows, err := s.db.Query(`
+		SELECT id, transaction_id, COALESCE(from_status, ''), to_status, actor_role, actor_id, COALESCE(reason, ''), created_at
+		FROM transaction_events
+		WHERE transaction_id = $1
+		ORDER BY id`,
+		transactionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []models.TransactionEvent{}
+	for rows.Next() {
+		var e models.TransactionEvent
+		var actorID sql.NullInt64
+		err := rows.Scan(&e.ID, &e.TransactionID, &e.FromStatus, &e.ToStatus,
+			&e.ActorRole, &actorID, &e.Reason, &e.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan transaction event: %w", err)
+		}
+		if actorID.Valid {
+			id := int(actorID.Int64)
+			e.ActorID = &id
+		}
+		events = append(events, e)
+	}
+
+	return events, nil
+}
+
+func recordTransactionEvent(tx *sql.Tx, transactionID int, from, to string, actor Actor, reason string) error {
+	var actorID sql.NullInt64
+	if actor.Role != RoleSystem {
+		actorID = sql.NullInt64{Int64: int64(actor.ID), Valid: true}
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO transaction_events (transaction_id, from_status, to_status, actor_role, actor_id, reason, created_at)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5, NULLIF($6, ''), CURRENT_TIMESTAMP)`,
+		transactionID, from, to, actor.Role, actorID, reason)
+	if err != nil {
+		return fmt.Errorf("failed to record transaction event: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const maxTxAttempts = 3
+
+// isRetryable reports whether Postgres aborted the transaction because of a
+// deadlock or serialization failure, in which case running it again is safe.
+func isRetryable(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "40001" || pqErr.Code == "40P01"
+	}
+	return false
+}
+
+// commitHook is work deferred until a transaction commits. Hooks with the
+// same key replace each other, so only the last state of a changed row is
+// reported.
+type commitHook struct {
+	key string
+	fn  func()
+}
+
+var (
+	commitHooksMu sync.Mutex
+	commitHooks   = make(map[*sql.Tx][]commitHook)
+)
+
+// afterCommit runs fn once tx has committed, and never if it rolls back.
+// Only transactions started by runInTx run their hooks.
+func afterCommit(tx *sql.Tx, key string, fn func()) {
+	commitHooksMu.Lock()
+	defer commitHooksMu.Unlock()
+
+	hooks := commitHooks[tx]
+	for i := range hooks {
+		if hooks[i].key == key {
+			hooks[i].fn = fn
+			return
+		}
+	}
+	commitHooks[tx] = append(hooks, commitHook{key: key, fn: fn})
+}
+
+func takeCommitHooks(tx *sql.Tx) []commitHook {
+	commitHooksMu.Lock()
+	defer commitHooksMu.Unlock()
+
+	hooks := commitHooks[tx]
+	delete(commitHooks, tx)
+	return hooks
+}
+
+// runInTx runs fn in a database transaction, committing on success and
+// retrying the whole transaction on deadlocks and serialization failures.
+// Hooks registered with afterCommit run after the commit.
+func runInTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	var err error
+	for attempt := 1; attempt <= maxTxAttempts; attempt++ {
+		err = func() error {
+			tx, err := db.Begin()
+			if err != nil {
+				return fmt.Errorf("failed to begin transaction: %w", err)
+			}
+			defer tx.Rollback()
+			defer takeCommitHooks(tx)
+
+			if err := fn(tx); err != nil {
+				return err
+			}
+			hooks := takeCommitHooks(tx)
+			if err := tx.Commit(); err != nil {
+				return err
+			}
+			for _, hook := range hooks {
+				hook.fn()
+			}
+			return nil
+		}()
+		if !isRetryable(err) {
+			return err
+		}
+		time.Sleep(time.Duration(attempt*10) * time.Millisecond)
+	}
+	return err
+}
@@ -2,140 +2,174 @@ package services
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"log"
 
+	"bdpayx-backend/internal/events"
+	"bdpayx-backend/internal/ledger"
 	"bdpayx-backend/internal/models"
+	"bdpayx-backend/internal/money"
+)
+
+var (
+	ErrWalletNotFound    = errors.New("wallet not found")
+	ErrInsufficientFunds = errors.New("insufficient balance")
 )
 
 type WalletService struct {
-	db *sql.DB
+	db         *sql.DB
+	ledger     *ledger.Ledger
+	currencies *CurrencyService
+	publisher  events.Publisher
 }
 
-func NewWalletService(db *sql.DB) *WalletService {
-	return &WalletService{db: db}
+func NewWalletService(db *sql.DB, ledger *ledger.Ledger, currencies *CurrencyService, publisher events.Publisher) *WalletService {
+	return &WalletService{db: db, ledger: ledger, currencies: currencies, publisher: publisher}
 }
 
 func (s *WalletService) GetWallet(userID int) (*models.Wallet, error) {
 	var wallet models.Wallet
 	
 	err := s.db.QueryRow(`
-		SELECT id, user_id, bdt_balance, inr_balance, created_at, updated_at
+		SELECT id, user_id, version, created_at, updated_at
 		FROM wallets WHERE user_id = $1`, userID).Scan(
-		&wallet.ID, &wallet.UserID, &wallet.BDTBalance, &wallet.INRBalance,
-		&wallet.CreatedAt, &wallet.UpdatedAt)
+		&wallet.ID, &wallet.UserID, &wallet.Version, &wallet.CreatedAt, &wallet.UpdatedAt)
 	
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("wallet not found")
+			return nil, ErrWalletNotFound
 		}
 		return nil, fmt.Errorf("failed to get wallet: %w", err)
 	}
-	
-	return &wallet, nil
-}
 
-func (s *WalletService) Deposit(userID int, currency string, amount float64, description string) error {
-	tx, err := s.db.Begin()
+	// Balances are derived from the ledger; held funds sit in separate accounts
+	available, err := s.ledger.UserBalances(userID, ledger.AccountUserWallet)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return nil, err
 	}
-	defer tx.Rollback()
-
-	// Get current wallet
-	wallet, err := s.GetWallet(userID)
+	held, err := s.ledger.UserBalances(userID, ledger.AccountUserHeld)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Update balance based on currency
-	var newBalance float64
-	var updateQuery string
-	
-	if currency == "BDT" {
-		newBalance = wallet.BDTBalance + amount
-		updateQuery = "UPDATE wallets SET bdt_balance = $1, updated_at = CURRENT_TIMESTAMP WHERE user_id = $2"
-	} else if currency == "INR" {
-		newBalance = wallet.INRBalance + amount
-		updateQuery = "UPDATE wallets SET inr_balance = $1, updated_at = CURRENT_TIMESTAMP WHERE user_id = $2"
-	} else {
-		return fmt.Errorf("unsupported currency: %s", currency)
-	}
-
-	// Update wallet balance
-	_, err = tx.Exec(updateQuery, newBalance, userID)
-	if err != nil {
-		return fmt.Errorf("failed to update wallet balance: %w", err)
+	// Every enabled currency is listed; disabled ones while money is left in them
+	wallet.Balances = []models.Balance{}
+	for _, currency := range s.currencies.GetCurrencies(true) {
+		code := currency.Code
+		if !currency.Enabled && available[code].IsZero() && held[code].IsZero() {
+			continue
+		}
+		balance := models.Balance{
+			Currency:         code,
+			AvailableBalance: available[code].Round(currency.Decimals, money.HalfUp),
+			HeldBalance:      held[code].Round(currency.Decimals, money.HalfUp),
+		}
+		balance.Balance = balance.AvailableBalance.Add(balance.HeldBalance)
+		wallet.Balances = append(wallet.Balances, balance)
 	}
+	
+	return &wallet, nil
+}
 
-	// Record wallet transaction
-	_, err = tx.Exec(`
-		INSERT INTO wallet_transactions (wallet_id, transaction_type, currency, amount, balance_after, description, created_at)
-		VALUES ($1, 'deposit', $2, $3, $4, $5, CURRENT_TIMESTAMP)`,
-		wallet.ID, currency, amount, newBalance, description)
+// lockWallet takes a row lock on the user's wallet for the rest of tx. Every
+// wallet mutation goes through it, so balance reads, checks and writes made
+// afterwards cannot interleave with another mutation of the same wallet. The
+// owner is sent the new balances once tx commits.
+func (s *WalletService) lockWallet(tx *sql.Tx, userID int) (int, error) {
+	var walletID int
+	err := tx.QueryRow(`
+		UPDATE wallets
+		SET version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1
+		RETURNING id`, userID).Scan(&walletID)
 	if err != nil {
-		return fmt.Errorf("failed to record wallet transaction: %w", err)
+		if err == sql.ErrNoRows {
+			return 0, ErrWalletNotFound
+		}
+		return 0, fmt.Errorf("failed to lock wallet: %w", err)
 	}
 
-	return tx.Commit()
+	afterCommit(tx, fmt.Sprintf("wallet:%d", userID), func() {
+		s.publishWallet(userID)
+	})
+	return walletID, nil
 }
 
-func (s *WalletService) Withdraw(userID int, currency string, amount float64, description string) error {
-	tx, err := s.db.Begin()
+func (s *WalletService) publishWallet(userID int) {
+	wallet, err := s.GetWallet(userID)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		log.Printf("Error publishing wallet of user %d: %v", userID, err)
+		return
 	}
-	defer tx.Rollback()
+	publish(s.publisher, events.WalletUpdated, events.TopicUserWallet, userID, wallet)
+}
 
-	// Get current wallet
-	wallet, err := s.GetWallet(userID)
+// credit posts amount from the platform cash account into the user's wallet
+// inside tx and records it in the wallet history, e.g. for an approved
+// deposit.
+func (s *WalletService) credit(tx *sql.Tx, userID int, amount money.Money, transactionType, reference, description string) error {
+	walletID, err := s.lockWallet(tx, userID)
 	if err != nil {
 		return err
 	}
 
-	// Check balance and update based on currency
-	var currentBalance, newBalance float64
-	var updateQuery string
-	
-	if currency == "BDT" {
-		currentBalance = wallet.BDTBalance
-		newBalance = currentBalance - amount
-		updateQuery = "UPDATE wallets SET bdt_balance = $1, updated_at = CURRENT_TIMESTAMP WHERE user_id = $2"
-	} else if currency == "INR" {
-		currentBalance = wallet.INRBalance
-		newBalance = currentBalance - amount
-		updateQuery = "UPDATE wallets SET inr_balance = $1, updated_at = CURRENT_TIMESTAMP WHERE user_id = $2"
-	} else {
-		return fmt.Errorf("unsupported currency: %s", currency)
+	account, err := s.ledger.UserAccount(tx, userID, amount.Currency)
+	if err != nil {
+		return err
 	}
-
-	// Check if sufficient balance
-	if currentBalance < amount {
-		return fmt.Errorf("insufficient balance: have %.2f %s, need %.2f %s", currentBalance, currency, amount, currency)
+	cash, err := s.ledger.PlatformAccount(tx, ledger.PlatformCash, amount.Currency)
+	if err != nil {
+		return err
 	}
 
-	// Update wallet balance
-	_, err = tx.Exec(updateQuery, newBalance, userID)
+	result, err := s.ledger.Post(tx, ledger.Entry{
+		Kind:        transactionType,
+		Reference:   reference,
+		Description: description,
+		Postings: []ledger.Posting{
+			{AccountID: account.ID, Amount: amount.Amount},
+			{AccountID: cash.ID, Amount: amount.Amount.Neg()},
+		},
+	})
 	if err != nil {
-		return fmt.Errorf("failed to update wallet balance: %w", err)
+		return walletError(err)
 	}
 
-	// Record wallet transaction
-	_, err = tx.Exec(`
-		INSERT INTO wallet_transactions (wallet_id, transaction_type, currency, amount, balance_after, description, created_at)
-		VALUES ($1, 'withdraw', $2, $3, $4, $5, CURRENT_TIMESTAMP)`,
-		wallet.ID, currency, amount, newBalance, description)
+	return s.recordHistory(tx, walletID, transactionType, amount.Amount, amount.Currency,
+		result.Balances[account.ID], description, result.EntryID)
+}
+
+// walletError turns a ledger overdraft into ErrInsufficientFunds.
+func walletError(err error) error {
+	var insufficient *ledger.InsufficientFundsError
+	if errors.As(err, &insufficient) {
+		return fmt.Errorf("%w: have %s, need %s", ErrInsufficientFunds,
+			money.Of(insufficient.Balance, insufficient.Currency), money.Of(insufficient.Amount, insufficient.Currency))
+	}
+	return err
+}
+
+// recordHistory appends the user-facing wallet history row for a movement.
+func (s *WalletService) recordHistory(tx *sql.Tx, walletID int, transactionType string, amount money.Decimal, currency string, balanceAfter money.Decimal, description string, entryID int) error {
+	_, err := tx.Exec(`
+		INSERT INTO wallet_transactions (wallet_id, transaction_type, currency, amount, balance_after, description, journal_entry_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, CURRENT_TIMESTAMP)`,
+		walletID, transactionType, currency, amount, balanceAfter, description, entryID)
 	if err != nil {
 		return fmt.Errorf("failed to record wallet transaction: %w", err)
 	}
-
-	return tx.Commit()
+	return nil
 }
 
 func (s *WalletService) GetTransactionHistory(userID int, limit, offset int) ([]models.WalletTransaction, error) {
-	// First get the wallet ID
-	wallet, err := s.GetWallet(userID)
+	var walletID int
+	err := s.db.QueryRow(`SELECT id FROM wallets WHERE user_id = $1`, userID).Scan(&walletID)
+	if err == sql.ErrNoRows {
+		return nil, ErrWalletNotFound
+	}
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to get wallet: %w", err)
 	}
 
 	rows, err := s.db.Query(`
@@ -144,7 +178,7 @@ func (s *WalletService) GetTransactionHistory(userID int, limit, offset int) ([]
 		WHERE wallet_id = $1 
 		ORDER BY created_at DESC 
 		LIMIT $2 OFFSET $3`,
-		wallet.ID, limit, offset)
+		walletID, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get wallet transaction history: %w", err)
 	}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"bdpayx-backend/internal/events"
+	"bdpayx-backend/internal/ledger"
+	"bdpayx-backend/internal/money"
+)
+
+// TestWalletConcurrentMutations hammers one wallet with debits and credits
+// from many goroutines. The balance must never go negative, every committed
+// mutation must show in the final balance, and the ledger must stay
+// consistent.
+func TestWalletConcurrentMutations(t *testing.T) {
+	db := testDB(t)
+	db.SetMaxOpenConns(20)
+
+	currencies := NewCurrencyService(db)
+	if err := currencies.Load(); err != nil {
+		t.Fatal(err)
+	}
+	book := ledger.New(db)
+	wallet := NewWalletService(db, book, currencies, events.NewMemoryBroker())
+	userID := createTestUser(t, db)
+
+	credit := func(amount, reference string) error {
+		return runInTx(db, func(tx *sql.Tx) error {
+			return wallet.credit(tx, userID, money.Of(money.MustParse(amount), "BDT"), "deposit", reference, "test credit")
+		})
+	}
+	// A debit holds the amount, then captures it
+	debit := func(amount, reference string) error {
+		hold, err := wallet.CreateHold(userID, money.Of(money.MustParse(amount), "BDT"), reference, "test debit", 0)
+		if err != nil {
+			return err
+		}
+		return wallet.CaptureHold(hold.ID, "test debit")
+	}
+
+	if err := credit("100.00", "seed"); err != nil {
+		t.Fatal(err)
+	}
+
+	const workers, rounds = 20, 10
+	var mu sync.Mutex
+	credits, debits, refused := 0, 0, 0
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for r := 0; r < rounds; r++ {
+				reference := fmt.Sprintf("test-%d-%d", w, r)
+				if (w+r)%2 == 0 {
+					if err := credit("3.00", reference); err != nil {
+						t.Errorf("credit: %v", err)
+						continue
+					}
+					mu.Lock()
+					credits++
+					mu.Unlock()
+					continue
+				}
+				err := debit("7.00", reference)
+				mu.Lock()
+				switch {
+				case err == nil:
+					debits++
+				case errors.Is(err, ErrInsufficientFunds):
+					refused++
+				default:
+					t.Errorf("debit: %v", err)
+				}
+				mu.Unlock()
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// Debits need more than is ever credited, so some must be refused
+	if refused == 0 {
+		t.Errorf("no debit was refused; the test does not reach the overdraft check")
+	}
+
+	got, err := wallet.GetWallet(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := money.MustParse("100.00").
+		Add(money.NewFromInt(int64(3 * credits))).
+		Sub(money.NewFromInt(int64(7 * debits)))
+	for _, b := range got.Balances {
+		if b.Currency != "BDT" {
+			continue
+		}
+		if !b.AvailableBalance.Equal(want) {
+			t.Errorf("available balance %s, want %s after %d credits and %d debits", b.AvailableBalance, want, credits, debits)
+		}
+		if !b.HeldBalance.IsZero() {
+			t.Errorf("held balance %s, want 0", b.HeldBalance)
+		}
+	}
+
+	var negative int
+	err = db.QueryRow(`
+		SELECT COUNT(*) FROM ledger_postings p
+		JOIN ledger_accounts a ON a.id = p.account_id
+		WHERE a.user_id = $1 AND p.balance_after < 0`, userID).Scan(&negative)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if negative > 0 {
+		t.Errorf("%d postings left an account of the user negative", negative)
+	}
+
+	report, err := book.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Consistent {
+		t.Errorf("ledger inconsistent: %+v", report)
+	}
+}
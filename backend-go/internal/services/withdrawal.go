@@ -0,0 +1,301 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"bdpayx-backend/internal/events"
+	"bdpayx-backend/internal/models"
+	"bdpayx-backend/internal/money"
+)
+
+var (
+	ErrWithdrawalNotFound   = errors.New("withdrawal request not found")
+	ErrInvalidDestination   = errors.New("invalid payout destination")
+	ErrWithdrawalNotAllowed = errors.New("withdrawal request cannot be changed in its current status")
+)
+
+var (
+	mobileWalletNumber = regexp.MustCompile(`^01[3-9][0-9]{8}$`)
+	ifscCode           = regexp.MustCompile(`^[A-Z]{4}0[A-Z0-9]{6}$`)
+	upiID              = regexp.MustCompile(`^[a-zA-Z0-9._-]{2,256}@[a-zA-Z]{2,64}$`)
+)
+
+const withdrawalColumns = `id, user_id, currency, amount, method,
+	COALESCE(account_name, ''), COALESCE(account_number, ''), COALESCE(bank_name, ''), COALESCE(ifsc, ''), COALESCE(upi_id, ''),
+	status, COALESCE(hold_id, 0), COALESCE(payout_reference, ''), COALESCE(failure_reason, ''), processed_by, created_at, updated_at`
+
+func scanWithdrawal(row rowScanner) (*models.WithdrawalRequest, error) {
+	var w models.WithdrawalRequest
+	var processedBy sql.NullInt64
+	err := row.Scan(&w.ID, &w.UserID, &w.Currency, &w.Amount, &w.Method,
+		&w.AccountName, &w.AccountNumber, &w.BankName, &w.IFSC, &w.UPIID,
+		&w.Status, &w.HoldID, &w.PayoutReference, &w.FailureReason, &processedBy,
+		&w.CreatedAt, &w.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if processedBy.Valid {
+		id := int(processedBy.Int64)
+		w.ProcessedBy = &id
+	}
+	return &w, nil
+}
+
+type WithdrawalService struct {
+	db        *sql.DB
+	wallet    *WalletService
+	publisher events.Publisher
+}
+
+func NewWithdrawalService(db *sql.DB, wallet *WalletService, publisher events.Publisher) *WithdrawalService {
+	return &WithdrawalService{db: db, wallet: wallet, publisher: publisher}
+}
+
+// notify sends w to its owner and the admin queue once tx commits.
+func (s *WithdrawalService) notify(tx *sql.Tx, w *models.WithdrawalRequest) {
+	afterCommit(tx, fmt.Sprintf("withdrawal:%d", w.ID), func() {
+		publish(s.publisher, events.WithdrawalUpdated, events.TopicUserWallet, w.UserID, w)
+		publish(s.publisher, events.WithdrawalUpdated, events.TopicAdminQueue, 0, w)
+	})
+}
+
+// validateDestination checks that the destination fields required by the
+// payout method are present and well formed. Mobile wallets pay out BDT,
+// bank transfers and UPI pay out INR.
+func validateDestination(req *models.WalletWithdrawRequest) error {
+	switch req.Method {
+	case models.PayoutBkash, models.PayoutNagad, models.PayoutRocket:
+		if req.Currency != "BDT" {
+			return fmt.Errorf("%w: %s pays out BDT only", ErrInvalidDestination, req.Method)
+		}
+		if !mobileWalletNumber.MatchString(req.AccountNumber) {
+			return fmt.Errorf("%w: account_number must be an 11 digit mobile number", ErrInvalidDestination)
+		}
+	case models.PayoutBank:
+		if req.Currency != "INR" {
+			return fmt.Errorf("%w: bank transfers pay out INR only", ErrInvalidDestination)
+		}
+		req.IFSC = strings.ToUpper(req.IFSC)
+		if req.AccountName == "" || req.AccountNumber == "" {
+			return fmt.Errorf("%w: account_name and account_number are required", ErrInvalidDestination)
+		}
+		if !ifscCode.MatchString(req.IFSC) {
+			return fmt.Errorf("%w: invalid IFSC code", ErrInvalidDestination)
+		}
+	case models.PayoutUPI:
+		if req.Currency != "INR" {
+			return fmt.Errorf("%w: UPI pays out INR only", ErrInvalidDestination)
+		}
+		if !upiID.MatchString(req.UPIID) {
+			return fmt.Errorf("%w: invalid UPI ID", ErrInvalidDestination)
+		}
+	default:
+		return fmt.Errorf("%w: unknown method %s", ErrInvalidDestination, req.Method)
+	}
+	return nil
+}
+
+// CreateWithdrawal records a payout request and puts its amount on hold, so
+// it can no longer be spent but has not left the wallet yet.
+func (s *WithdrawalService) CreateWithdrawal(userID int, req models.WalletWithdrawRequest) (*models.WithdrawalRequest, error) {
+	amount := money.Of(req.Amount, req.Currency)
+	if err := amount.Validate(); err != nil {
+		return nil, err
+	}
+	if err := validateDestination(&req); err != nil {
+		return nil, err
+	}
+
+	var withdrawal *models.WithdrawalRequest
+	err := runInTx(s.db, func(tx *sql.Tx) error {
+		var id int
+		err := tx.QueryRow(`
+			INSERT INTO withdrawal_requests (user_id, currency, amount, method, account_name, account_number, bank_name, ifsc, upi_id, status, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, ''), $10, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+			RETURNING id`,
+			userID, req.Currency, req.Amount, req.Method, req.AccountName, req.AccountNumber,
+			req.BankName, req.IFSC, req.UPIID, models.WithdrawalPending).Scan(&id)
+		if err != nil {
+			return fmt.Errorf("failed to create withdrawal request: %w", err)
+		}
+
+		hold, err := s.wallet.createHold(tx, userID, amount, withdrawalReference(id),
+			fmt.Sprintf("Held for withdrawal #%d via %s", id, req.Method), 0)
+		if err != nil {
+			return err
+		}
+
+		withdrawal, err = scanWithdrawal(tx.QueryRow(`
+			UPDATE withdrawal_requests SET hold_id = $1 WHERE id = $2
+			RETURNING `+withdrawalColumns,
+			hold.ID, id))
+		if err != nil {
+			return fmt.Errorf("failed to link withdrawal hold: %w", err)
+		}
+		s.notify(tx, withdrawal)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return withdrawal, nil
+}
+
+func (s *WithdrawalService) GetUserWithdrawals(userID, limit, offset int) ([]models.WithdrawalRequest, error) {
+	return s.list(`WHERE user_id = $1`, userID, limit, offset)
+}
+
+// GetWithdrawals lists all withdrawal requests for admins, optionally
+// filtered by status.
+func (s *WithdrawalService) GetWithdrawals(status string, limit, offset int) ([]models.WithdrawalRequest, error) {
+	return s.list(`WHERE ($1 = '' OR status = $1)`, status, limit, offset)
+}
+
+func (s *WithdrawalService) list(where string, arg interface{}, limit, offset int) ([]models.WithdrawalRequest, error) {
+	rows, err := s.db.Query(`
+		SELECT `+withdrawalColumns+`
+		FROM withdrawal_requests
+		`+where+`
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3`,
+		arg, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get withdrawal requests: %w", err)
+	}
+	defer rows.Close()
+
+	withdrawals := []models.WithdrawalRequest{}
+	for rows.Next() {
+		w, err := scanWithdrawal(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan withdrawal request: %w", err)
+		}
+		withdrawals = append(withdrawals, *w)
+	}
+
+	return withdrawals, nil
+}
+
+// CancelWithdrawal lets a user withdraw their own request while nobody has
+// approved it yet. The held amount returns to the wallet.
+func (s *WithdrawalService) CancelWithdrawal(userID, withdrawalID int) (*models.WithdrawalRequest, error) {
+	return s.update(withdrawalID, func(tx *sql.Tx, w *models.WithdrawalRequest) (*models.WithdrawalRequest, error) {
+		if w.UserID != userID {
+			return nil, ErrWithdrawalNotFound
+		}
+		if w.Status != models.WithdrawalPending {
+			return nil, fmt.Errorf("%w: %s", ErrWithdrawalNotAllowed, w.Status)
+		}
+		if err := s.releaseHold(tx, w, "Withdrawal cancelled"); err != nil {
+			return nil, err
+		}
+		return setWithdrawalStatus(tx, w.ID, models.WithdrawalCancelled, nil, "", "")
+	})
+}
+
+// ApproveWithdrawal accepts a pending request for payout.
+func (s *WithdrawalService) ApproveWithdrawal(withdrawalID, adminID int) (*models.WithdrawalRequest, error) {
+	return s.update(withdrawalID, func(tx *sql.Tx, w *models.WithdrawalRequest) (*models.WithdrawalRequest, error) {
+		if w.Status != models.WithdrawalPending {
+			return nil, fmt.Errorf("%w: %s", ErrWithdrawalNotAllowed, w.Status)
+		}
+		return setWithdrawalStatus(tx, w.ID, models.WithdrawalApproved, &adminID, "", "")
+	})
+}
+
+// MarkWithdrawalPaid records that the money was sent and captures the hold,
+// so the amount finally leaves the wallet.
+func (s *WithdrawalService) MarkWithdrawalPaid(withdrawalID, adminID int, payoutReference string) (*models.WithdrawalRequest, error) {
+	return s.update(withdrawalID, func(tx *sql.Tx, w *models.WithdrawalRequest) (*models.WithdrawalRequest, error) {
+		if w.Status != models.WithdrawalApproved {
+			return nil, fmt.Errorf("%w: %s", ErrWithdrawalNotAllowed, w.Status)
+		}
+
+		hold, err := lockHold(tx, w.HoldID)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.wallet.captureToCash(tx, hold, fmt.Sprintf("Withdrawal #%d paid, ref %s", w.ID, payoutReference)); err != nil {
+			return nil, err
+		}
+
+		return setWithdrawalStatus(tx, w.ID, models.WithdrawalPaid, &adminID, payoutReference, "")
+	})
+}
+
+// RejectWithdrawal fails a request that has not been paid and refunds the
+// held amount to the wallet.
+func (s *WithdrawalService) RejectWithdrawal(withdrawalID, adminID int, reason string) (*models.WithdrawalRequest, error) {
+	return s.update(withdrawalID, func(tx *sql.Tx, w *models.WithdrawalRequest) (*models.WithdrawalRequest, error) {
+		if w.Status != models.WithdrawalPending && w.Status != models.WithdrawalApproved {
+			return nil, fmt.Errorf("%w: %s", ErrWithdrawalNotAllowed, w.Status)
+		}
+		if err := s.releaseHold(tx, w, fmt.Sprintf("Withdrawal #%d refunded: %s", w.ID, reason)); err != nil {
+			return nil, err
+		}
+		return setWithdrawalStatus(tx, w.ID, models.WithdrawalFailed, &adminID, "", reason)
+	})
+}
+
+// update locks a withdrawal request and applies fn to it in one transaction.
+func (s *WithdrawalService) update(withdrawalID int, fn func(tx *sql.Tx, w *models.WithdrawalRequest) (*models.WithdrawalRequest, error)) (*models.WithdrawalRequest, error) {
+	var withdrawal *models.WithdrawalRequest
+
+	err := runInTx(s.db, func(tx *sql.Tx) error {
+		w, err := scanWithdrawal(tx.QueryRow(`
+			SELECT `+withdrawalColumns+`
+			FROM withdrawal_requests WHERE id = $1 FOR UPDATE`, withdrawalID))
+		if err == sql.ErrNoRows {
+			return ErrWithdrawalNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to lock withdrawal request: %w", err)
+		}
+
+		withdrawal, err = fn(tx, w)
+		if err != nil {
+			return err
+		}
+		s.notify(tx, withdrawal)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return withdrawal, nil
+}
+
+func (s *WithdrawalService) releaseHold(tx *sql.Tx, w *models.WithdrawalRequest, description string) error {
+	hold, err := lockHold(tx, w.HoldID)
+	if err != nil {
+		return err
+	}
+	return s.wallet.releaseHold(tx, hold, models.HoldReleased, description)
+}
+
+func setWithdrawalStatus(tx *sql.Tx, withdrawalID int, status string, processedBy *int, payoutReference, failureReason string) (*models.WithdrawalRequest, error) {
+	w, err := scanWithdrawal(tx.QueryRow(`
+		UPDATE withdrawal_requests
+		SET status = $1,
+			processed_by = COALESCE($2, processed_by),
+			payout_reference = COALESCE(NULLIF($3, ''), payout_reference),
+			failure_reason = COALESCE(NULLIF($4, ''), failure_reason),
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $5
+		RETURNING `+withdrawalColumns,
+		status, processedBy, payoutReference, failureReason, withdrawalID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update withdrawal request: %w", err)
+	}
+	return w, nil
+}
+
+func withdrawalReference(withdrawalID int) string {
+	return fmt.Sprintf("withdrawal:%d", withdrawalID)
+}
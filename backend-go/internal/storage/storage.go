@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"bdpayx-backend/internal/config"
+)
+
+var ErrNotFound = errors.New("file not found")
+
+// Storage keeps uploaded files such as payment proofs. Keys are slash
+// separated paths relative to the backend's root.
+type Storage interface {
+	Put(key string, r io.Reader, contentType string) error
+	Get(key string) (io.ReadCloser, error)
+	// Delete removes a file; deleting one that does not exist is not an
+	// error.
+	Delete(key string) error
+}
+
+// New returns the backend selected by STORAGE_BACKEND.
+func New(cfg *config.Config) (Storage, error) {
+	switch cfg.StorageBackend {
+	case "", "local":
+		return NewLocal(cfg.UploadDir), nil
+	case "supabase":
+		if cfg.SupabaseURL == "" || cfg.SupabaseServiceKey == "" {
+			return nil, fmt.Errorf("supabase storage requires SUPABASE_URL and SUPABASE_SERVICE_KEY")
+		}
+		return NewSupabase(cfg.SupabaseURL, cfg.SupabaseServiceKey, cfg.SupabaseStorageBucket), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", cfg.StorageBackend)
+	}
+}
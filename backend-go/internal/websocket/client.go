@@ -0,0 +1,176 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"time"
+
+	"bdpayx-backend/internal/events"
+
+	"github.com/gorilla/websocket"
+)
+
+// Messages clients send
+const (
+	messageAuth        = "auth"
+	messageSubscribe   = "subscribe"
+	messageUnsubscribe = "unsubscribe"
+)
+
+// Replies the hub sends, in the same envelope as events
+const (
+	replyAuthenticated = "authenticated"
+	replySubscribed    = "subscribed"
+	replyResync        = "resync"
+	replyError         = "error"
+)
+
+// maxTopics caps the subscriptions of one connection
+const maxTopics = 50
+
+var errAuthRequired = errors.New("auth message with a valid token required")
+
+var ratesTopicPattern = regexp.MustCompile(`^rates:[A-Z]{3}_[A-Z]{3}$`)
+
+// clientMessage is anything a client sends. Since maps topics being
+// subscribed to the seq of the last event received on them before a
+// reconnect.
+type clientMessage struct {
+	Type   string           `json:"type"`
+	Token  string           `json:"token"`
+	Topics []string         `json:"topics"`
+	Since  map[string]int64 `json:"since"`
+}
+
+// Client is one authenticated connection. topics and tooSlow are owned by
+// the hub's Run loop; writePump only reads tooSlow once send is closed.
+type Client struct {
+	hub       *Hub
+	conn      *websocket.Conn
+	send      chan []byte
+	userID    int
+	isAdmin   bool
+	sessionID string
+	topics    map[string]bool
+	tooSlow   bool
+}
+
+func (c *Client) topicList() []string {
+	list := make([]string, 0, len(c.topics))
+	for topic := range c.topics {
+		list = append(list, topic)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// checkTopic reports why the client may not subscribe to topic, if it may
+// not.
+func (c *Client) checkTopic(topic string) error {
+	switch {
+	case ratesTopicPattern.MatchString(topic), topic == events.TopicUserTransactions, topic == events.TopicUserWallet:
+		return nil
+	case topic == events.TopicAdminQueue:
+		if !c.isAdmin {
+			return fmt.Errorf("%s requires an admin", topic)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown topic %q", topic)
+	}
+}
+
+// handle turns a client message into a request for the hub.
+func (c *Client) handle(data []byte) request {
+	req := request{client: c}
+
+	var msg clientMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		req.errs = append(req.errs, "invalid message")
+		return req
+	}
+
+	switch msg.Type {
+	case messageSubscribe:
+		for _, topic := range msg.Topics {
+			if err := c.checkTopic(topic); err != nil {
+				req.errs = append(req.errs, err.Error())
+				continue
+			}
+			req.subscribe = append(req.subscribe, topic)
+		}
+		req.since = msg.Since
+	case messageUnsubscribe:
+		req.unsubscribe = msg.Topics
+	case messageAuth:
+		req.errs = append(req.errs, "already authenticated")
+	default:
+		req.errs = append(req.errs, fmt.Sprintf("unknown message type %q", msg.Type))
+	}
+	return req
+}
+
+// readPump reads client messages until the connection fails or stops
+// answering pings.
+func (c *Client) readPump() {
+	defer func() {
+		c.hub.unregister <- c
+		c.conn.Close()
+	}()
+
+	pongWait := 2 * c.hub.opts.PingInterval
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("WebSocket error: %v", err)
+			}
+			break
+		}
+		c.hub.requests <- c.handle(data)
+	}
+}
+
+// writePump writes queued events and pings until send is closed.
+func (c *Client) writePump() {
+	ticker := time.NewTicker(c.hub.opts.PingInterval)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case message, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				closing := []byte{}
+				if c.tooSlow {
+					closing = websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow, resume with since")
+				}
+				c.conn.WriteMessage(websocket.CloseMessage, closing)
+				return
+			}
+
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				log.Printf("WebSocket write error: %v", err)
+				return
+			}
+
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -1,122 +1,330 @@
 package websocket
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"bdpayx-backend/internal/events"
+	"bdpayx-backend/internal/middleware"
 
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow connections from any origin
-	},
+const (
+	// authTimeout is how long a connection without a token in the upgrade
+	// request has to send its auth message
+	authTimeout = 10 * time.Second
+	// writeWait bounds every write to a connection
+	writeWait = 10 * time.Second
+	// pruneInterval is how often expired replay buffers are dropped
+	pruneInterval = time.Minute
+)
+
+// Options tune the hub.
+type Options struct {
+	// AllowedOrigins browsers may connect from; "*" allows any. Requests
+	// without an Origin header, such as the mobile app's, are always allowed.
+	AllowedOrigins []string
+	// PingInterval is how often connections are pinged. One that has not
+	// answered for two intervals is closed.
+	PingInterval time.Duration
+	// MaxMessageSize is the largest message accepted from a client, in bytes
+	MaxMessageSize int64
+	// SendBuffer is how many events may queue for a client before it is
+	// disconnected as too slow
+	SendBuffer int
+	// ReplaySize and ReplayWindow bound the events kept per stream for
+	// clients resuming after a disconnect
+	ReplaySize   int
+	ReplayWindow time.Duration
 }
 
+// Hub tracks authenticated connections and the topics they subscribe to.
+// Its maps are only touched by Run; everything else talks to it through
+// channels.
 type Hub struct {
+	tokens   *middleware.TokenParser
+	opts     Options
+	upgrader websocket.Upgrader
+
 	clients    map[*Client]bool
-	broadcast  chan []byte
+	topics     map[string]map[*Client]bool
+	replay     map[string][]buffered
+	publish    chan events.Event
 	register   chan *Client
 	unregister chan *Client
+	requests   chan request
 }
 
-type Client struct {
-	hub  *Hub
-	conn *websocket.Conn
-	send chan []byte
+// request is what a client asked for: topics to join or leave, where to
+// resume them, and why any part of its message could not be honoured.
+type request struct {
+	client      *Client
+	subscribe   []string
+	unsubscribe []string
+	since       map[string]int64
+	errs        []string
 }
 
-func NewHub() *Hub {
+// NewHub accepts connections carrying an access token tokens accepts.
+func NewHub(tokens *middleware.TokenParser, opts Options) *Hub {
 	return &Hub{
+		tokens: tokens,
+		opts:   opts,
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool {
+				return originAllowed(r.Header.Get("Origin"), opts.AllowedOrigins)
+			},
+		},
 		clients:    make(map[*Client]bool),
-		broadcast:  make(chan []byte),
+		topics:     make(map[string]map[*Client]bool),
+		replay:     make(map[string][]buffered),
+		publish:    make(chan events.Event),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		requests:   make(chan request),
+	}
+}
+
+func originAllowed(origin string, allowed []string) bool {
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
 	}
+	for _, a := range allowed {
+		if a == "*" || strings.EqualFold(strings.TrimSuffix(a, "/"), u.Scheme+"://"+u.Host) {
+			return true
+		}
+	}
+	return false
 }
 
 func (h *Hub) Run() {
+	prune := time.NewTicker(pruneInterval)
+	defer prune.Stop()
+
 	for {
 		select {
 		case client := <-h.register:
 			h.clients[client] = true
-			log.Printf("Client connected. Total clients: %d", len(h.clients))
+			h.reply(client, replyAuthenticated, map[string]interface{}{"user_id": client.userID})
+			log.Printf("Client connected (user %d). Total clients: %d", client.userID, len(h.clients))
 
 		case client := <-h.unregister:
 			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-				log.Printf("Client disconnected. Total clients: %d", len(h.clients))
+				h.remove(client)
+				log.Printf("Client disconnected (user %d). Total clients: %d", client.userID, len(h.clients))
 			}
 
-		case message := <-h.broadcast:
-			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
+		case req := <-h.requests:
+			if !h.clients[req.client] {
+				continue
+			}
+			var joined []string
+			for _, topic := range req.subscribe {
+				if !h.join(req.client, topic) {
+					req.errs = append(req.errs, fmt.Sprintf("at most %d topics per connection", maxTopics))
+					break
+				}
+				joined = append(joined, topic)
+			}
+			for _, topic := range req.unsubscribe {
+				h.leave(req.client, topic)
+			}
+			if len(req.errs) > 0 {
+				h.reply(req.client, replyError, map[string]string{"error": strings.Join(req.errs, "; ")})
+			}
+			if len(req.subscribe) > 0 || len(req.unsubscribe) > 0 {
+				h.reply(req.client, replySubscribed, map[string][]string{"topics": req.client.topicList()})
+			}
+			// Missed events follow the confirmation, ahead of any new ones
+			for _, topic := range joined {
+				if since, ok := req.since[topic]; ok && h.clients[req.client] {
+					h.resume(req.client, topic, since)
 				}
 			}
+
+		case event := <-h.publish:
+			if event.Type == events.SessionRevoked {
+				h.dropSession(event)
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("WebSocket encode error: %v", err)
+				continue
+			}
+			h.buffer(event, data)
+			for client := range h.topics[event.Topic] {
+				// User topics are shared names; only the addressee gets the event
+				if event.UserID != 0 && client.userID != event.UserID {
+					continue
+				}
+				h.deliver(client, data)
+			}
+
+		case <-prune.C:
+			h.pruneReplay(time.Now())
 		}
 	}
 }
 
-func (h *Hub) Broadcast(message []byte) {
-	h.broadcast <- message
+// Publish sends an event to the subscribers of its topic.
+func (h *Hub) Publish(event events.Event) {
+	h.publish <- event
 }
 
-func (c *Client) readPump() {
-	defer func() {
-		c.hub.unregister <- c
-		c.conn.Close()
-	}()
+// deliver queues data for a client. A client too far behind to take it is
+// disconnected, and can resume from the last event it received.
+func (h *Hub) deliver(client *Client, data []byte) {
+	if !h.clients[client] {
+		return
+	}
+	select {
+	case client.send <- data:
+	default:
+		log.Printf("WebSocket client of user %d too slow, disconnecting", client.userID)
+		client.tooSlow = true
+		h.remove(client)
+	}
+}
 
-	for {
-		_, _, err := c.conn.ReadMessage()
-		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket error: %v", err)
-			}
-			break
+// dropSession disconnects the connections of a signed-out session.
+func (h *Hub) dropSession(event events.Event) {
+	var revoked events.SessionRevokedPayload
+	if err := json.Unmarshal(event.Payload, &revoked); err != nil {
+		return
+	}
+	for client := range h.clients {
+		if client.userID == event.UserID && client.sessionID == revoked.SessionID {
+			h.remove(client)
 		}
 	}
 }
 
-func (c *Client) writePump() {
-	defer c.conn.Close()
+func (h *Hub) reply(client *Client, replyType string, payload interface{}) {
+	event, err := events.New(replyType, "", 0, payload)
+	if err != nil {
+		return
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	h.deliver(client, data)
+}
 
-	for {
-		select {
-		case message, ok := <-c.send:
-			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
+func (h *Hub) join(client *Client, topic string) bool {
+	if !client.topics[topic] && len(client.topics) >= maxTopics {
+		return false
+	}
+	if h.topics[topic] == nil {
+		h.topics[topic] = make(map[*Client]bool)
+	}
+	h.topics[topic][client] = true
+	client.topics[topic] = true
+	return true
+}
 
-			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
-				log.Printf("WebSocket write error: %v", err)
-				return
-			}
+func (h *Hub) leave(client *Client, topic string) {
+	delete(client.topics, topic)
+	if subscribers, ok := h.topics[topic]; ok {
+		delete(subscribers, client)
+		if len(subscribers) == 0 {
+			delete(h.topics, topic)
 		}
 	}
 }
 
+func (h *Hub) remove(client *Client) {
+	for topic := range client.topics {
+		h.leave(client, topic)
+	}
+	delete(h.clients, client)
+	close(client.send)
+}
+
+// ServeWS upgrades a request to a WebSocket connection. A token in the
+// Authorization header or the token query parameter is checked before the
+// upgrade; without one, the first message must be {"type": "auth", "token": ...}.
 func (h *Hub) ServeWS(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	var claims *middleware.Claims
+	if token := requestToken(r); token != "" {
+		var err error
+		claims, err = h.tokens.Parse(token)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade error: %v", err)
 		return
 	}
 
+	go h.accept(conn, claims)
+}
+
+func requestToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	return r.URL.Query().Get("token")
+}
+
+// accept waits for the auth message of a connection that has no claims yet,
+// then registers it with the hub.
+func (h *Hub) accept(conn *websocket.Conn, claims *middleware.Claims) {
+	conn.SetReadLimit(h.opts.MaxMessageSize)
+
+	if claims == nil {
+		var err error
+		claims, err = h.readAuth(conn)
+		if err != nil {
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.ClosePolicyViolation, err.Error()),
+				time.Now().Add(writeWait))
+			conn.Close()
+			return
+		}
+	}
+
 	client := &Client{
-		hub:  h,
-		conn: conn,
-		send: make(chan []byte, 256),
+		hub:       h,
+		conn:      conn,
+		send:      make(chan []byte, h.opts.SendBuffer),
+		userID:    claims.UserID,
+		isAdmin:   claims.IsAdmin,
+		sessionID: claims.SessionID,
+		topics:    make(map[string]bool),
 	}
 
-	client.hub.register <- client
+	h.register <- client
 
 	go client.writePump()
 	go client.readPump()
-}
\ No newline at end of file
+}
+
+func (h *Hub) readAuth(conn *websocket.Conn) (*middleware.Claims, error) {
+	conn.SetReadDeadline(time.Now().Add(authTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	var msg clientMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		return nil, errAuthRequired
+	}
+	if msg.Type != messageAuth || msg.Token == "" {
+		return nil, errAuthRequired
+	}
+	return h.tokens.Parse(msg.Token)
+}
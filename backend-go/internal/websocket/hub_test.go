@@ -0,0 +1,31 @@
+package websocket
+
+import "testing"
+
+func TestOriginAllowed(t *testing.T) {
+	allowed := []string{"https://bdpayx.com/", "http://localhost:3000"}
+	tests := []struct {
+		origin  string
+		allowed []string
+		want    bool
+	}{
+		{"", allowed, true},
+		{"", nil, true},
+		{"https://bdpayx.com", allowed, true},
+		{"HTTPS://BDPAYX.COM", allowed, true},
+		{"http://localhost:3000", allowed, true},
+		{"http://localhost:3001", allowed, false},
+		{"http://bdpayx.com", allowed, false},
+		{"https://evil.bdpayx.com", allowed, false},
+		{"https://bdpayx.com.evil.com", allowed, false},
+		{"https://evil.com", nil, false},
+		{"https://evil.com", []string{"*"}, true},
+		{"://bad", allowed, false},
+	}
+
+	for _, tt := range tests {
+		if got := originAllowed(tt.origin, tt.allowed); got != tt.want {
+			t.Errorf("originAllowed(%q, %v) = %v, want %v", tt.origin, tt.allowed, got, tt.want)
+		}
+	}
+}
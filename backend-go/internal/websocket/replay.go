@@ -0,0 +1,66 @@
+package websocket
+
+import (
+	"strings"
+	"time"
+
+	"bdpayx-backend/internal/events"
+)
+
+// buffered is an encoded event kept for clients that resume
+type buffered struct {
+	seq  int64
+	data []byte
+	at   time.Time
+}
+
+// buffer keeps an event for replay, dropping the oldest of its stream once
+// ReplaySize are kept.
+func (h *Hub) buffer(event events.Event, data []byte) {
+	if h.opts.ReplaySize <= 0 || event.Seq == 0 {
+		return
+	}
+	stream := event.Stream()
+	kept := append(h.replay[stream], buffered{seq: event.Seq, data: data, at: time.Now()})
+	if len(kept) > h.opts.ReplaySize {
+		kept = kept[len(kept)-h.opts.ReplaySize:]
+	}
+	h.replay[stream] = kept
+}
+
+// resume sends a client the events of topic after since. When the buffer no
+// longer reaches back that far, or the numbering restarted, the client is
+// told to resync: refetch over the API, then carry on from the next event.
+func (h *Hub) resume(client *Client, topic string, since int64) {
+	stream := topic
+	if strings.HasPrefix(topic, events.TopicUserPrefix) {
+		stream = events.StreamOf(topic, client.userID)
+	}
+
+	kept := h.replay[stream]
+	if len(kept) == 0 || kept[0].seq > since+1 || kept[len(kept)-1].seq < since {
+		h.reply(client, replyResync, map[string]string{"topic": topic})
+		return
+	}
+	for _, b := range kept {
+		if b.seq > since {
+			h.deliver(client, b.data)
+		}
+	}
+}
+
+// pruneReplay drops events older than ReplayWindow.
+func (h *Hub) pruneReplay(now time.Time) {
+	cutoff := now.Add(-h.opts.ReplayWindow)
+	for stream, kept := range h.replay {
+		i := 0
+		for i < len(kept) && kept[i].at.Before(cutoff) {
+			i++
+		}
+		if i == len(kept) {
+			delete(h.replay, stream)
+		} else if i > 0 {
+			h.replay[stream] = kept[i:]
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"bdpayx-backend/internal/events"
+)
+
+func testHub(replaySize int) *Hub {
+	return NewHub(nil, Options{ReplaySize: replaySize, ReplayWindow: time.Minute})
+}
+
+// testClient registers a client the way Run does, without a connection.
+func testClient(h *Hub, userID int) *Client {
+	client := &Client{hub: h, send: make(chan []byte, 64), userID: userID, topics: make(map[string]bool)}
+	h.clients[client] = true
+	return client
+}
+
+// publishSeqs buffers events numbered first to last on topic, addressed to
+// userID unless it is zero. Their payload names the user and seq.
+func publishSeqs(t *testing.T, h *Hub, topic string, userID int, first, last int64) {
+	t.Helper()
+	for seq := first; seq <= last; seq++ {
+		event, err := events.New("test", topic, userID, fmt.Sprintf("%d/%d", userID, seq))
+		if err != nil {
+			t.Fatal(err)
+		}
+		event.Seq = seq
+		data, err := json.Marshal(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.buffer(event, data)
+	}
+}
+
+// received drains what a client was sent, as "resync" for a resync reply
+// and the payload of anything else.
+func received(t *testing.T, client *Client) []string {
+	t.Helper()
+	var got []string
+	for {
+		select {
+		case data := <-client.send:
+			var event events.Event
+			if err := json.Unmarshal(data, &event); err != nil {
+				t.Fatal(err)
+			}
+			if event.Type == replyResync {
+				got = append(got, replyResync)
+				continue
+			}
+			var payload string
+			if err := json.Unmarshal(event.Payload, &payload); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, payload)
+		default:
+			return got
+		}
+	}
+}
+
+func assertReceived(t *testing.T, client *Client, want ...string) {
+	t.Helper()
+	got := received(t, client)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("received %v, want %v", got, want)
+	}
+}
+
+func TestResume(t *testing.T) {
+	tests := []struct {
+		name  string
+		since int64
+		want  []string
+	}{
+		{"missed events", 5, []string{"0/6", "0/7"}},
+		{"exact catch-up", 7, nil},
+		{"first kept event is the next one", 2, []string{"0/3", "0/4", "0/5", "0/6", "0/7"}},
+		{"buffer does not reach back", 1, []string{replyResync}},
+		{"counter restarted", 12, []string{replyResync}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := testHub(5)
+			publishSeqs(t, h, "rates:BDT_INR", 0, 1, 7)
+			client := testClient(h, 1)
+
+			h.resume(client, "rates:BDT_INR", tt.since)
+			assertReceived(t, client, tt.want...)
+		})
+	}
+}
+
+func TestResumeWithoutBuffer(t *testing.T) {
+	h := testHub(5)
+	client := testClient(h, 1)
+
+	h.resume(client, "rates:BDT_INR", 0)
+	assertReceived(t, client, replyResync)
+
+	// Replay turned off keeps nothing to resume from
+	h = testHub(0)
+	publishSeqs(t, h, "rates:BDT_INR", 0, 1, 3)
+	client = testClient(h, 1)
+	h.resume(client, "rates:BDT_INR", 1)
+	assertReceived(t, client, replyResync)
+}
+
+func TestResumeUserStream(t *testing.T) {
+	h := testHub(5)
+	publishSeqs(t, h, events.TopicUserWallet, 1, 1, 3)
+	publishSeqs(t, h, events.TopicUserWallet, 2, 1, 2)
+	first, second := testClient(h, 1), testClient(h, 2)
+
+	// Both users subscribe to user:wallet, but each resumes their own numbering
+	h.resume(first, events.TopicUserWallet, 1)
+	assertReceived(t, first, "1/2", "1/3")
+	h.resume(second, events.TopicUserWallet, 0)
+	assertReceived(t, second, "2/1", "2/2")
+
+	// Seq 3 is user 1's; user 2 has not got that far
+	h.resume(second, events.TopicUserWallet, 3)
+	assertReceived(t, second, replyResync)
+
+	third := testClient(h, 3)
+	h.resume(third, events.TopicUserWallet, 0)
+	assertReceived(t, third, replyResync)
+}
+
+func TestPruneReplay(t *testing.T) {
+	h := testHub(10)
+	publishSeqs(t, h, "rates:BDT_INR", 0, 1, 4)
+	publishSeqs(t, h, "rates:INR_BDT", 0, 1, 2)
+
+	now := time.Now()
+	kept := h.replay["rates:BDT_INR"]
+	for i := range kept {
+		kept[i].at = now.Add(time.Duration(i-3) * time.Minute)
+	}
+	for i := range h.replay["rates:INR_BDT"] {
+		h.replay["rates:INR_BDT"][i].at = now.Add(-time.Hour)
+	}
+
+	// Seq 1 and 2 are older than the minute window, seq 3 is on its edge
+	h.pruneReplay(now)
+	var seqs []int64
+	for _, b := range h.replay["rates:BDT_INR"] {
+		seqs = append(seqs, b.seq)
+	}
+	if fmt.Sprint(seqs) != "[3 4]" {
+		t.Errorf("kept seqs %v, want [3 4]", seqs)
+	}
+	if _, ok := h.replay["rates:INR_BDT"]; ok {
+		t.Error("stream with only expired events was kept")
+	}
+
+	// A client behind the pruned events has to resync
+	client := testClient(h, 1)
+	h.resume(client, "rates:BDT_INR", 1)
+	assertReceived(t, client, replyResync)
+}
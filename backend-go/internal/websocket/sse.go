@@ -0,0 +1,157 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"bdpayx-backend/internal/events"
+)
+
+// defaultStreamTopics are streamed when a request names none
+var defaultStreamTopics = []string{events.TopicUserTransactions, events.TopicUserWallet}
+
+// ServeSSE streams the hub's events as Server-Sent Events, for clients behind
+// proxies that break WebSocket upgrades. The token comes from the
+// Authorization header or the token query parameter, and the topics from the
+// comma-separated topics parameter. Every event id records the last seq seen
+// on each topic, so a reconnecting EventSource resumes from its Last-Event-ID.
+func (h *Hub) ServeSSE(w http.ResponseWriter, r *http.Request) {
+	token := requestToken(r)
+	if token == "" {
+		http.Error(w, "Access token required", http.StatusUnauthorized)
+		return
+	}
+	claims, err := h.tokens.Parse(token)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	client := &Client{
+		hub:       h,
+		send:      make(chan []byte, h.opts.SendBuffer),
+		userID:    claims.UserID,
+		isAdmin:   claims.IsAdmin,
+		sessionID: claims.SessionID,
+		topics:    make(map[string]bool),
+	}
+
+	topics := defaultStreamTopics
+	if param := r.URL.Query().Get("topics"); param != "" {
+		topics = strings.Split(param, ",")
+	}
+	if len(topics) > maxTopics {
+		http.Error(w, fmt.Sprintf("at most %d topics per connection", maxTopics), http.StatusBadRequest)
+		return
+	}
+	for _, topic := range topics {
+		if err := client.checkTopic(topic); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	since := parseEventID(r.Header.Get("Last-Event-ID"))
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	h.register <- client
+	h.requests <- request{client: client, subscribe: topics, since: since}
+
+	positions := make(map[string]int64, len(since))
+	for topic, seq := range since {
+		positions[topic] = seq
+	}
+
+	ticker := time.NewTicker(h.opts.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		var err error
+		select {
+		case data, ok := <-client.send:
+			// Closed when the client fell too far behind, and the browser
+			// reconnects and resumes from its Last-Event-ID, or when its
+			// session was signed out
+			if !ok {
+				return
+			}
+			rc.SetWriteDeadline(time.Now().Add(writeWait))
+			err = writeEvent(w, data, positions)
+
+		case <-ticker.C:
+			rc.SetWriteDeadline(time.Now().Add(writeWait))
+			_, err = io.WriteString(w, ": ping\n\n")
+
+		case <-r.Context().Done():
+			h.unregister <- client
+			return
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			h.unregister <- client
+			return
+		}
+	}
+}
+
+// writeEvent writes an encoded event, with an id covering positions once the
+// event's own seq is recorded in them.
+func writeEvent(w io.Writer, data []byte, positions map[string]int64) error {
+	var event struct {
+		Topic string `json:"topic"`
+		Seq   int64  `json:"seq"`
+	}
+	if err := json.Unmarshal(data, &event); err == nil && event.Seq > 0 {
+		positions[event.Topic] = event.Seq
+		if _, err := fmt.Fprintf(w, "id: %s\n", formatEventID(positions)); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "data: %s\n\n", data)
+	return err
+}
+
+// formatEventID encodes positions as topic=seq pairs, e.g.
+// "rates:BDT_INR=42,user:wallet=7".
+func formatEventID(positions map[string]int64) string {
+	pairs := make([]string, 0, len(positions))
+	for topic, seq := range positions {
+		pairs = append(pairs, topic+"="+strconv.FormatInt(seq, 10))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// parseEventID reads an id written by formatEventID, skipping anything
+// malformed.
+func parseEventID(id string) map[string]int64 {
+	positions := make(map[string]int64)
+	for _, pair := range strings.Split(id, ",") {
+		i := strings.LastIndex(pair, "=")
+		if i <= 0 {
+			continue
+		}
+		seq, err := strconv.ParseInt(pair[i+1:], 10, 64)
+		if err != nil || seq < 0 {
+			continue
+		}
+		positions[pair[:i]] = seq
+	}
+	return positions
+}
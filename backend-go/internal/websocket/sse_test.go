@@ -0,0 +1,160 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"bdpayx-backend/internal/events"
+	"bdpayx-backend/internal/middleware"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestEventIDRoundTrip(t *testing.T) {
+	for _, positions := range []map[string]int64{
+		{},
+		{"rates:BDT_INR": 42},
+		{"rates:BDT_INR": 42, "user:wallet": 7, "user:transactions": 0},
+		// Only the last = separates the seq
+		{"a=b": 3, "x:y=z:1": 5, "rates:INR_BDT": 9},
+	} {
+		id := formatEventID(positions)
+		if got := parseEventID(id); !reflect.DeepEqual(got, positions) {
+			t.Errorf("%q parsed as %v, want %v", id, got, positions)
+		}
+	}
+
+	id := formatEventID(map[string]int64{"user:wallet": 7, "rates:BDT_INR": 42})
+	if id != "rates:BDT_INR=42,user:wallet=7" {
+		t.Errorf("id %q, want pairs in order", id)
+	}
+}
+
+func TestParseEventIDSkipsMalformed(t *testing.T) {
+	tests := []struct {
+		id   string
+		want map[string]int64
+	}{
+		{"", map[string]int64{}},
+		{"garbage", map[string]int64{}},
+		{"=5", map[string]int64{}},
+		{"rates:BDT_INR=", map[string]int64{}},
+		{"rates:BDT_INR=x", map[string]int64{}},
+		{"rates:BDT_INR=-1", map[string]int64{}},
+		{"rates:BDT_INR=42,,nope,user:wallet=1e3,admin:queue=9", map[string]int64{"rates:BDT_INR": 42, "admin:queue": 9}},
+	}
+
+	for _, tt := range tests {
+		if got := parseEventID(tt.id); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseEventID(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestWriteEvent(t *testing.T) {
+	positions := map[string]int64{"user:wallet": 7}
+
+	var buf bytes.Buffer
+	data := []byte(`{"type":"rate_updated","topic":"rates:BDT_INR","seq":42}`)
+	if err := writeEvent(&buf, data, positions); err != nil {
+		t.Fatal(err)
+	}
+	want := "id: rates:BDT_INR=42,user:wallet=7\ndata: " + string(data) + "\n\n"
+	if buf.String() != want {
+		t.Errorf("wrote %q, want %q", buf.String(), want)
+	}
+
+	// Replies carry no seq, so they leave the id alone
+	buf.Reset()
+	data = []byte(`{"type":"subscribed","payload":{"topics":["rates:BDT_INR"]}}`)
+	if err := writeEvent(&buf, data, positions); err != nil {
+		t.Fatal(err)
+	}
+	if want := "data: " + string(data) + "\n\n"; buf.String() != want {
+		t.Errorf("wrote %q, want %q", buf.String(), want)
+	}
+	if len(positions) != 2 {
+		t.Errorf("positions %v after a reply", positions)
+	}
+}
+
+type noRevocations struct{}
+
+func (noRevocations) IsRevoked(string) bool { return false }
+
+func TestServeSSE(t *testing.T) {
+	const secret = "test-secret"
+	h := NewHub(middleware.NewTokenParser(secret, noRevocations{}), Options{
+		PingInterval: 50 * time.Millisecond,
+		SendBuffer:   16,
+		ReplaySize:   10,
+		ReplayWindow: time.Minute,
+	})
+	go h.Run()
+
+	for seq := int64(1); seq <= 2; seq++ {
+		event, err := events.New("rate_updated", "rates:BDT_INR", 0, map[string]int64{"n": seq})
+		if err != nil {
+			t.Fatal(err)
+		}
+		event.Seq = seq
+		h.Publish(event)
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, middleware.Claims{
+		UserID:           1,
+		SessionID:        "session",
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+	}).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(h.ServeSSE))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"?topics=rates:BDT_INR", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Last-Event-ID", "rates:BDT_INR=1")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	// The missed seq 2 is replayed with an id to resume from, then the
+	// stream is kept alive with comments
+	var ids []string
+	heartbeat := false
+	scanner := bufio.NewScanner(resp.Body)
+	for !heartbeat && scanner.Scan() {
+		line := scanner.Text()
+		if id, ok := strings.CutPrefix(line, "id: "); ok {
+			ids = append(ids, id)
+		}
+		heartbeat = line == ": ping"
+	}
+	if !heartbeat {
+		t.Fatalf("no heartbeat before the stream ended: %v", scanner.Err())
+	}
+	if fmt.Sprint(ids) != "[rates:BDT_INR=2]" {
+		t.Errorf("ids %v, want only the replayed event's", ids)
+	}
+}
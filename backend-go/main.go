@@ -7,8 +7,13 @@ import (
 	"bdpayx-backend/internal/config"
 	"bdpayx-backend/internal/database"
 	"bdpayx-backend/internal/handlers"
+	"bdpayx-backend/internal/ledger"
 	"bdpayx-backend/internal/middleware"
+	"bdpayx-backend/internal/models"
+	"bdpayx-backend/internal/money"
+	"bdpayx-backend/internal/rates"
 	"bdpayx-backend/internal/services"
+	"bdpayx-backend/internal/storage"
 	"bdpayx-backend/internal/websocket"
 
 	"github.com/gin-contrib/cors"
@@ -26,6 +31,11 @@ func main() {
 	// Initialize configuration
 	cfg := config.Load()
 
+	roundingMode, err := money.ParseRoundingMode(cfg.RoundingMode)
+	if err != nil {
+		log.Fatal("Invalid configuration:", err)
+	}
+
 	// Initialize database
 	db, err := database.Initialize(cfg.DatabaseURL)
 	if err != nil {
@@ -35,26 +45,94 @@ func main() {
 		defer db.Close()
 	}
 
+	// Load the currency registry before anything validates or rounds amounts
+	currencyService := services.NewCurrencyService(db)
+	if err := currencyService.Load(); err != nil {
+		log.Fatal("Failed to load currencies:", err)
+	}
+	if err := models.RegisterValidators(currencyService.Enabled); err != nil {
+		log.Fatal("Failed to register validators:", err)
+	}
+
 	// Initialize Redis (optional)
 	var redisClient *services.RedisService
 	if cfg.RedisHost != "" {
 		redisClient = services.NewRedisService(cfg.RedisHost, cfg.RedisPort, cfg.RedisPassword)
 	}
 
-	// Initialize services
-	authService := services.NewAuthService(db, cfg.JWTSecret)
-	rateService := services.NewRateService(db, redisClient)
-	transactionService := services.NewTransactionService(db)
-	walletService := services.NewWalletService(db)
-	adminService := services.NewAdminService(db)
-
-	// Initialize WebSocket hub
-	wsHub := websocket.NewHub()
+	// Initialize ledger and carry over balances from the legacy wallet columns
+	ledgerBook := ledger.New(db)
+	if db != nil {
+		if err := ledgerBook.ImportWalletBalances(); err != nil {
+			log.Fatal("Failed to import wallet balances into ledger:", err)
+		}
+	}
+
+	// Initialize file storage for uploaded payment proofs
+	fileStorage, err := storage.New(cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize storage:", err)
+	}
+
+	// Initialize the rate feed chain
+	rateFeed, err := rates.New(cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize rate feed:", err)
+	}
+
+	// Initialize access token checks, which reject tokens of signed-out
+	// sessions
+	revocations := services.NewRevocationList(db, redisClient)
+	tokens := middleware.NewTokenParser(cfg.JWTSecret, revocations)
+
+	// Initialize the event broker services publish their changes to, and
+	// the WebSocket hub passing them on to this instance's clients
+	broker, err := services.NewEventBroker(cfg.EventBroker, redisClient, cfg.WSReplayWindow)
+	if err != nil {
+		log.Fatal("Failed to initialize event broker:", err)
+	}
+	wsOrigins := []string{"*"}
+	if cfg.GinMode == "release" {
+		wsOrigins = []string{cfg.FrontendURL}
+	}
+	wsHub := websocket.NewHub(tokens, websocket.Options{
+		AllowedOrigins: wsOrigins,
+		PingInterval:   cfg.WSPingInterval,
+		MaxMessageSize: cfg.WSMaxMessageSize,
+		SendBuffer:     cfg.WSSendBuffer,
+		ReplaySize:     cfg.WSReplaySize,
+		ReplayWindow:   cfg.WSReplayWindow,
+	})
 	go wsHub.Run()
+	broker.Subscribe(wsHub.Publish)
 
-	// Start rate fluctuation service only if database is available
+	// Initialize services
+	authService := services.NewAuthService(db, cfg.JWTSecret, cfg.JWTExpiresIn, cfg.RefreshTokenTTL, revocations, broker)
+	pricingService := services.NewPricingService(db)
+	rateService := services.NewRateService(db, redisClient, roundingMode, rateFeed, cfg.RateStaleAfter, pricingService, broker)
+	quoteService := services.NewQuoteService(rateService, pricingService, cfg.QuoteSecret, cfg.QuoteTTL)
+	walletService := services.NewWalletService(db, ledgerBook, currencyService, broker)
+	transactionService := services.NewTransactionService(db, walletService, broker)
+	withdrawalService := services.NewWithdrawalService(db, walletService, broker)
+	depositService := services.NewDepositService(db, walletService, fileStorage, map[string]string{
+		models.PayoutBkash:  cfg.DepositBkashNumber,
+		models.PayoutNagad:  cfg.DepositNagadNumber,
+		models.PayoutRocket: cfg.DepositRocketNumber,
+		models.PayoutBank:   cfg.DepositBankDetails,
+		models.PayoutUPI:    cfg.DepositUPIID,
+	}, cfg.MaxUploadSize, broker)
+	paymentService := services.NewPaymentService(db, depositService, transactionService, cfg.PaymentMatchWindow)
+	adminService := services.NewAdminService(db, ledgerBook)
+	idempotencyService := services.NewIdempotencyService(db, redisClient, cfg.IdempotencyTTL)
+
+	// Start background services only if database is available
 	if db != nil {
-		go rateService.StartRateFluctuation()
+		go rateService.StartRateFeed(cfg.RateRefreshInterval)
+		go rateService.StartCandleAggregation(cfg.RateTickRetention)
+		go rateService.StartRateOverrides()
+		go idempotencyService.StartCleanup()
+		go authService.StartSessionCleanup()
+		go walletService.StartHoldExpiry()
 	}
 
 	// Initialize Gin router
@@ -68,7 +146,8 @@ func main() {
 	router.Use(gin.Recovery())
 	
 	// Add gzip compression for better performance
-	router.Use(gzip.Gzip(gzip.DefaultCompression))
+	// (not on the event stream, which must reach clients unbuffered)
+	router.Use(gzip.Gzip(gzip.DefaultCompression, gzip.WithExcludedPaths([]string{"/api/stream"})))
 	
 	// Add custom headers
 	router.Use(func(c *gin.Context) {
@@ -87,7 +166,8 @@ func main() {
 		corsConfig.AllowAllOrigins = true
 	}
 	corsConfig.AllowCredentials = true
-	corsConfig.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization"}
+	corsConfig.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization", middleware.IdempotencyKeyHeader}
+	corsConfig.ExposeHeaders = []string{middleware.IdempotentReplayedHeader}
 	router.Use(cors.New(corsConfig))
 
 	// Request logging middleware (only in development)
@@ -100,11 +180,17 @@ func main() {
 
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(authService)
-	exchangeHandler := handlers.NewExchangeHandler(rateService)
-	transactionHandler := handlers.NewTransactionHandler(transactionService)
+	exchangeHandler := handlers.NewExchangeHandler(rateService, quoteService)
+	transactionHandler := handlers.NewTransactionHandler(transactionService, quoteService)
 	walletHandler := handlers.NewWalletHandler(walletService)
-	adminHandler := handlers.NewAdminHandler(adminService)
+	withdrawalHandler := handlers.NewWithdrawalHandler(withdrawalService)
+	depositHandler := handlers.NewDepositHandler(depositService)
+	paymentHandler := handlers.NewPaymentHandler(paymentService)
+	pricingHandler := handlers.NewPricingHandler(pricingService)
+	currencyHandler := handlers.NewCurrencyHandler(currencyService)
+	adminHandler := handlers.NewAdminHandler(adminService, transactionService, rateService)
 	wsHandler := handlers.NewWebSocketHandler(wsHub)
+	idempotent := middleware.IdempotencyMiddleware(idempotencyService)
 
 	// Health check endpoint
 	router.GET("/api/health", func(c *gin.Context) {
@@ -123,56 +209,104 @@ func main() {
 		{
 			auth.POST("/register", authHandler.Register)
 			auth.POST("/login", authHandler.Login)
+			auth.POST("/refresh", authHandler.Refresh)
+			auth.POST("/logout", middleware.AuthMiddleware(tokens), authHandler.Logout)
+			auth.POST("/logout-all", middleware.AuthMiddleware(tokens), authHandler.LogoutAll)
 			auth.POST("/google", authHandler.GoogleAuth)
-			auth.GET("/profile", middleware.AuthMiddleware(cfg.JWTSecret), authHandler.GetProfile)
-			auth.PUT("/profile", middleware.AuthMiddleware(cfg.JWTSecret), authHandler.UpdateProfile)
+			auth.GET("/profile", middleware.AuthMiddleware(tokens), authHandler.GetProfile)
+			auth.PUT("/profile", middleware.AuthMiddleware(tokens), authHandler.UpdateProfile)
 		}
 
 		// Exchange routes
 		exchange := api.Group("/exchange")
 		{
 			exchange.GET("/rates", exchangeHandler.GetRates)
-			exchange.POST("/calculate", exchangeHandler.CalculateExchange)
+			exchange.GET("/currencies", currencyHandler.GetCurrencies)
+			exchange.POST("/calculate", middleware.OptionalAuthMiddleware(tokens), exchangeHandler.CalculateExchange)
+			exchange.GET("/history", exchangeHandler.GetHistory)
+			exchange.GET("/rate-at", exchangeHandler.GetRateAt)
 		}
 
 		// Transaction routes (protected)
 		transactions := api.Group("/transactions")
-		transactions.Use(middleware.AuthMiddleware(cfg.JWTSecret))
+		transactions.Use(middleware.AuthMiddleware(tokens))
 		{
-			transactions.POST("/", transactionHandler.CreateTransaction)
+			transactions.POST("/", idempotent, transactionHandler.CreateTransaction)
 			transactions.GET("/", transactionHandler.GetUserTransactions)
 			transactions.GET("/:id", transactionHandler.GetTransaction)
 			transactions.PUT("/:id/status", transactionHandler.UpdateTransactionStatus)
+			transactions.GET("/:id/events", transactionHandler.GetTransactionEvents)
 		}
 
 		// Wallet routes (protected)
 		wallet := api.Group("/wallet")
-		wallet.Use(middleware.AuthMiddleware(cfg.JWTSecret))
+		wallet.Use(middleware.AuthMiddleware(tokens))
 		{
 			wallet.GET("/balance", walletHandler.GetBalance)
-			wallet.POST("/deposit", walletHandler.Deposit)
-			wallet.POST("/withdraw", walletHandler.Withdraw)
+			wallet.GET("/deposit-methods", depositHandler.GetMethods)
+			wallet.POST("/deposit", idempotent, depositHandler.CreateDeposit)
+			wallet.GET("/deposits", depositHandler.GetUserDeposits)
+			wallet.POST("/deposits/:id/proof", depositHandler.UploadProof)
+			wallet.GET("/deposits/:id/proof", depositHandler.GetUserProof)
+			wallet.POST("/deposits/:id/cancel", depositHandler.CancelDeposit)
+			wallet.POST("/withdraw", idempotent, withdrawalHandler.CreateWithdrawal)
+			wallet.GET("/withdrawals", withdrawalHandler.GetUserWithdrawals)
+			wallet.POST("/withdrawals/:id/cancel", withdrawalHandler.CancelWithdrawal)
 			wallet.GET("/history", walletHandler.GetHistory)
+			wallet.GET("/holds", walletHandler.GetHolds)
 		}
 
 		// Admin routes (protected)
 		admin := api.Group("/admin")
-		admin.Use(middleware.AuthMiddleware(cfg.JWTSecret), middleware.AdminMiddleware())
+		admin.Use(middleware.AuthMiddleware(tokens), middleware.AdminMiddleware())
 		{
 			admin.GET("/dashboard", adminHandler.GetDashboard)
 			admin.GET("/transactions", adminHandler.GetAllTransactions)
 			admin.PUT("/transactions/:id/status", adminHandler.UpdateTransactionStatus)
+			admin.GET("/transactions/:id/events", adminHandler.GetTransactionEvents)
 			admin.GET("/users", adminHandler.GetUsers)
 			admin.PUT("/users/:id/status", adminHandler.UpdateUserStatus)
+			admin.PUT("/users/:id/segment", pricingHandler.SetUserSegment)
 			admin.POST("/rates", adminHandler.UpdateRates)
+			admin.GET("/rates/arbitrage", adminHandler.GetArbitrageReport)
+			admin.GET("/rate-overrides", adminHandler.GetRateOverrides)
+			admin.POST("/rate-overrides", adminHandler.CreateRateOverride)
+			admin.POST("/rate-overrides/:id/cancel", adminHandler.CancelRateOverride)
+			admin.GET("/currencies", currencyHandler.GetAllCurrencies)
+			admin.PUT("/currencies/:code", currencyHandler.SaveCurrency)
+			admin.GET("/simulator", exchangeHandler.GetSimulatorParams)
+			admin.PUT("/simulator/:pair", exchangeHandler.UpdateSimulatorParams)
+			admin.GET("/pricing", pricingHandler.GetTiers)
+			admin.POST("/pricing", pricingHandler.CreateTier)
+			admin.PUT("/pricing/:id", pricingHandler.UpdateTier)
+			admin.DELETE("/pricing/:id", pricingHandler.DeleteTier)
+			admin.GET("/ledger/verify", adminHandler.VerifyLedger)
+			admin.GET("/deposits", depositHandler.GetDeposits)
+			admin.GET("/deposits/:id/proof", depositHandler.GetProof)
+			admin.POST("/deposits/:id/approve", depositHandler.ApproveDeposit)
+			admin.POST("/deposits/:id/reject", depositHandler.RejectDeposit)
+			admin.GET("/withdrawals", withdrawalHandler.GetWithdrawals)
+			admin.POST("/withdrawals/:id/approve", withdrawalHandler.ApproveWithdrawal)
+			admin.POST("/withdrawals/:id/paid", withdrawalHandler.MarkWithdrawalPaid)
+			admin.POST("/withdrawals/:id/reject", withdrawalHandler.RejectWithdrawal)
+			admin.GET("/payments", paymentHandler.GetPayments)
+			admin.POST("/payments/:id/reconcile", paymentHandler.ReconcilePayment)
+			admin.POST("/payments/:id/ignore", paymentHandler.IgnorePayment)
+		}
+
+		// Webhooks
+		webhooks := api.Group("/webhooks")
+		webhooks.Use(middleware.WebhookAuthMiddleware(cfg.SMSWebhookKey))
+		{
+			webhooks.POST("/sms", paymentHandler.ReceiveSMS)
 		}
 
 		// WebSocket endpoint
 		api.GET("/ws", wsHandler.HandleWebSocket)
-	}
 
-	// Static file serving
-	router.Static("/uploads", "./uploads")
+		// Server-Sent Events, for clients that cannot open a WebSocket
+		api.GET("/stream", wsHandler.HandleStream)
+	}
 
 	// Start server
 	port := os.Getenv("PORT")